@@ -20,6 +20,7 @@ package api
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,7 +29,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -39,16 +39,16 @@ import (
 	goconfig "github.com/TheCacophonyProject/go-config"
 	"github.com/TheCacophonyProject/go-utils/logging"
 	"github.com/TheCacophonyProject/go-utils/saltutil"
+	"github.com/TheCacophonyProject/management-interface/command"
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/TheCacophonyProject/management-interface/settings"
 	signalstrength "github.com/TheCacophonyProject/management-interface/signal-strength"
-	saltrequester "github.com/TheCacophonyProject/salt-updater"
 	"github.com/godbus/dbus"
 	"github.com/gorilla/mux"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
-	"github.com/TheCacophonyProject/event-reporter/v3/eventclient"
-	"github.com/TheCacophonyProject/trap-controller/trapdbusclient"
-
 	netmanagerclient "github.com/TheCacophonyProject/rpi-net-manager/netmanagerclient"
 )
 
@@ -59,18 +59,34 @@ const (
 	aacGlob             = "*.aac"
 	failedUploadsFolder = "failed-uploads"
 	rebootDelay         = time.Second * 5
-	apiVersion          = 9
+	apiVersion          = 10
+
+	// How long the commands the API runs are given before they are killed.
+	quickCommandTimeout = 5 * time.Second
+	systemctlTimeout    = 30 * time.Second
+	pingTimeout         = 20 * time.Second
+	saltCallTimeout     = 2 * time.Minute
+	logsTimeout         = 2 * time.Minute
+	classifyTimeout     = 30 * time.Minute
 )
 
 type ManagementAPI struct {
 	config       *goconfig.Config
+	settings     settings.Settings
+	profile      device.Profile
+	peers        peers.Peers
+	commands     command.Runner
 	router       *mux.Router
 	hotspotTimer *time.Ticker
 	recordingDir string
 	appVersion   string
 }
 
-func NewAPI(router *mux.Router, config *goconfig.Config, appVersion string, l *logging.Logger) (*ManagementAPI, error) {
+// NewAPI returns the API handlers, which use p to talk to the other services
+// on the device, commands to run system commands and s for the paths and
+// timings of the device. Features that the device profile doesn't have are
+// turned off.
+func NewAPI(router *mux.Router, config *goconfig.Config, s settings.Settings, profile device.Profile, p peers.Peers, commands command.Runner, appVersion string, l *logging.Logger) (*ManagementAPI, error) {
 	log = l
 	thermalRecorder := goconfig.DefaultThermalRecorder()
 	if err := config.Unmarshal(goconfig.ThermalRecorderKey, &thermalRecorder); err != nil {
@@ -79,24 +95,42 @@ func NewAPI(router *mux.Router, config *goconfig.Config, appVersion string, l *l
 
 	return &ManagementAPI{
 		config:       config,
+		settings:     s,
+		profile:      profile,
+		peers:        p,
+		commands:     commands,
 		router:       router,
 		recordingDir: thermalRecorder.OutputDir,
 		appVersion:   appVersion,
 	}, nil
 }
 
+// Requires makes a handler respond with 501 Not Implemented on devices
+// that don't have the capability it needs.
+func (api *ManagementAPI) Requires(c device.Capability, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !api.profile.Has(c) {
+			WriteError(w, http.StatusNotImplemented, fmt.Sprintf("%s devices don't have %s", api.profile.Type, c), map[string]interface{}{
+				"capability": c,
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (api *ManagementAPI) StopHotspotTimer() {
 	if api.hotspotTimer != nil {
 		api.hotspotTimer.Stop()
 	}
 }
 
-func checkIsConnectedToNetworkWithRetries() (string, error) {
+func (api *ManagementAPI) checkIsConnectedToNetworkWithRetries(ctx context.Context) (string, error) {
 	// Try to get the current network name
 	var ssid string
 	var err error
 	for i := 0; i < 5; i++ {
-		ssid, err = getCurrentWifiNetwork()
+		ssid, err = api.getCurrentWifiNetwork(ctx)
 		if err == nil {
 			break
 		}
@@ -107,7 +141,7 @@ func checkIsConnectedToNetworkWithRetries() (string, error) {
 
 func (api *ManagementAPI) ManageHotspot() {
 	// Check if we are connected to a network
-	ssid, err := checkIsConnectedToNetworkWithRetries()
+	ssid, err := api.checkIsConnectedToNetworkWithRetries(context.Background())
 	if err != nil {
 		log.Printf("Error checking if connected to network: %v", err)
 	}
@@ -116,19 +150,19 @@ func (api *ManagementAPI) ManageHotspot() {
 		return
 	}
 
-	if err := netmanagerclient.EnableHotspot(true); err != nil {
+	if err := api.peers.NetManager.EnableHotspot(true); err != nil {
 		log.Println("Failed to initialise hotspot:", err)
-		if err := netmanagerclient.EnableWifi(true); err != nil {
+		if err := api.peers.NetManager.EnableWifi(true); err != nil {
 			log.Println("Failed to stop hotspot:", err)
 		}
 		return
 	}
-	netmanagerclient.KeepHotspotOnFor(60 * 5)
+	api.peers.NetManager.KeepHotspotOnFor(int(api.settings.KeepHotspotOnFor.Seconds()))
 }
 
 func (api *ManagementAPI) GetVersion(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
-		"apiVersion": apiVersion,
+		"apiVersion": VersionFromContext(r.Context()),
 		"appVersion": api.appVersion,
 	}
 	w.WriteHeader(http.StatusOK)
@@ -163,31 +197,32 @@ func getLastSaltUpdate() string {
 
 // GetDeviceInfo returns information about this device
 func (api *ManagementAPI) GetDeviceInfo(w http.ResponseWriter, r *http.Request) {
-	var device goconfig.Device
-	if err := api.config.Unmarshal(goconfig.DeviceKey, &device); err != nil {
+	var deviceConfig goconfig.Device
+	if err := api.config.Unmarshal(goconfig.DeviceKey, &deviceConfig); err != nil {
 		log.Printf("/device-info failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to read device config\n")
+		WriteError(w, http.StatusInternalServerError, "failed to read device config", err.Error())
 		return
 	}
 
 	type deviceInfo struct {
-		ServerURL   string `json:"serverURL"`
-		GroupName   string `json:"groupname"`
-		Devicename  string `json:"devicename"`
-		DeviceID    int    `json:"deviceID"`
-		SaltID      string `json:"saltID"`
-		LastUpdated string `json:"lastUpdated"`
-		Type        string `json:"type"`
+		ServerURL    string              `json:"serverURL"`
+		GroupName    string              `json:"groupname"`
+		Devicename   string              `json:"devicename"`
+		DeviceID     int                 `json:"deviceID"`
+		SaltID       string              `json:"saltID"`
+		LastUpdated  string              `json:"lastUpdated"`
+		Type         string              `json:"type"`
+		Capabilities []device.Capability `json:"capabilities"`
 	}
 	info := deviceInfo{
-		ServerURL:   device.Server,
-		GroupName:   device.Group,
-		Devicename:  device.Name,
-		DeviceID:    device.ID,
-		SaltID:      strings.TrimSpace(readFile("/etc/salt/minion_id")),
-		LastUpdated: getLastSaltUpdate(),
-		Type:        getDeviceType(),
+		ServerURL:    deviceConfig.Server,
+		GroupName:    deviceConfig.Group,
+		Devicename:   deviceConfig.Name,
+		DeviceID:     deviceConfig.ID,
+		SaltID:       strings.TrimSpace(readFile(device.MinionIDFile)),
+		LastUpdated:  getLastSaltUpdate(),
+		Type:         api.profile.Type,
+		Capabilities: api.profile.Capabilities(),
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(info)
@@ -204,8 +239,7 @@ func (api *ManagementAPI) GetRecordings(w http.ResponseWriter, r *http.Request)
 func (api *ManagementAPI) GetSignalStrength(w http.ResponseWriter, r *http.Request) {
 	sig, err := signalstrength.Run()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to connect to modem\n")
+		writeError(w, http.StatusInternalServerError, "failed to connect to modem")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -217,7 +251,7 @@ func (api *ManagementAPI) GetRecording(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["id"]
 	path := getRecordingPath(name, api.recordingDir)
 	if path == "" {
-		http.Error(w, "file not found\n", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "file not found")
 		return
 	}
 
@@ -234,7 +268,7 @@ func (api *ManagementAPI) GetRecording(w http.ResponseWriter, r *http.Request) {
 func sendFile(w http.ResponseWriter, r *http.Request, path, name, contentType string) {
 	f, err := os.Open(path)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "internal error")
 		log.Println(err)
 		return
 	}
@@ -242,7 +276,7 @@ func sendFile(w http.ResponseWriter, r *http.Request, path, name, contentType st
 
 	fi, err := f.Stat()
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "internal error")
 		log.Println(err)
 		return
 	}
@@ -276,8 +310,7 @@ func (api *ManagementAPI) DeleteRecording(w http.ResponseWriter, r *http.Request
 		return
 	} else if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to delete file")
+		WriteError(w, http.StatusInternalServerError, "failed to delete file", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -286,30 +319,16 @@ func (api *ManagementAPI) DeleteRecording(w http.ResponseWriter, r *http.Request
 
 // TakeSnapshot will request a new snapshot to be taken by thermal-recorder
 func (api *ManagementAPI) TakeSnapshot(w http.ResponseWriter, r *http.Request) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	recorder := conn.Object("org.cacophony.thermalrecorder", "/org/cacophony/thermalrecorder")
-	err = recorder.Call("org.cacophony.thermalrecorder.TakeSnapshot", 0).Err
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := api.peers.ThermalRecorder.TakeSnapshot(); err != nil {
+		serverError(&w, fmt.Errorf("failed to take snapshot: %v", err))
 		return
 	}
 }
 
 // TakeSnapshotRecording will request a new snapshot recording to be taken by thermal-recorder
 func (api *ManagementAPI) TakeSnapshotRecording(w http.ResponseWriter, r *http.Request) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	recorder := conn.Object("org.cacophony.thermalrecorder", "/org/cacophony/thermalrecorder")
-	err = recorder.Call("org.cacophony.thermalrecorder.TakeTestRecording", 0).Err
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := api.peers.ThermalRecorder.TakeTestRecording(); err != nil {
+		serverError(&w, fmt.Errorf("failed to take snapshot recording: %v", err))
 		return
 	}
 }
@@ -319,14 +338,12 @@ func (api *ManagementAPI) Reregister(w http.ResponseWriter, r *http.Request) {
 	group := r.FormValue("group")
 	name := r.FormValue("name")
 	if group == "" && name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "must set name or group\n")
+		writeError(w, http.StatusBadRequest, "must set name or group")
 		return
 	}
 	apiClient, err := goapi.New()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, fmt.Sprintf("failed to get api client for device: %s", err.Error()))
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get api client for device: %s", err.Error()))
 		return
 	}
 	if group == "" {
@@ -338,8 +355,7 @@ func (api *ManagementAPI) Reregister(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("renaming with name: '%s' group: '%s'", name, group)
 	if err := apiClient.Reregister(name, group, randString(20)); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -359,14 +375,12 @@ func (api *ManagementAPI) ReregisterAuthorized(w http.ResponseWriter, r *http.Re
 	}
 
 	if req.Group == "" && req.Name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, "must set name or group\n")
+		writeError(w, http.StatusBadRequest, "must set name or group")
 		return
 	}
 	apiClient, err := goapi.New()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, fmt.Sprintf("failed to get api client for device: %s", err.Error()))
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get api client for device: %s", err.Error()))
 		return
 	}
 	if req.Group == "" {
@@ -377,8 +391,7 @@ func (api *ManagementAPI) ReregisterAuthorized(w http.ResponseWriter, r *http.Re
 	}
 
 	if err := apiClient.ReRegisterByAuthorized(req.Name, req.Group, randString(20), req.AuthorizedUser); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, err.Error())
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -396,7 +409,8 @@ func (api *ManagementAPI) Reboot(w http.ResponseWriter, r *http.Request) {
 		log.Printf("device rebooting in %s seconds", rebootDelay)
 		time.Sleep(rebootDelay)
 		log.Println("rebooting")
-		log.Println(exec.Command("/sbin/reboot").Run())
+		_, err := api.commands.Run(context.Background(), quickCommandTimeout, "/sbin/reboot")
+		log.Println(err)
 	}()
 	w.WriteHeader(http.StatusOK)
 }
@@ -559,16 +573,6 @@ func (api *ManagementAPI) SetLocation(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func badRequest(w *http.ResponseWriter, err error) {
-	(*w).WriteHeader(http.StatusBadRequest)
-	io.WriteString(*w, err.Error())
-}
-
-func serverError(w *http.ResponseWriter, err error) {
-	log.Printf("server error: %v", err)
-	(*w).WriteHeader(http.StatusInternalServerError)
-}
-
 func getCptvNames(dir string) []string {
 	matches, _ := filepath.Glob(filepath.Join(dir, cptvGlob))
 	failedUploadMatches, _ := filepath.Glob(filepath.Join(dir, failedUploadsFolder, cptvGlob))
@@ -608,9 +612,10 @@ func getRecordingPath(file, dir string) string {
 // GetEventKeys will return an array of the event keys on the device
 func (api *ManagementAPI) GetEventKeys(w http.ResponseWriter, r *http.Request) {
 	log.Println("getting event keys")
-	keys, err := eventclient.GetEventKeys()
+	keys, err := api.peers.Events.Keys()
 	if err != nil {
 		serverError(&w, err)
+		return
 	}
 	json.NewEncoder(w).Encode(keys)
 }
@@ -626,7 +631,7 @@ func (api *ManagementAPI) GetEvents(w http.ResponseWriter, r *http.Request) {
 	log.Printf("getting %d events", len(keys))
 	events := map[uint64]interface{}{}
 	for _, key := range keys {
-		event, err := eventclient.GetEvent(key)
+		event, err := api.peers.Events.Get(key)
 		if err != nil {
 			events[key] = map[string]interface{}{
 				"success": false,
@@ -653,7 +658,7 @@ func (api *ManagementAPI) DeleteEvents(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("deleting %d events", len(keys))
 	for _, key := range keys {
-		if err := eventclient.DeleteEvent(key); err != nil {
+		if err := api.peers.Events.Delete(key); err != nil {
 			serverError(&w, err)
 			return
 		}
@@ -664,7 +669,7 @@ func (api *ManagementAPI) DeleteEvents(w http.ResponseWriter, r *http.Request) {
 func (api *ManagementAPI) TriggerTrap(w http.ResponseWriter, r *http.Request) {
 	log.Println("triggering trap")
 
-	if err := trapdbusclient.TriggerTrap(map[string]interface{}{"test": true}); err != nil {
+	if err := api.peers.Trap.TriggerTrap(map[string]interface{}{"test": true}); err != nil {
 		badRequest(&w, err)
 		return
 	}
@@ -673,7 +678,7 @@ func (api *ManagementAPI) TriggerTrap(w http.ResponseWriter, r *http.Request) {
 // CheckSaltConnection will try to ping the salt server and return the response
 func (api *ManagementAPI) CheckSaltConnection(w http.ResponseWriter, r *http.Request) {
 	log.Println("pinging salt server")
-	state, err := saltrequester.RunPingSync()
+	state, err := api.peers.Salt.Ping()
 	if err != nil {
 		log.Printf("error running salt sync ping: %v", err)
 		serverError(&w, errors.New("failed to make ping call to salt server"))
@@ -696,7 +701,7 @@ func (api *ManagementAPI) StartSaltUpdate(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	state, err := saltrequester.State()
+	state, err := api.peers.Salt.State()
 	if err != nil {
 		serverError(&w, errors.New("failed to check salt state"))
 		return
@@ -710,7 +715,7 @@ func (api *ManagementAPI) StartSaltUpdate(w http.ResponseWriter, r *http.Request
 
 	// Check if we should force the update
 	if requestBody.Force {
-		err := saltrequester.ForceUpdate()
+		err := api.peers.Salt.ForceUpdate()
 		if err != nil {
 			log.Printf("error forcing salt update: %v", err)
 			serverError(&w, errors.New("failed to force salt update"))
@@ -721,7 +726,7 @@ func (api *ManagementAPI) StartSaltUpdate(w http.ResponseWriter, r *http.Request
 	}
 
 	// Run the update, this will only run an update if one is required.
-	err = saltrequester.RunUpdate()
+	err = api.peers.Salt.RunUpdate()
 	if err != nil {
 		log.Printf("error calling a salt update: %v", err)
 		serverError(&w, errors.New("failed to call a salt update"))
@@ -732,7 +737,7 @@ func (api *ManagementAPI) StartSaltUpdate(w http.ResponseWriter, r *http.Request
 
 // GetSaltUpdateState will get the salt update status
 func (api *ManagementAPI) GetSaltUpdateState(w http.ResponseWriter, r *http.Request) {
-	state, err := saltrequester.State()
+	state, err := api.peers.Salt.State()
 	if err != nil {
 		log.Printf("error getting salt state: %v", err)
 		serverError(&w, errors.New("failed to get salt state"))
@@ -743,7 +748,7 @@ func (api *ManagementAPI) GetSaltUpdateState(w http.ResponseWriter, r *http.Requ
 
 // GetSaltAutoUpdate will check if salt auto update is enabled
 func (api *ManagementAPI) GetSaltAutoUpdate(w http.ResponseWriter, r *http.Request) {
-	autoUpdate, err := saltrequester.IsAutoUpdateOn()
+	autoUpdate, err := api.peers.Salt.IsAutoUpdateOn()
 	if err != nil {
 		log.Printf("error getting salt auto update state: %v", err)
 		serverError(&w, errors.New("failed to get salt auto update state"))
@@ -764,7 +769,7 @@ func (api *ManagementAPI) PostSaltAutoUpdate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	autoUpdate := strings.ToLower(autoUpdateStr) == "true"
-	if err := saltrequester.SetAutoUpdate(autoUpdate); err != nil {
+	if err := api.peers.Salt.SetAutoUpdate(autoUpdate); err != nil {
 		log.Printf("error setting auto update: %v", err)
 		serverError(&w, errors.New("failed to set auto update"))
 	}
@@ -785,7 +790,7 @@ func (api *ManagementAPI) GetServiceLogs(w http.ResponseWriter, r *http.Request)
 		parseFormErrorResponse(&w, err)
 		return
 	}
-	logs, err := getServiceLogs(service, lines)
+	logs, err := api.getServiceLogs(r.Context(), service, lines)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -803,7 +808,7 @@ func (api *ManagementAPI) GetServiceStatus(w http.ResponseWriter, r *http.Reques
 		parseFormErrorResponse(&w, errors.New("service field was empty"))
 		return
 	}
-	serviceStatus, err := getServiceStatus(service)
+	serviceStatus, err := api.getServiceStatus(r.Context(), service)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -827,8 +832,8 @@ type BatteryReading struct {
 	DepletionConfidence string `json:"depletionConfidence"`
 }
 
-func getLastBatteryReading() (BatteryReading, error) {
-	file, err := os.Open("/var/log/battery-readings.csv")
+func getLastBatteryReading(path string) (BatteryReading, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return BatteryReading{}, err
 	}
@@ -846,7 +851,7 @@ func getLastBatteryReading() (BatteryReading, error) {
 
 	parts := strings.Split(lastLine, ",")
 	if len(parts) < 4 {
-		return BatteryReading{}, errors.New("unexpected format in battery-readings.csv")
+		return BatteryReading{}, fmt.Errorf("unexpected format in %s", path)
 	}
 
 	reading := BatteryReading{
@@ -887,11 +892,10 @@ func getLastBatteryReading() (BatteryReading, error) {
 
 func (api *ManagementAPI) GetTestVideos(w http.ResponseWriter, r *http.Request) {
 	recordingNames := []string{}
-	testRecordingsPath := "/var/spool/cptv/test-recordings"
+	testRecordingsPath := api.settings.TestRecordingsDir
 	_, err := os.Stat(testRecordingsPath)
 	if os.IsNotExist(err) {
-		http.Error(w, "Directory does not exist", http.StatusNotFound)
-		json.NewEncoder(w).Encode(recordingNames)
+		writeError(w, http.StatusNotFound, "Directory does not exist")
 		return
 	}
 	recordings, err := os.ReadDir(testRecordingsPath)
@@ -931,13 +935,13 @@ func (api *ManagementAPI) UploadTestRecording(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = os.MkdirAll("/var/spool/cptv/test-recordings", 0755)
+	err = os.MkdirAll(api.settings.TestRecordingsDir, 0755)
 	if err != nil {
 		serverError(&w, err)
 		return
 	}
 
-	err = os.WriteFile("/var/spool/cptv/test-recordings/"+handler.Filename, fileBytes, 0644)
+	err = os.WriteFile(filepath.Join(api.settings.TestRecordingsDir, handler.Filename), fileBytes, 0644)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -952,70 +956,60 @@ func (api *ManagementAPI) PlayTestVideo(w http.ResponseWriter, r *http.Request)
 
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to read request body")
 		return
 	}
 
 	var req VideoRequest
 	if err := json.Unmarshal(bodyBytes, &req); err != nil {
 		log.Printf("Failed to parse request body: %s, error: %s", bodyBytes, err)
-		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, "Failed to parse request body", err.Error())
 		return
 	}
 
-	videoName := "/var/spool/cptv/test-recordings/" + req.Video
+	videoName := filepath.Join(api.settings.TestRecordingsDir, req.Video)
 	log.Printf("Playing %s", videoName)
 
+	// The services need to be started again even if the client goes away.
+	ctx := context.WithoutCancel(r.Context())
 	recorderService := "thermal-recorder-py"
 	tc2AgentService := "tc2-agent"
-	if err := manageService("stop", recorderService); err != nil {
+	if err := api.manageService(ctx, "stop", recorderService); err != nil {
 		serverError(&w, err)
 		return
 	}
-	if err := manageService("stop", tc2AgentService); err != nil {
+	if err := api.manageService(ctx, "stop", tc2AgentService); err != nil {
 		serverError(&w, err)
 		return
 	}
 
-	cmd := exec.Command("/home/pi/.venv/classifier/bin/pi_classify", "--fps", "9", "--file", videoName)
-	log.Println(strings.Join(cmd.Args, " "))
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatalf("Failed to create stdout pipe: %s", err)
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		log.Fatalf("Failed to create stderr pipe: %s", err)
-	}
-
+	classifier := api.settings.Classifier
+	args := []string{"--fps", "9", "--file", videoName}
+	log.Println(command.Line(classifier, args...))
+	stdout, stdoutWriter := io.Pipe()
 	go streamOutput(stdout)
-	go streamOutput(stderr)
-
-	err = cmd.Start()
-	if err != nil {
-		log.Fatalf("Failed to start command: %s", err)
+	classifyErr := api.commands.Stream(ctx, classifyTimeout, stdoutWriter, classifier, args...)
+	stdoutWriter.Close()
+	if classifyErr != nil {
+		log.Printf("Failed to classify %s: %v", videoName, classifyErr)
 	}
 
-	err = cmd.Wait()
-	if err != nil {
-		log.Fatalf("Command finished with error: %s", err)
-	}
-
-	if err := manageService("start", recorderService); err != nil {
+	if err := api.manageService(ctx, "start", recorderService); err != nil {
 		serverError(&w, err)
 		return
 	}
-	if err := manageService("start", tc2AgentService); err != nil {
+	if err := api.manageService(ctx, "start", tc2AgentService); err != nil {
 		serverError(&w, err)
 		return
 	}
+	if classifyErr != nil {
+		serverError(&w, classifyErr)
+	}
 }
 
 // Start or stop a service
-func manageService(action, serviceName string) error {
-	cmd := exec.Command("systemctl", action, serviceName)
-	err := cmd.Run()
+func (api *ManagementAPI) manageService(ctx context.Context, action, serviceName string) error {
+	_, err := api.commands.Run(ctx, systemctlTimeout, "systemctl", action, serviceName)
 	if err != nil {
 		return fmt.Errorf("failed to %s service %s: %v", action, serviceName, err)
 	}
@@ -1028,8 +1022,7 @@ func (api *ManagementAPI) GetNetworkInterfaces(w http.ResponseWriter, r *http.Re
 	interfaces, err := net.Interfaces()
 	if err != nil {
 		log.Printf("Error getting network interfaces: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to get network interfaces\n")
+		WriteError(w, http.StatusInternalServerError, "failed to get network interfaces", err.Error())
 		return
 	}
 
@@ -1062,8 +1055,8 @@ func (api *ManagementAPI) GetNetworkInterfaces(w http.ResponseWriter, r *http.Re
 var errNoWifiInterface = errors.New("no active wifi interface found")
 
 // getActiveWifiInterface returns the first Wi-Fi interface that appears to be active.
-func getActiveWifiInterface() (string, error) {
-	if iface, err := getActiveWifiInterfaceNMCLI(); err == nil {
+func (api *ManagementAPI) getActiveWifiInterface(ctx context.Context) (string, error) {
+	if iface, err := api.getActiveWifiInterfaceNMCLI(ctx); err == nil {
 		log.Printf("Detected Wi-Fi interface via nmcli: %s", iface)
 		return iface, nil
 	} else if err != nil {
@@ -1076,9 +1069,8 @@ func getActiveWifiInterface() (string, error) {
 	return iface, err
 }
 
-func getActiveWifiInterfaceNMCLI() (string, error) {
-	cmd := exec.Command("nmcli", "-t", "-f", "DEVICE,TYPE,STATE", "device", "status")
-	output, err := cmd.Output()
+func (api *ManagementAPI) getActiveWifiInterfaceNMCLI(ctx context.Context) (string, error) {
+	output, err := api.commands.Run(ctx, quickCommandTimeout, "nmcli", "-t", "-f", "DEVICE,TYPE,STATE", "device", "status")
 	if err != nil {
 		return "", err
 	}
@@ -1174,8 +1166,8 @@ func interfaceHasUsableIP(iface net.Interface) bool {
 	return false
 }
 
-func getCurrentWifiNetwork() (string, error) {
-	iface, err := getActiveWifiInterface()
+func (api *ManagementAPI) getCurrentWifiNetwork(ctx context.Context) (string, error) {
+	iface, err := api.getActiveWifiInterface(ctx)
 	if err != nil {
 		if errors.Is(err, errNoWifiInterface) {
 			return "", nil
@@ -1183,8 +1175,7 @@ func getCurrentWifiNetwork() (string, error) {
 		return "", err
 	}
 
-	cmd := exec.Command("iwgetid", iface, "-r")
-	output, err := cmd.Output()
+	output, err := api.commands.Run(ctx, quickCommandTimeout, "iwgetid", iface, "-r")
 	if err != nil {
 		if len(output) == 0 {
 			return "", nil
@@ -1197,14 +1188,14 @@ func getCurrentWifiNetwork() (string, error) {
 }
 
 // CheckInternetConnection checks if a specified network interface has internet access
-func CheckInternetConnection(interfaceName string) bool {
+func (api *ManagementAPI) CheckInternetConnection(ctx context.Context, interfaceName string) bool {
 	iface, err := net.InterfaceByName(interfaceName)
 	if err != nil {
 		return false
 	}
 	args := []string{"-I", iface.Name, "-c", "3", "-n", "-W", "15", "1.1.1.1"}
 
-	if err := exec.Command("ping", args...).Run(); err != nil {
+	if _, err := api.commands.Run(ctx, pingTimeout, "ping", args...); err != nil {
 		log.Printf("ping via %s failed: %v", iface.Name, err)
 		return false
 	}
@@ -1214,7 +1205,7 @@ func CheckInternetConnection(interfaceName string) bool {
 func (api *ManagementAPI) CheckModemInternetConnection(w http.ResponseWriter, r *http.Request) {
 	// Check if connected to modem
 	log.Println("Checking modem connection")
-	connected := CheckInternetConnection("usb0")
+	connected := api.CheckInternetConnection(r.Context(), "usb0")
 	log.Printf("Modem connection: %v", connected)
 
 	// Send the current network as a JSON response
@@ -1226,7 +1217,7 @@ func (api *ManagementAPI) CheckModemInternetConnection(w http.ResponseWriter, r
 func (api *ManagementAPI) CheckWifiInternetConnection(w http.ResponseWriter, r *http.Request) {
 	// Check if connected to Wi-Fi
 	log.Println("Checking Wi-Fi connection")
-	iface, err := getActiveWifiInterface()
+	iface, err := api.getActiveWifiInterface(r.Context())
 	if err != nil {
 		if !errors.Is(err, errNoWifiInterface) {
 			log.Printf("Error determining active Wi-Fi interface: %v", err)
@@ -1238,7 +1229,7 @@ func (api *ManagementAPI) CheckWifiInternetConnection(w http.ResponseWriter, r *
 		return
 	}
 	log.Printf("Using Wi-Fi interface: %s", iface)
-	connected := CheckInternetConnection(iface)
+	connected := api.CheckInternetConnection(r.Context(), iface)
 	log.Printf("Wi-Fi connection: %v", connected)
 
 	// Send the current network as a JSON response
@@ -1249,11 +1240,10 @@ func (api *ManagementAPI) CheckWifiInternetConnection(w http.ResponseWriter, r *
 func (api *ManagementAPI) GetCurrentWifiNetwork(w http.ResponseWriter, r *http.Request) {
 	// Get the current Wi-Fi network
 	log.Println("Getting current Wi-Fi network")
-	currentNetwork, err := getCurrentWifiNetwork()
+	currentNetwork, err := api.getCurrentWifiNetwork(r.Context())
 	if err != nil {
 		log.Printf("Error getting current Wi-Fi network: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to get current Wi-Fi network\n")
+		WriteError(w, http.StatusInternalServerError, "failed to get current Wi-Fi network", err.Error())
 		return
 	}
 	log.Printf("Current Wi-Fi network: %s", currentNetwork)
@@ -1272,23 +1262,23 @@ func (api *ManagementAPI) ConnectToWifi(w http.ResponseWriter, r *http.Request)
 	// Decode the JSON body
 	if err := json.NewDecoder(r.Body).Decode(&wifiDetails); err != nil {
 		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 	// Get currently saved Wi-Fi networks
-	_, saved := netmanagerclient.FindNetworkBySSID(wifiDetails.SSID)
+	_, saved := api.peers.NetManager.FindNetworkBySSID(wifiDetails.SSID)
 
 	// Find network in saved networks array
 	if !saved {
 		log.Printf("Attempting to connect to Wi-Fi SSID: %s", wifiDetails.SSID)
-		if err := netmanagerclient.AddWifiNetwork(wifiDetails.SSID, wifiDetails.Password); err != nil {
+		if err := api.peers.NetManager.AddWifiNetwork(wifiDetails.SSID, wifiDetails.Password); err != nil {
 			log.Printf("Error connecting to Wi-Fi: %v", err)
-			http.Error(w, "Failed to connect to Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to connect to Wi-Fi: "+err.Error())
 			return
 		}
-		if err := netmanagerclient.EnableWifi(true); err != nil {
+		if err := api.peers.NetManager.EnableWifi(true); err != nil {
 			log.Printf("Error enabling Wi-Fi: %v", err)
-			http.Error(w, "Failed to enable Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to enable Wi-Fi: "+err.Error())
 			return
 		}
 
@@ -1296,9 +1286,9 @@ func (api *ManagementAPI) ConnectToWifi(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Connected to Wi-Fi successfully"))
 	} else {
-		if err := netmanagerclient.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
+		if err := api.peers.NetManager.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
 			log.Printf("Error connecting to Wi-Fi: %v", err)
-			http.Error(w, "Failed to connect to Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to connect to Wi-Fi: "+err.Error())
 			return
 		}
 		log.Printf("Wi-Fi network already saved: %s", wifiDetails.SSID)
@@ -1308,11 +1298,10 @@ func (api *ManagementAPI) ConnectToWifi(w http.ResponseWriter, r *http.Request)
 }
 
 func (api *ManagementAPI) DisconnectFromWifi(w http.ResponseWriter, r *http.Request) {
-	currentSSID, err := getCurrentWifiNetwork()
+	currentSSID, err := api.getCurrentWifiNetwork(r.Context())
 	if err != nil {
 		log.Printf("Error getting current Wi-Fi network: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, "failed to get current Wi-Fi network\n")
+		WriteError(w, http.StatusInternalServerError, "failed to get current Wi-Fi network", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -1321,11 +1310,9 @@ func (api *ManagementAPI) DisconnectFromWifi(w http.ResponseWriter, r *http.Requ
 		log.Fatalf("Error getting state changes: %v", err)
 	}
 	go func() {
-		if err := netmanagerclient.DisconnectWifiNetwork(currentSSID, true); err != nil {
+		if err := api.peers.NetManager.DisconnectWifiNetwork(currentSSID, true); err != nil {
+			// The response has already been sent, so this can only be logged.
 			log.Printf("Error removing Wi-Fi network: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, "failed to remove Wi-Fi network\n")
-			return
 		}
 	}()
 }
@@ -1339,21 +1326,21 @@ func (api *ManagementAPI) ForgetWifiNetwork(w http.ResponseWriter, r *http.Reque
 	// Decode the JSON body
 	if err := json.NewDecoder(r.Body).Decode(&wifiDetails); err != nil {
 		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 
 	log.Printf("Will forget Wi-Fi network: %s", wifiDetails.SSID)
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "will forget Wi-Fi network shortly\n")
-	currentSSID, err := getCurrentWifiNetwork()
+	currentSSID, err := api.getCurrentWifiNetwork(r.Context())
 	if err != nil {
 		log.Printf("Error getting current Wi-Fi network: %v", err)
 		currentSSID = ""
 	}
 	currentlyConnected := currentSSID == wifiDetails.SSID
 	go func(ssid string, connected bool) {
-		if err := netmanagerclient.RemoveWifiNetwork(ssid, connected, connected); err != nil {
+		if err := api.peers.NetManager.RemoveWifiNetwork(ssid, connected, connected); err != nil {
 			log.Printf("Error removing Wi-Fi network: %v", err)
 			return
 		}
@@ -1372,7 +1359,7 @@ func (api *ManagementAPI) GetBattery(w http.ResponseWriter, r *http.Request) {
 		parseFormErrorResponse(&w, err)
 		return
 	}
-	battery, err := getLastBatteryReading()
+	battery, err := getLastBatteryReading(api.settings.BatteryReadingsFile)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -1479,63 +1466,39 @@ func (api *ManagementAPI) ClearBatteryConfig(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(map[string]string{"status": "success", "message": "Auto-detection enabled"})
 }
 
-func getModemDbus() (dbus.BusObject, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
-	return conn.Object("org.cacophony.modemd", "/org/cacophony/modemd"), nil
-}
-
 func (api *ManagementAPI) ModemStayOnFor(w http.ResponseWriter, r *http.Request) {
-	modemDbus, err := getModemDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-
 	minutes, err := strconv.Atoi(r.FormValue("minutes"))
 	if err != nil {
 		badRequest(&w, err)
 		return
 	}
-	err = modemDbus.Call("org.cacophony.modemd.StayOnFor", 0, minutes).Store()
-	if err != nil {
+	if err := api.peers.Modemd.StayOnFor(minutes); err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request modem to stay on", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request modem to stay on", err.Error())
 		return
 	}
 }
 
 func (api *ManagementAPI) GetModem(w http.ResponseWriter, r *http.Request) {
-	// Send dbus call to modem service to get all modem statuses
-	modemDbus, err := getModemDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-
-	var status map[string]interface{}
-	err = modemDbus.Call("org.cacophony.modemd.GetStatus", 0).Store(&status)
+	// Get all modem statuses from the modem service
+	status, err := api.peers.Modemd.Status()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to get modem status", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to get modem status", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(status); err != nil {
-		http.Error(w, "Failed to encode status to JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode status to JSON")
 	}
 }
 
 func (api *ManagementAPI) GetSaltGrains(w http.ResponseWriter, r *http.Request) {
-	file, err := os.Open("/etc/salt/grains")
+	file, err := os.Open(api.settings.SaltGrainsFile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to open grains file: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to open grains file: %v", err))
 		return
 	}
 	defer file.Close()
@@ -1552,14 +1515,14 @@ func (api *ManagementAPI) GetSaltGrains(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse grains file: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to parse grains file: %v", err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(grains); err != nil {
-		http.Error(w, "Failed to encode grains to JSON", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode grains to JSON")
 	}
 }
 
@@ -1568,7 +1531,7 @@ func (api *ManagementAPI) SetSaltGrains(w http.ResponseWriter, r *http.Request)
 	// Read body as a JSON
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
 		return
 	}
 	defer r.Body.Close()
@@ -1576,7 +1539,7 @@ func (api *ManagementAPI) SetSaltGrains(w http.ResponseWriter, r *http.Request)
 	// Parse JSON body
 	var grains map[string]string
 	if err := json.Unmarshal(body, &grains); err != nil {
-		http.Error(w, "Failed to parse JSON body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to parse JSON body")
 		return
 	}
 
@@ -1586,7 +1549,7 @@ func (api *ManagementAPI) SetSaltGrains(w http.ResponseWriter, r *http.Request)
 	}
 	for key, value := range grains {
 		if approvedValues, ok := approvedKeyAndValues[key]; !ok {
-			http.Error(w, fmt.Sprintf("Key %s is not approved for setting grains", key), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Key %s is not approved for setting grains", key))
 			return
 		} else {
 			approved := false
@@ -1597,18 +1560,17 @@ func (api *ManagementAPI) SetSaltGrains(w http.ResponseWriter, r *http.Request)
 				}
 			}
 			if !approved {
-				http.Error(w, fmt.Sprintf("Value %s is not approved for key %s", value, key), http.StatusBadRequest)
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Value %s is not approved for key %s", value, key))
 				return
 			}
 		}
 
 		if !saltutil.IsSaltIdSet() {
-			http.Error(w, "Salt is not yet ready to set grains", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Salt is not yet ready to set grains")
 			return
 		}
-		cmd := exec.Command("salt-call", "grains.setval", key, value)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			http.Error(w, fmt.Sprintf("failed to set grain: %s, output: %s", err, output), http.StatusInternalServerError)
+		if output, err := api.commands.Run(r.Context(), saltCallTimeout, "salt-call", "grains.setval", key, value); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to set grain: %s, output: %s", err, output))
 			return
 		}
 	}
@@ -1620,44 +1582,21 @@ func (api *ManagementAPI) SetAPN(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := json.NewDecoder(r.Body).Decode(&apnDetails); err != nil {
 		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 	log.Printf("Received APN to set: %s", apnDetails.APN)
 
 	// Set APN using modemd dbus service
-	modemDbus, err := getModemDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	err = modemDbus.Call("org.cacophony.modemd.SetAPN", 0, apnDetails.APN).Store()
-	if err != nil {
+	if err := api.peers.Modemd.SetAPN(apnDetails.APN); err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to set APN", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to set APN", err.Error())
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func getDeviceType() string {
-	data, err := os.ReadFile("/etc/salt/minion_id")
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-
-	parts := strings.Split(string(data), "-")
-	if len(parts) < 2 {
-		log.Printf("Failed to parse '%s' device type from /etc/salt/minion_id", string(data))
-		return ""
-	}
-
-	return strings.Join(parts[:len(parts)-1], "-")
-}
-
 func (api *ManagementAPI) RestartService(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		parseFormErrorResponse(&w, err)
@@ -1668,8 +1607,7 @@ func (api *ManagementAPI) RestartService(w http.ResponseWriter, r *http.Request)
 		parseFormErrorResponse(&w, errors.New("service field was empty"))
 		return
 	}
-	_, err := exec.Command("systemctl", "restart", service).Output()
-	if err != nil {
+	if _, err := api.commands.Run(r.Context(), systemctlTimeout, "systemctl", "restart", service); err != nil {
 		serverError(&w, err)
 		return
 	}
@@ -1681,17 +1619,19 @@ type serviceStatus struct {
 	Duration int
 }
 
-func getServiceStatus(service string) (*serviceStatus, error) {
+func (api *ManagementAPI) getServiceStatus(ctx context.Context, service string) (*serviceStatus, error) {
 	status := &serviceStatus{}
-	enabledOut, _ := exec.Command("systemctl", "is-enabled", service).Output()
+	// systemctl exits with an error when the service isn't enabled or
+	// active, so only the output is checked.
+	enabledOut, _ := api.commands.Run(ctx, systemctlTimeout, "systemctl", "is-enabled", service)
 	status.Enabled = strings.TrimSpace(string(enabledOut)) == "enabled"
-	activeOut, _ := exec.Command("systemctl", "is-active", service).Output()
+	activeOut, _ := api.commands.Run(ctx, systemctlTimeout, "systemctl", "is-active", service)
 	status.Active = strings.TrimSpace(string(activeOut)) == "active"
 	if !status.Active {
 		return status, nil
 	}
 
-	pidofOut, err := exec.Command("pidof", service).Output()
+	pidofOut, err := api.commands.Run(ctx, quickCommandTimeout, "pidof", service)
 	if err != nil {
 		return nil, err
 	}
@@ -1700,7 +1640,7 @@ func getServiceStatus(service string) (*serviceStatus, error) {
 	if err != nil {
 		return nil, err
 	}
-	eTimeOut, err := exec.Command("ps", "-p", pidOfStr, "-o", "etimes").Output()
+	eTimeOut, err := api.commands.Run(ctx, quickCommandTimeout, "ps", "-p", pidOfStr, "-o", "etimes")
 	if err != nil {
 		return nil, err
 	}
@@ -1738,16 +1678,15 @@ func parseIntFromForm(field string, form url.Values) (int, error) {
 }
 
 func parseFormErrorResponse(w *http.ResponseWriter, err error) {
-	(*w).WriteHeader(http.StatusBadRequest)
-	io.WriteString((*w), fmt.Sprintf("failed to parse form: %v", err))
+	writeError(*w, http.StatusBadRequest, fmt.Sprintf("failed to parse form: %v", err))
 }
 
-func getServiceLogs(service string, lines int) ([]string, error) {
-	out, err := exec.Command(
+func (api *ManagementAPI) getServiceLogs(ctx context.Context, service string, lines int) ([]string, error) {
+	out, err := api.commands.Run(ctx, logsTimeout,
 		"/bin/journalctl",
 		"-u", service,
 		"--no-pager",
-		"-n", fmt.Sprint(lines)).Output()
+		"-n", fmt.Sprint(lines))
 	if err != nil {
 		return nil, err
 	}
@@ -1759,7 +1698,7 @@ func getServiceLogs(service string, lines int) ([]string, error) {
 }
 
 func (api *ManagementAPI) GetWifiNetworks(w http.ResponseWriter, r *http.Request) {
-	networks, err := netmanagerclient.ListUserSavedWifiNetworks()
+	networks, err := api.peers.NetManager.SavedWifiNetworks()
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -1779,7 +1718,7 @@ func (api *ManagementAPI) PostWifiNetwork(w http.ResponseWriter, r *http.Request
 		badRequest(&w, errors.New("psk field was empty"))
 		return
 	}
-	if err := netmanagerclient.AddWifiNetwork(ssid, psk); err != nil {
+	if err := api.peers.NetManager.AddWifiNetwork(ssid, psk); err != nil {
 		if _, ok := err.(netmanagerclient.InputError); ok {
 			badRequest(&w, err)
 			return
@@ -1796,7 +1735,7 @@ func (api *ManagementAPI) DeleteWifiNetwork(w http.ResponseWriter, r *http.Reque
 		badRequest(&w, errors.New("ssid field was empty"))
 		return
 	}
-	if err := netmanagerclient.RemoveWifiNetwork(ssid, false, false); err != nil {
+	if err := api.peers.NetManager.RemoveWifiNetwork(ssid, false, false); err != nil {
 		if _, ok := err.(netmanagerclient.InputError); ok {
 			badRequest(&w, err)
 			return
@@ -1808,7 +1747,7 @@ func (api *ManagementAPI) DeleteWifiNetwork(w http.ResponseWriter, r *http.Reque
 }
 
 func (api *ManagementAPI) ScanWifiNetwork(w http.ResponseWriter, r *http.Request) {
-	networks, err := netmanagerclient.ScanWiFiNetworks()
+	networks, err := api.peers.NetManager.ScanWifiNetworks()
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -1818,7 +1757,7 @@ func (api *ManagementAPI) ScanWifiNetwork(w http.ResponseWriter, r *http.Request
 }
 
 func (api *ManagementAPI) EnableWifi(w http.ResponseWriter, r *http.Request) {
-	if err := netmanagerclient.EnableWifi(false); err != nil {
+	if err := api.peers.NetManager.EnableWifi(false); err != nil {
 		serverError(&w, err)
 		return
 	}
@@ -1829,7 +1768,7 @@ func (api *ManagementAPI) EnableHotspot(w http.ResponseWriter, r *http.Request)
 	go func() {
 		// TODO Wait before enabling hotspot to give time for response
 		time.Sleep(time.Second)
-		if err := netmanagerclient.EnableHotspot(true); err != nil {
+		if err := api.peers.NetManager.EnableHotspot(true); err != nil {
 			log.Println(err)
 		}
 	}()
@@ -1837,21 +1776,19 @@ func (api *ManagementAPI) EnableHotspot(w http.ResponseWriter, r *http.Request)
 }
 
 func (api *ManagementAPI) GetHotspotInterface(w http.ResponseWriter, r *http.Request) {
-	available, err := netmanagerclient.GetHotspotInterfaces()
+	available, err := api.peers.NetManager.HotspotInterfaces()
 	if err != nil {
 		if errors.Is(err, netmanagerclient.ErrHotspotInterfaceUnsupported) {
-			w.WriteHeader(http.StatusNotImplemented)
-			io.WriteString(w, "hotspot interface selection not supported by current net manager\n")
+			writeError(w, http.StatusNotImplemented, "hotspot interface selection not supported by current net manager")
 			return
 		}
 		serverError(&w, err)
 		return
 	}
-	selected, err := netmanagerclient.GetHotspotInterface()
+	selected, err := api.peers.NetManager.HotspotInterface()
 	if err != nil {
 		if errors.Is(err, netmanagerclient.ErrHotspotInterfaceUnsupported) {
-			w.WriteHeader(http.StatusNotImplemented)
-			io.WriteString(w, "hotspot interface selection not supported by current net manager\n")
+			writeError(w, http.StatusNotImplemented, "hotspot interface selection not supported by current net manager")
 			return
 		}
 		serverError(&w, err)
@@ -1879,12 +1816,11 @@ func (api *ManagementAPI) SetHotspotInterface(w http.ResponseWriter, r *http.Req
 		target = ""
 	}
 
-	if err := netmanagerclient.SetHotspotInterface(target); err != nil {
+	if err := api.peers.NetManager.SetHotspotInterface(target); err != nil {
 		var dbusErr *dbus.Error
 		switch {
 		case errors.Is(err, netmanagerclient.ErrHotspotInterfaceUnsupported):
-			w.WriteHeader(http.StatusNotImplemented)
-			io.WriteString(w, "hotspot interface selection not supported by current net manager\n")
+			writeError(w, http.StatusNotImplemented, "hotspot interface selection not supported by current net manager")
 			return
 		case errors.As(err, &dbusErr):
 			msg := err.Error()
@@ -1903,7 +1839,7 @@ func (api *ManagementAPI) SetHotspotInterface(w http.ResponseWriter, r *http.Req
 }
 
 func (api *ManagementAPI) GetConnectionStatus(w http.ResponseWriter, r *http.Request) {
-	state, err := netmanagerclient.ReadState()
+	state, err := api.peers.NetManager.State()
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -1925,24 +1861,24 @@ func (api *ManagementAPI) SaveWifiNetwork(w http.ResponseWriter, r *http.Request
 	// Decode the JSON body
 	if err := json.NewDecoder(r.Body).Decode(&wifiDetails); err != nil {
 		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
 
 	// Get currently saved Wi-Fi networks
-	_, saved := netmanagerclient.FindNetworkBySSID(wifiDetails.SSID)
+	_, saved := api.peers.NetManager.FindNetworkBySSID(wifiDetails.SSID)
 
 	if !saved {
 		log.Printf("Attempting to connect to Wi-Fi SSID: %s", wifiDetails.SSID)
-		if err := netmanagerclient.AddWifiNetwork(wifiDetails.SSID, wifiDetails.Password); err != nil {
+		if err := api.peers.NetManager.AddWifiNetwork(wifiDetails.SSID, wifiDetails.Password); err != nil {
 			log.Printf("Error connecting to Wi-Fi: %v", err)
-			http.Error(w, "Failed to connect to Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to connect to Wi-Fi: "+err.Error())
 			return
 		}
-		scanWifis, err := netmanagerclient.ScanWiFiNetworks()
+		scanWifis, err := api.peers.NetManager.ScanWifiNetworks()
 		if err != nil {
 			log.Printf("Error scanning Wi-Fi networks: %v", err)
-			http.Error(w, "Failed to scan Wi-Fi networks: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to scan Wi-Fi networks: "+err.Error())
 			return
 		}
 
@@ -1955,9 +1891,9 @@ func (api *ManagementAPI) SaveWifiNetwork(w http.ResponseWriter, r *http.Request
 		}
 
 		if found {
-			if err := netmanagerclient.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
+			if err := api.peers.NetManager.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
 				log.Printf("Error connecting to Wi-Fi: %v", err)
-				http.Error(w, "Failed to connect to Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "Failed to connect to Wi-Fi: "+err.Error())
 				return
 			}
 		}
@@ -1966,9 +1902,9 @@ func (api *ManagementAPI) SaveWifiNetwork(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Connected to Wi-Fi successfully"))
 	} else {
-		if err := netmanagerclient.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
+		if err := api.peers.NetManager.ConnectWifiNetwork(wifiDetails.SSID); err != nil {
 			log.Printf("Error connecting to Wi-Fi: %v", err)
-			http.Error(w, "Failed to connect to Wi-Fi: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to connect to Wi-Fi: "+err.Error())
 			return
 		}
 
@@ -1979,7 +1915,7 @@ func (api *ManagementAPI) SaveWifiNetwork(w http.ResponseWriter, r *http.Request
 }
 
 func (api *ManagementAPI) GetSavedWifiNetworks(w http.ResponseWriter, r *http.Request) {
-	networks, err := netmanagerclient.ListUserSavedWifiNetworks()
+	networks, err := api.peers.NetManager.SavedWifiNetworks()
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -1993,7 +1929,7 @@ func (api *ManagementAPI) DownloadAudioFile(w http.ResponseWriter, r *http.Reque
 	// Get the file name from the request
 	fileName := mux.Vars(r)["fileName"]
 	if fileName == "" {
-		http.Error(w, "Failed to get file name from request", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to get file name from request")
 		return
 	}
 
@@ -2006,7 +1942,7 @@ func (api *ManagementAPI) DownloadAudioFile(w http.ResponseWriter, r *http.Reque
 	aacFile, err := os.Open(aacFilePath)
 	if err != nil {
 		log.Printf("Error opening converted M4A file: %v", err)
-		http.Error(w, "Failed to open converted audio file", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to open converted audio file", err.Error())
 		return
 	}
 	defer aacFile.Close()
@@ -2018,7 +1954,7 @@ func (api *ManagementAPI) DownloadAudioFile(w http.ResponseWriter, r *http.Reque
 	// Send the file as a response
 	if _, err := io.Copy(w, aacFile); err != nil {
 		log.Printf("Error sending M4A file: %v", err)
-		http.Error(w, "Failed to send audio file", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to send audio file", err.Error())
 		return
 	}
 }
@@ -2032,8 +1968,6 @@ func (api *ManagementAPI) GetAudioRecordings(w http.ResponseWriter, r *http.Requ
 
 func (api *ManagementAPI) UploadLogs(w http.ResponseWriter, r *http.Request) {
 	twoWeeksAgo := time.Now().AddDate(0, 0, -14).Format("2006-01-02")
-	journalctlCmd := exec.Command("journalctl", "--since", twoWeeksAgo)
-
 	logFileName := "/tmp/journalctl-logs-last-2-weeks.log"
 	logFile, err := os.Create(logFileName)
 	if err != nil {
@@ -2043,25 +1977,23 @@ func (api *ManagementAPI) UploadLogs(w http.ResponseWriter, r *http.Request) {
 	}
 	defer logFile.Close()
 
-	journalctlCmd.Stdout = logFile
-
-	if err := journalctlCmd.Run(); err != nil {
+	if err := api.commands.Stream(r.Context(), logsTimeout, logFile, "journalctl", "--since", twoWeeksAgo); err != nil {
 		log.Printf("Failed to run journalctl command: %v", err)
 		serverError(&w, err)
 		return
 	}
 
-	if err := exec.Command("gzip", "-f", logFileName).Run(); err != nil {
+	if _, err := api.commands.Run(r.Context(), logsTimeout, "gzip", "-f", logFileName); err != nil {
 		log.Printf("Failed to compress log file: %v", err)
 		serverError(&w, err)
 		return
 	}
 
 	if !saltutil.IsSaltIdSet() {
-		http.Error(w, "Salt is not yet ready to upload logs", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Salt is not yet ready to upload logs")
 		return
 	}
-	if err := exec.Command("salt-call", "cp.push", logFileName+".gz").Run(); err != nil {
+	if _, err := api.commands.Run(r.Context(), saltCallTimeout, "salt-call", "cp.push", logFileName+".gz"); err != nil {
 		log.Printf("Error pushing log file with salt: %v", err)
 		serverError(&w, err)
 		return
@@ -2069,11 +2001,3 @@ func (api *ManagementAPI) UploadLogs(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
-
-func GetTC2AgentDbus() (dbus.BusObject, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
-	return conn.Object("org.cacophony.TC2Agent", "/org/cacophony/TC2Agent"), nil
-}
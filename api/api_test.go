@@ -0,0 +1,736 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/event-reporter/v3/eventclient"
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/command"
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/TheCacophonyProject/management-interface/settings"
+	"github.com/gorilla/mux"
+)
+
+func newTestAPI(t *testing.T) (*ManagementAPI, *peers.Fakes) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, goconfig.ConfigFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := goconfig.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The files the API reads are kept in the test directory.
+	s := settings.Default()
+	s.TestRecordingsDir = filepath.Join(dir, "test-recordings")
+	s.BatteryReadingsFile = filepath.Join(dir, "battery-readings.csv")
+	s.SaltGrainsFile = filepath.Join(dir, "grains")
+	// The fakes are the services of a TC2.
+	profile, err := device.ForType("tc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakes := peers.NewFakes()
+	api, err := NewAPI(mux.NewRouter(), config, s, profile, fakes.Peers(), command.NewFake(), "test", logging.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, fakes
+}
+
+// fakeCommands returns the fake that runs the commands of an API from newTestAPI.
+func fakeCommands(api *ManagementAPI) *command.Fake {
+	return api.commands.(*command.Fake)
+}
+
+// call makes a request to a handler. A url.Values body is sent as a form.
+func call(h http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var r *http.Request
+	switch b := body.(type) {
+	case nil:
+		r = httptest.NewRequest(method, target, nil)
+	case url.Values:
+		r = httptest.NewRequest(method, target, strings.NewReader(b.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		data, _ := json.Marshal(b)
+		r = httptest.NewRequest(method, target, strings.NewReader(string(data)))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	RequestID(h).ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+func checkStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d, body %q", w.Code, status, w.Body.String())
+	}
+}
+
+// checkError checks the response is an error envelope with the request ID.
+func checkError(t *testing.T, w *httptest.ResponseRecorder, status int) ErrorResponse {
+	t.Helper()
+	checkStatus(t, w, status)
+	var resp ErrorResponse
+	decode(t, w, &resp)
+	if resp.Code != errorCode(status) || resp.Message == "" {
+		t.Errorf("unexpected error response %+v", resp)
+	}
+	if resp.RequestID == "" || resp.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("request ID %q doesn't match header %q", resp.RequestID, w.Header().Get(RequestIDHeader))
+	}
+	return resp
+}
+
+func checkCalls(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %q, want %q", got, want)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	api, _ := newTestAPI(t)
+	w := call(api.GetVersion, "GET", "/api/version", nil)
+	checkStatus(t, w, http.StatusOK)
+	var resp struct {
+		APIVersion int    `json:"apiVersion"`
+		AppVersion string `json:"appVersion"`
+	}
+	decode(t, w, &resp)
+	if resp.APIVersion != LatestVersion || resp.AppVersion != "test" {
+		t.Errorf("unexpected version %+v", resp)
+	}
+}
+
+func TestRP2040Status(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.TC2Agent.Audio = peers.RP2040Status{Mode: 1, Status: 2}
+	fakes.TC2Agent.Thermal = peers.RP2040Status{Mode: 3, Status: 4}
+
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		want    map[string]int
+	}{
+		{api.AudioRecordingStatus, map[string]int{"mode": 1, "status": 2}},
+		{api.TestThermalRecordingStatus, map[string]int{"mode": 3, "status": 4}},
+	} {
+		w := call(tc.handler, "GET", "/", nil)
+		checkStatus(t, w, http.StatusOK)
+		var got map[string]int
+		decode(t, w, &got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("got %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestTC2AgentRecordings(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.TC2Agent.Result = "recording started"
+
+	checkError(t, call(api.TakeLongAudioRecording, "PUT", "/api/audio/long-recording?seconds=soon", nil), http.StatusBadRequest)
+	checkError(t, call(api.TakeLongTestThermalRecording, "PUT", "/api/thermal/long-test-recording", nil), http.StatusBadRequest)
+	checkCalls(t, fakes.TC2Agent.Calls())
+
+	for _, tc := range []struct {
+		handler http.HandlerFunc
+		target  string
+	}{
+		{api.TakeLongAudioRecording, "/api/audio/long-recording?seconds=300"},
+		{api.TakeTestAudioRecording, "/api/audio/test-recording"},
+		{api.TakeLongTestThermalRecording, "/api/thermal/long-test-recording?seconds=60"},
+		{api.TakeShortTestThermalRecording, "/api/thermal/short-test-recording"},
+	} {
+		w := call(tc.handler, "PUT", tc.target, nil)
+		checkStatus(t, w, http.StatusOK)
+		var result string
+		decode(t, w, &result)
+		if result != "recording started" {
+			t.Errorf("%s: got result %q", tc.target, result)
+		}
+	}
+	checkCalls(t, fakes.TC2Agent.Calls(),
+		"LongAudioRecording(300)", "TestAudioRecording()", "LongThermalRecording(60)", "ShortThermalRecording()")
+}
+
+func TestTC2AgentError(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.TC2Agent.Fail(errors.New("tc2-agent is not running"))
+	for _, h := range []http.HandlerFunc{
+		api.AudioRecordingStatus, api.TakeTestAudioRecording, api.RecordingOffloadStatus,
+		api.CancelOffload, api.ForceRp2040Offload, api.PrioritiseFrameServe,
+	} {
+		resp := checkError(t, call(h, "PUT", "/", nil), http.StatusInternalServerError)
+		if resp.Details != "tc2-agent is not running" {
+			t.Errorf("got details %v", resp.Details)
+		}
+	}
+}
+
+func TestRecordingOffloadStatus(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.TC2Agent.Offload = peers.OffloadStatus{FilesTotal: 10, FilesRemaining: 4, PercentComplete: 60}
+
+	w := call(api.RecordingOffloadStatus, "GET", "/api/offload-status", nil)
+	checkStatus(t, w, http.StatusOK)
+	var got map[string]interface{}
+	decode(t, w, &got)
+	if got["offload-in-progress"] != false || got["files-remaining"] != 4.0 {
+		t.Errorf("unexpected status %v", got)
+	}
+	if _, ok := got["percent-complete"]; ok {
+		t.Error("percent-complete given when an offload isn't in progress")
+	}
+
+	checkStatus(t, call(api.ForceRp2040Offload, "PUT", "/api/offload-now", nil), http.StatusOK)
+	w = call(api.RecordingOffloadStatus, "GET", "/api/offload-status", nil)
+	got = nil
+	decode(t, w, &got)
+	if got["offload-in-progress"] != true || got["percent-complete"] != 60.0 {
+		t.Errorf("unexpected status %v", got)
+	}
+
+	checkStatus(t, call(api.CancelOffload, "PUT", "/api/cancel-offload", nil), http.StatusOK)
+	if fakes.TC2Agent.Offload.InProgress {
+		t.Error("offload wasn't cancelled")
+	}
+}
+
+func TestThermalRecorder(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	checkStatus(t, call(api.TakeSnapshot, "PUT", "/api/camera/snapshot", nil), http.StatusOK)
+	checkStatus(t, call(api.TakeSnapshotRecording, "PUT", "/api/camera/snapshot-recording", nil), http.StatusOK)
+	if fakes.ThermalRecorder.Snapshots != 1 || fakes.ThermalRecorder.TestRecordings != 1 {
+		t.Errorf("got %d snapshots and %d test recordings", fakes.ThermalRecorder.Snapshots, fakes.ThermalRecorder.TestRecordings)
+	}
+
+	fakes.ThermalRecorder.Fail(errors.New("no camera"))
+	resp := checkError(t, call(api.TakeSnapshot, "PUT", "/api/camera/snapshot", nil), http.StatusInternalServerError)
+	if !strings.Contains(resp.Message, "no camera") {
+		t.Errorf("got message %q", resp.Message)
+	}
+}
+
+func TestModem(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.Modemd.Values = map[string]interface{}{"powered": true, "signal": 21.0}
+
+	w := call(api.GetModem, "GET", "/api/modem", nil)
+	checkStatus(t, w, http.StatusOK)
+	var status map[string]interface{}
+	decode(t, w, &status)
+	if !reflect.DeepEqual(status, fakes.Modemd.Values) {
+		t.Errorf("got status %v", status)
+	}
+
+	checkError(t, call(api.ModemStayOnFor, "POST", "/api/modem-stay-on-for", url.Values{"minutes": {"ages"}}), http.StatusBadRequest)
+	checkStatus(t, call(api.ModemStayOnFor, "POST", "/api/modem-stay-on-for", url.Values{"minutes": {"20"}}), http.StatusOK)
+	checkError(t, call(api.SetAPN, "POST", "/api/modem/apn", "not an object"), http.StatusBadRequest)
+	checkStatus(t, call(api.SetAPN, "POST", "/api/modem/apn", map[string]string{"apn": "internet"}), http.StatusOK)
+	if fakes.Modemd.StayOnForMin != 20 || fakes.Modemd.APN != "internet" {
+		t.Errorf("got stay on for %d, APN %q", fakes.Modemd.StayOnForMin, fakes.Modemd.APN)
+	}
+
+	fakes.Modemd.Fail(errors.New("modemd is not running"))
+	checkError(t, call(api.GetModem, "GET", "/api/modem", nil), http.StatusInternalServerError)
+}
+
+func TestPostClockTC2(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	checkError(t, call(api.PostClockTC2, "POST", "/api/clock", url.Values{"date": {"yesterday"}}), http.StatusBadRequest)
+
+	date := time.Now().Add(-time.Hour).Truncate(time.Second)
+	w := call(api.PostClockTC2, "POST", "/api/clock", url.Values{"date": {date.Format(timeFormat)}})
+	checkStatus(t, w, http.StatusOK)
+	rtcTime, integrity, _ := fakes.RTC.Time()
+	if !integrity || rtcTime.Sub(date) > time.Minute || rtcTime.Before(date) {
+		t.Errorf("RTC set to %v, want %v", rtcTime, date)
+	}
+}
+
+func TestDeviceProfile(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	commands := fakeCommands(api)
+	commands.Set("date "+dateCmdFormat, command.Result{Stdout: time.Now().Format(timeFormat) + "\n"})
+	commands.Set("timedatectl status", command.Result{Stdout: "System clock synchronized: yes\n"})
+	var clock clockInfo
+	decode(t, call(api.GetClock, "GET", "/api/clock", nil), &clock)
+	if rtcTime, _, _ := fakes.RTC.Time(); clock.RTCTimeUTC != rtcTime.UTC().Format(timeFormat) {
+		t.Errorf("got RTC time %s on a TC2, want the time from the RTC service", clock.RTCTimeUTC)
+	}
+	var info struct {
+		Type         string
+		Capabilities []device.Capability
+	}
+	decode(t, call(api.GetDeviceInfo, "GET", "/api/device-info", nil), &info)
+	if info.Type != "tc2" || len(info.Capabilities) != 5 {
+		t.Errorf("got device info %+v", info)
+	}
+
+	api.profile, _ = device.ForType("pi")
+	audio := api.Requires(device.Audio, api.GetAudioRecording)
+	resp := checkError(t, call(audio, "GET", "/api/audiorecording", nil), http.StatusNotImplemented)
+	if resp.Message != "pi devices don't have audio" {
+		t.Errorf("got %+v", resp)
+	}
+	checkStatus(t, call(api.Requires(device.ThermalCamera, api.GetRecordings), "GET", "/api/recordings", nil), http.StatusOK)
+	if health := api.checkIf(device.RP2040, api.checkOffload)(context.Background()); health.Status != HealthAbsent {
+		t.Errorf("got offload %+v on a pi, want absent", health)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.Events.Events[7] = &eventclient.Event{Type: "audioBait"}
+	fakes.Events.Events[3] = &eventclient.Event{Type: "rpi-power-on"}
+
+	w := call(api.GetEventKeys, "GET", "/api/event-keys", nil)
+	checkStatus(t, w, http.StatusOK)
+	var keys []uint64
+	decode(t, w, &keys)
+	if !reflect.DeepEqual(keys, []uint64{3, 7}) {
+		t.Errorf("got keys %v", keys)
+	}
+
+	checkError(t, call(api.GetEvents, "GET", "/api/events?keys=3", nil), http.StatusBadRequest)
+	w = call(api.GetEvents, "GET", "/api/events?keys=[3,4]", nil)
+	checkStatus(t, w, http.StatusOK)
+	var events map[string]struct {
+		Success bool
+		Event   *eventclient.Event
+	}
+	decode(t, w, &events)
+	if !events["3"].Success || events["3"].Event.Type != "rpi-power-on" || events["4"].Success {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	checkStatus(t, call(api.DeleteEvents, "DELETE", "/api/events?keys=[7]", nil), http.StatusOK)
+	if _, ok := fakes.Events.Events[7]; ok || len(fakes.Events.Events) != 1 {
+		t.Errorf("event 7 wasn't deleted: %v", fakes.Events.Events)
+	}
+}
+
+func TestTriggerTrap(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	checkStatus(t, call(api.TriggerTrap, "PUT", "/api/trigger-trap", nil), http.StatusOK)
+	checkCalls(t, fakes.Trap.Calls(), "TriggerTrap(map[test:true])")
+}
+
+func TestSaltUpdate(t *testing.T) {
+	api, fakes := newTestAPI(t)
+
+	w := call(api.StartSaltUpdate, "POST", "/api/salt-update", map[string]bool{"force": false})
+	checkStatus(t, w, http.StatusOK)
+	if w.Body.String() != "salt update started" {
+		t.Errorf("got %q", w.Body.String())
+	}
+	w = call(api.StartSaltUpdate, "POST", "/api/salt-update", map[string]bool{"force": true})
+	if w.Body.String() != "already running salt update" {
+		t.Errorf("got %q", w.Body.String())
+	}
+	checkCalls(t, fakes.Salt.Calls(), "State()", "RunUpdate()", "State()")
+
+	fakes.Salt.SaltState.RunningUpdate = false
+	w = call(api.StartSaltUpdate, "POST", "/api/salt-update", map[string]bool{"force": true})
+	if w.Body.String() != "force salt update started" {
+		t.Errorf("got %q", w.Body.String())
+	}
+
+	w = call(api.GetSaltUpdateState, "GET", "/api/salt-update", nil)
+	checkStatus(t, w, http.StatusOK)
+	var state struct{ RunningUpdate bool }
+	decode(t, w, &state)
+	if !state.RunningUpdate {
+		t.Error("update isn't running")
+	}
+
+	fakes.Salt.Fail(errors.New("salt-updater is not running"))
+	checkError(t, call(api.CheckSaltConnection, "GET", "/api/check-salt-connection", nil), http.StatusInternalServerError)
+}
+
+func TestSaltAutoUpdate(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	checkError(t, call(api.PostSaltAutoUpdate, "POST", "/api/auto-update", url.Values{"autoUpdate": {"maybe"}}), http.StatusBadRequest)
+	checkStatus(t, call(api.PostSaltAutoUpdate, "POST", "/api/auto-update", url.Values{"autoUpdate": {"TRUE"}}), http.StatusOK)
+
+	w := call(api.GetSaltAutoUpdate, "GET", "/api/auto-update", nil)
+	var resp struct{ AutoUpdate bool }
+	decode(t, w, &resp)
+	if !resp.AutoUpdate || !fakes.Salt.AutoUpdate {
+		t.Error("auto update wasn't turned on")
+	}
+}
+
+func TestWifiNetworks(t *testing.T) {
+	api, fakes := newTestAPI(t)
+
+	checkError(t, call(api.PostWifiNetwork, "POST", "/api/wifi-networks", url.Values{"ssid": {"farmhouse"}}), http.StatusBadRequest)
+	// The net manager rejects the short password.
+	checkError(t, call(api.PostWifiNetwork, "POST", "/api/wifi-networks", url.Values{"ssid": {"farmhouse"}, "psk": {"short"}}), http.StatusBadRequest)
+	checkStatus(t, call(api.PostWifiNetwork, "POST", "/api/wifi-networks", url.Values{"ssid": {"farmhouse"}, "psk": {"long enough"}}), http.StatusOK)
+
+	w := call(api.GetWifiNetworks, "GET", "/api/wifi-networks", nil)
+	checkStatus(t, w, http.StatusOK)
+	var networks []struct{ SSID string }
+	decode(t, w, &networks)
+	if len(networks) != 2 || networks[1].SSID != "farmhouse" {
+		t.Errorf("got networks %+v", networks)
+	}
+
+	checkError(t, call(api.DeleteWifiNetwork, "DELETE", "/api/wifi-networks?ssid=unknown", nil), http.StatusBadRequest)
+	checkStatus(t, call(api.DeleteWifiNetwork, "DELETE", "/api/wifi-networks?ssid=farmhouse", nil), http.StatusOK)
+	if len(fakes.NetManager.Saved) != 1 {
+		t.Errorf("network wasn't removed: %+v", fakes.NetManager.Saved)
+	}
+
+	fakes.NetManager.Fail(errors.New("net manager is not running"))
+	checkError(t, call(api.ScanWifiNetwork, "GET", "/api/network/wifi", nil), http.StatusInternalServerError)
+}
+
+func TestHotspotInterface(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.NetManager.Interfaces = []string{"wlan0", "wlan1"}
+
+	checkStatus(t, call(api.SetHotspotInterface, "POST", "/api/network/hotspot", map[string]string{"interface": "wlan1"}), http.StatusOK)
+	w := call(api.GetHotspotInterface, "GET", "/api/network/hotspot", nil)
+	checkStatus(t, w, http.StatusOK)
+	var resp struct {
+		Available []string
+		Selected  string
+	}
+	decode(t, w, &resp)
+	if resp.Selected != "wlan1" || len(resp.Available) != 2 {
+		t.Errorf("got %+v", resp)
+	}
+
+	fakes.NetManager.Interfaces = nil
+	checkError(t, call(api.GetHotspotInterface, "GET", "/api/network/hotspot", nil), http.StatusNotImplemented)
+	checkError(t, call(api.SetHotspotInterface, "POST", "/api/network/hotspot", map[string]string{"interface": "auto"}), http.StatusNotImplemented)
+}
+
+func TestAudiobait(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	checkError(t, call(api.PlayTestSound, "POST", "/api/play-test-sound", url.Values{"volume": {"loud"}}), http.StatusBadRequest)
+	checkStatus(t, call(api.PlayTestSound, "POST", "/api/play-test-sound", url.Values{"volume": {"5"}}), http.StatusOK)
+	checkError(t, call(api.PlayAudiobaitSound, "POST", "/api/play-audiobait-sound", url.Values{"fileId": {"2"}}), http.StatusBadRequest)
+	checkStatus(t, call(api.PlayAudiobaitSound, "POST", "/api/play-audiobait-sound", url.Values{"fileId": {"2"}, "volume": {"7"}}), http.StatusOK)
+	checkCalls(t, fakes.Audiobait.Calls(), "PlayTestSound(5)", "PlayFromID(2, 7, 99)")
+}
+
+// callVersion makes a request to a handler served at route under the prefix
+// of a version of the API.
+func callVersion(version int, route string, h http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	sub := router.PathPrefix(VersionPrefix(version)).Subrouter()
+	sub.Use(RequestID, Version(version, false))
+	sub.HandleFunc(route, h)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestVersion9(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	fakes.Modemd.Fail(errors.New("modemd is not running"))
+	badCredentials := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="managementd"`)
+		WriteError(w, http.StatusUnauthorized, "invalid username or password", nil)
+	}
+	missingRole := func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusForbidden, "needs the admin role", map[string]string{"missingPermission": "admin"})
+	}
+
+	tests := []struct {
+		name        string
+		route       string
+		handler     http.HandlerFunc
+		status      int
+		contentType string
+		body        string
+	}{
+		{"plain text error", "/modem", api.GetModem, http.StatusInternalServerError, "text/plain", "Failed to get modem status\n"},
+		{"bad credentials", "/reboot", badCredentials, http.StatusForbidden, "text/plain", "invalid username or password\n"},
+		{"missing role", "/reboot", missingRole, http.StatusForbidden, "application/json", `{"message":"needs the admin role","missingPermission":"admin"}` + "\n"},
+		{"route added since v9", "/health", badCredentials, http.StatusUnauthorized, "application/json", ""},
+		{"version", "/version", api.GetVersion, http.StatusOK, "", `{"apiVersion":9,"appVersion":"test"}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := callVersion(9, test.route, test.handler, httptest.NewRequest("GET", "/api/v9"+test.route, nil))
+			checkStatus(t, w, test.status)
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+				t.Errorf("got Content-Type %q, want %s", w.Header().Get("Content-Type"), test.contentType)
+			}
+			if test.body == "" {
+				checkError(t, w, test.status)
+			} else if w.Body.String() != test.body {
+				t.Errorf("got %q, want %q", w.Body.String(), test.body)
+			}
+			if test.status == http.StatusForbidden && w.Header().Get("WWW-Authenticate") != "" {
+				t.Error("v9 was sent a WWW-Authenticate header")
+			}
+			if w.Header().Get("Deprecation") == "" {
+				t.Error("missing Deprecation header")
+			}
+		})
+	}
+
+	// The capabilities of the device were added in v10.
+	for version, want := range map[int]bool{9: false, LatestVersion: true} {
+		w := callVersion(version, "/device-info", api.GetDeviceInfo, httptest.NewRequest("GET", VersionPrefix(version)+"/device-info", nil))
+		checkStatus(t, w, http.StatusOK)
+		var info map[string]interface{}
+		decode(t, w, &info)
+		if _, ok := info["capabilities"]; ok != want || info["type"] != "tc2" {
+			t.Errorf("got v%d device info %v", version, info)
+		}
+	}
+}
+
+func TestV9RoutesAreInOpenAPISpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	for route := range v9Routes {
+		if _, ok := spec.Paths[route]; !ok {
+			t.Errorf("v9 route %s isn't in the spec", route)
+		}
+	}
+}
+
+func TestGetServiceStatus(t *testing.T) {
+	api, _ := newTestAPI(t)
+	commands := fakeCommands(api)
+	commands.Set("systemctl is-enabled tc2-agent", command.Result{Stdout: "enabled\n"})
+	commands.Set("systemctl is-active tc2-agent", command.Result{Stdout: "active\n"})
+	commands.Set("pidof tc2-agent", command.Result{Stdout: "812\n"})
+	commands.Set("ps -p 812 -o etimes", command.Result{Stdout: "ELAPSED\n   3600\n"})
+	commands.Set("systemctl is-enabled modemd", command.Result{Stdout: "disabled\n", ExitCode: 1})
+	commands.Set("systemctl is-active modemd", command.Result{Stdout: "inactive\n", ExitCode: 3})
+
+	for _, test := range []struct {
+		service string
+		want    serviceStatus
+	}{
+		{"tc2-agent", serviceStatus{Enabled: true, Active: true, Duration: 3600}},
+		{"modemd", serviceStatus{}},
+	} {
+		w := call(api.GetServiceStatus, "GET", "/api/service?service="+test.service, nil)
+		checkStatus(t, w, http.StatusOK)
+		var got serviceStatus
+		decode(t, w, &got)
+		if got != test.want {
+			t.Errorf("got %+v for %s, want %+v", got, test.service, test.want)
+		}
+	}
+	checkCalls(t, commands.Calls(),
+		"systemctl is-enabled tc2-agent", "systemctl is-active tc2-agent", "pidof tc2-agent", "ps -p 812 -o etimes",
+		"systemctl is-enabled modemd", "systemctl is-active modemd")
+
+	commands.Set("pidof tc2-agent", command.Result{ExitCode: 1})
+	checkError(t, call(api.GetServiceStatus, "GET", "/api/service?service=tc2-agent", nil), http.StatusInternalServerError)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	api, _ := newTestAPI(t)
+	fakeCommands(api).Set("systemctl restart tc2-agent", command.Result{Stderr: "still stopping", TimedOut: true})
+	w := call(api.RestartService, "POST", "/api/service-restart", url.Values{"service": {"tc2-agent"}})
+	resp := checkError(t, w, http.StatusInternalServerError)
+	if !strings.Contains(resp.Message, "timed out") || !strings.Contains(resp.Message, "still stopping") {
+		t.Errorf("unexpected message %q", resp.Message)
+	}
+}
+
+func TestCheckInternetConnection(t *testing.T) {
+	api, _ := newTestAPI(t)
+	commands := fakeCommands(api)
+	ping := "ping -I lo -c 3 -n -W 15 1.1.1.1"
+	ctx := context.Background()
+
+	commands.Set(ping, command.Result{Stdout: "3 packets transmitted, 3 received"})
+	if !api.CheckInternetConnection(ctx, "lo") {
+		t.Error("connection is down when ping succeeded")
+	}
+	commands.Set(ping, command.Result{Stdout: "3 packets transmitted, 0 received", ExitCode: 1})
+	if api.CheckInternetConnection(ctx, "lo") {
+		t.Error("connection is up when ping failed")
+	}
+	if api.CheckInternetConnection(ctx, "not-an-interface") {
+		t.Error("connection is up for a missing interface")
+	}
+	checkCalls(t, commands.Calls(), ping, ping)
+}
+
+func TestGetCurrentWifiNetwork(t *testing.T) {
+	api, _ := newTestAPI(t)
+	commands := fakeCommands(api)
+	commands.Set("nmcli -t -f DEVICE,TYPE,STATE device status", command.Result{
+		Stdout: "usb0:ethernet:connected\nwlan0:wifi:connected\nlo:loopback:unmanaged\n",
+	})
+	commands.Script("iwgetid", func(args []string) command.Result {
+		if args[0] != "wlan0" {
+			return command.Result{ExitCode: 255}
+		}
+		return command.Result{Stdout: "bushnet\n"}
+	})
+
+	w := call(api.GetCurrentWifiNetwork, "GET", "/api/network/wifi/current", nil)
+	checkStatus(t, w, http.StatusOK)
+	var resp map[string]string
+	decode(t, w, &resp)
+	if resp["SSID"] != "bushnet" {
+		t.Errorf("got %v", resp)
+	}
+}
+
+func TestGetHealth(t *testing.T) {
+	api, fakes := newTestAPI(t)
+	commands := fakeCommands(api)
+	commands.Set("systemctl is-enabled tc2-agent", command.Result{Stdout: "enabled\n"})
+	commands.Set("systemctl is-active tc2-agent", command.Result{Stdout: "active\n"})
+	commands.Set("pidof tc2-agent", command.Result{Stdout: "812\n"})
+	commands.Set("ps -p 812 -o etimes", command.Result{Stdout: "ELAPSED\n   3600\n"})
+	commands.Set("timedatectl status", command.Result{Stdout: "System clock synchronized: yes\n"})
+	fakes.Modemd.Fail(peers.ErrAbsent)
+
+	get := func() Health {
+		t.Helper()
+		w := call(api.GetHealth, "GET", "/api/health", nil)
+		checkStatus(t, w, http.StatusOK)
+		var health Health
+		decode(t, w, &health)
+		return health
+	}
+	health := get()
+	for name, want := range map[string]string{
+		"clock":                    HealthOK,
+		"modem":                    HealthAbsent,
+		"offload":                  HealthOK,
+		"wifi":                     HealthOK,
+		"service:tc2-agent":        HealthOK,
+		"service:thermal-recorder": HealthAbsent,
+	} {
+		got, ok := health.Components[name]
+		if !ok {
+			t.Errorf("no %s in %+v", name, health.Components)
+		} else if got.Status != want {
+			t.Errorf("got %s %s (%s), want %s", name, got.Status, got.Message, want)
+		} else if got.CheckedAt.IsZero() {
+			t.Errorf("%s has no checkedAt", name)
+		}
+	}
+	if got := health.Components["battery"].Status; got != HealthAbsent {
+		t.Errorf("got battery %s with no readings, want absent", got)
+	} else if health.Status != HealthOK {
+		t.Errorf("got overall status %s, want ok", health.Status)
+	}
+
+	fakes.RTC.Update(func() { fakes.RTC.Integrity = false })
+	if health = get(); health.Components["clock"].Status != HealthDegraded || health.Status != HealthDegraded {
+		t.Errorf("got clock %+v overall %s, want degraded", health.Components["clock"], health.Status)
+	}
+
+	commands.Set("systemctl is-enabled thermal-recorder", command.Result{Stdout: "enabled\n"})
+	commands.Set("systemctl is-active thermal-recorder", command.Result{Stdout: "failed\n", ExitCode: 3})
+	if health = get(); health.Components["service:thermal-recorder"].Status != HealthError || health.Status != HealthError {
+		t.Errorf("got thermal-recorder %+v overall %s, want error", health.Components["service:thermal-recorder"], health.Status)
+	}
+}
+
+func TestSettingsPaths(t *testing.T) {
+	api, _ := newTestAPI(t)
+
+	if w := call(api.GetTestVideos, "GET", "/api/test-videos", nil); w.Code != http.StatusNotFound {
+		t.Errorf("got %d with no test recordings directory, want 404", w.Code)
+	}
+	if err := os.MkdirAll(api.settings.TestRecordingsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.cptv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(api.settings.TestRecordingsDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var videos []string
+	decode(t, call(api.GetTestVideos, "GET", "/api/test-videos", nil), &videos)
+	if !reflect.DeepEqual(videos, []string{"a.cptv"}) {
+		t.Errorf("got test videos %v", videos)
+	}
+
+	if err := os.WriteFile(api.settings.SaltGrainsFile, []byte("environment: test\ngroup: rig\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var grains map[string]string
+	decode(t, call(api.GetSaltGrains, "GET", "/api/salt-grains", nil), &grains)
+	if !reflect.DeepEqual(grains, map[string]string{"environment": "test", "group": "rig"}) {
+		t.Errorf("got grains %v", grains)
+	}
+
+	reading := "2026-10-16 10:00:00, 3.9, 0, 3.1, li-ion, 1, 8.5, hv\n"
+	if err := os.WriteFile(api.settings.BatteryReadingsFile, []byte(reading), 0644); err != nil {
+		t.Fatal(err)
+	}
+	battery := api.checkBattery(context.Background())
+	if battery.Status != HealthDegraded {
+		t.Errorf("got battery %+v at 8.5%%, want degraded", battery)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stuck := make(chan struct{})
+	defer close(stuck)
+	got := runHealthCheck(ctx, func(context.Context) ComponentHealth {
+		<-stuck
+		return ComponentHealth{Status: HealthOK}
+	})
+	if got.Status != HealthError || got.CheckedAt.IsZero() {
+		t.Errorf("got %+v for a check that didn't finish", got)
+	}
+}
@@ -21,11 +21,9 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 
-	"github.com/TheCacophonyProject/audiobait/v3/audiobaitclient"
 	"github.com/TheCacophonyProject/audiobait/v3/audiofilelibrary"
 	"github.com/TheCacophonyProject/audiobait/v3/playlist"
 	"github.com/TheCacophonyProject/go-config"
@@ -46,7 +44,7 @@ func (api *ManagementAPI) PlayAudiobaitSound(w http.ResponseWriter, r *http.Requ
 		parseFormErrorResponse(&w, err)
 		return
 	}
-	_, err = audiobaitclient.PlayFromId(fileId, volume, 99, nil)
+	_, err = api.peers.Audiobait.PlayFromID(fileId, volume, 99)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -81,11 +79,10 @@ func (api *ManagementAPI) PlayTestSound(w http.ResponseWriter, r *http.Request)
 	volumeString := r.Form.Get("volume")
 	volume, err := strconv.Atoi(volumeString)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, fmt.Sprintf("failed to parse '%s' to an int", volumeString))
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse '%s' to an int", volumeString))
 		return
 	}
-	if err := audiobaitclient.PlayTestSound(volume); err != nil {
+	if err := api.peers.Audiobait.PlayTestSound(volume); err != nil {
 		serverError(&w, err)
 	}
 }
@@ -71,22 +71,13 @@ func (api *ManagementAPI) SetAudioRecording(w http.ResponseWriter, r *http.Reque
 }
 
 func (api *ManagementAPI) AudioRecordingStatus(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
+	status, err := api.peers.TC2Agent.AudioStatus()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request test audio recording status", err.Error())
 		return
 	}
-
-	var status int
-	var mode int
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.audiostatus", 0).Store(&mode, &status)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to request test audio recording status", http.StatusInternalServerError)
-		return
-	}
-	rp2040status := map[string]int{"mode": mode, "status": status}
+	rp2040status := map[string]int{"mode": status.Mode, "status": status.Status}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(rp2040status)
@@ -94,23 +85,15 @@ func (api *ManagementAPI) AudioRecordingStatus(w http.ResponseWriter, r *http.Re
 }
 
 func (api *ManagementAPI) TakeLongAudioRecording(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
 	seconds, err := strconv.ParseUint(r.URL.Query().Get("seconds"), 10, 32)
 	if err != nil {
 		badRequest(&w, err)
 		return
 	}
-	var result string
-
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.longaudiorecording", 0, seconds).Store(&result)
+	result, err := api.peers.TC2Agent.LongAudioRecording(seconds)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request 5 minute audio recording", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request 5 minute audio recording", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -119,19 +102,10 @@ func (api *ManagementAPI) TakeLongAudioRecording(w http.ResponseWriter, r *http.
 }
 
 func (api *ManagementAPI) TakeTestAudioRecording(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-
-	var result string
-
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.testaudio", 0).Store(&result)
+	result, err := api.peers.TC2Agent.TestAudioRecording()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request test audio recording", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request test audio recording", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -19,15 +19,14 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/TheCacophonyProject/rtc-utils/rtc"
-	"github.com/godbus/dbus"
 )
 
 const (
@@ -46,11 +45,11 @@ type clockInfo struct {
 }
 
 func (api *ManagementAPI) GetClock(w http.ResponseWriter, r *http.Request) {
-	if getDeviceType() == "tc2" {
+	if api.profile.DBusRTC {
 		api.GetClockTC2(w, r)
 		return
 	}
-	out, err := exec.Command("date", dateCmdFormat).CombinedOutput()
+	out, err := api.commands.Run(r.Context(), quickCommandTimeout, "date", dateCmdFormat)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -78,7 +77,7 @@ func (api *ManagementAPI) GetClock(w http.ResponseWriter, r *http.Request) {
 		LowRTCBattery: rtcState.LowBattery,
 		RTCIntegrity:  rtcState.ClockIntegrity,
 		NTPSynced:     ntpSynced,
-		Timezone:      getTimezone(),
+		Timezone:      api.getTimezone(r.Context()),
 	})
 	if err != nil {
 		serverError(&w, err)
@@ -90,14 +89,12 @@ func (api *ManagementAPI) GetClock(w http.ResponseWriter, r *http.Request) {
 func (api *ManagementAPI) PostClock(w http.ResponseWriter, r *http.Request) {
 	timezone := r.FormValue("timezone")
 	if timezone != "" {
-		cmd := exec.Command("timedatectl", "set-timezone", timezone)
-		_, err := cmd.CombinedOutput()
-		if err != nil {
+		if _, err := api.commands.Run(r.Context(), quickCommandTimeout, "timedatectl", "set-timezone", timezone); err != nil {
 			log.Println(err)
 		}
 	}
 
-	if getDeviceType() == "tc2" {
+	if api.profile.DBusRTC {
 		api.PostClockTC2(w, r)
 		return
 	}
@@ -106,9 +103,7 @@ func (api *ManagementAPI) PostClock(w http.ResponseWriter, r *http.Request) {
 		badRequest(&w, err)
 		return
 	}
-	cmd := exec.Command("date", dateCmdFormat, "--utc", fmt.Sprintf("--set=%s", date.Format(timeFormat)))
-	_, err = cmd.CombinedOutput()
-	if err != nil {
+	if _, err := api.commands.Run(r.Context(), quickCommandTimeout, "date", dateCmdFormat, "--utc", fmt.Sprintf("--set=%s", date.Format(timeFormat))); err != nil {
 		serverError(&w, err)
 		return
 	}
@@ -117,10 +112,8 @@ func (api *ManagementAPI) PostClock(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getTimezone() string {
-	cmd := exec.Command("timedatectl", "show", "-p", "Timezone", "--value")
-
-	out, err := cmd.Output()
+func (api *ManagementAPI) getTimezone(ctx context.Context) string {
+	out, err := api.commands.Run(ctx, quickCommandTimeout, "timedatectl", "show", "-p", "Timezone", "--value")
 	if err != nil {
 		fmt.Printf("Error getting timezone: %v\n", err)
 		return ""
@@ -129,30 +122,14 @@ func getTimezone() string {
 }
 
 func (api *ManagementAPI) GetClockTC2(w http.ResponseWriter, r *http.Request) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	rtcDBus := conn.Object("org.cacophony.RTC", "/org/cacophony/RTC")
-
-	var t string
-	var integrity bool
-	err = rtcDBus.Call("org.cacophony.RTC.GetTime", 0).Store(&t, &integrity)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to get rtc status", http.StatusInternalServerError)
-		return
-	}
-	rtcTime, err := time.Parse("2006-01-02T15:04:05Z07:00", t)
+	rtcTime, integrity, err := api.peers.RTC.Time()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to get rtc status", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to get rtc status", err.Error())
 		return
 	}
 
-	out, err := exec.Command("date", dateCmdFormat).CombinedOutput()
+	out, err := api.commands.Run(r.Context(), quickCommandTimeout, "date", dateCmdFormat)
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -163,7 +140,7 @@ func (api *ManagementAPI) GetClockTC2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ntpSynced, err := isNTPSynced()
+	ntpSynced, err := api.isNTPSynced(r.Context())
 	if err != nil {
 		serverError(&w, err)
 		return
@@ -175,7 +152,7 @@ func (api *ManagementAPI) GetClockTC2(w http.ResponseWriter, r *http.Request) {
 		SystemTime:   systemTime.Format(timeFormat),
 		RTCIntegrity: integrity,
 		NTPSynced:    ntpSynced,
-		Timezone:     getTimezone(),
+		Timezone:     api.getTimezone(r.Context()),
 	})
 	if err != nil {
 		serverError(&w, err)
@@ -191,22 +168,14 @@ func (api *ManagementAPI) PostClockTC2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	rtcDBus := conn.Object("org.cacophony.RTC", "/org/cacophony/RTC")
-	err = rtcDBus.Call("org.cacophony.RTC.SetTime", 0, date.Format("2006-01-02T15:04:05Z07:00")).Store()
-	if err != nil {
+	if err := api.peers.RTC.SetTime(date); err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to get rtc status", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to set rtc time", err.Error())
 		return
 	}
 }
 
-func isNTPSynced() (bool, error) {
-	out, err := exec.Command("timedatectl", "status").Output()
+func (api *ManagementAPI) isNTPSynced(ctx context.Context) (bool, error) {
+	out, err := api.commands.Run(ctx, quickCommandTimeout, "timedatectl", "status")
 	return strings.Contains(string(out), "synchronized: yes"), err
 }
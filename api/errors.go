@@ -0,0 +1,131 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RequestIDHeader is the header the request ID is read from and returned in.
+const RequestIDHeader = "X-Request-Id"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	versionKey
+)
+
+// A request ID given by the client is only used if it looks safe to log.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// ErrorResponse is the body of every error returned by the API.
+type ErrorResponse struct {
+	// Code is a short machine readable name for the type of error, e.g. "bad_request".
+	Code string `json:"code"`
+	// Message describes what went wrong.
+	Message string `json:"message"`
+	// Details has any extra information about the error, such as the
+	// underlying error from a D-Bus call.
+	Details interface{} `json:"details,omitempty"`
+	// RequestID can be matched with the managementd logs.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusNotImplemented:      "not_implemented",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// RequestID is middleware that gives each request an ID, which is returned
+// in the X-Request-Id header and in error responses. A valid ID sent by the
+// client is kept so that requests can be traced from the app.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return randString(16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContext returns the ID given to the request by the RequestID middleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	WriteError(w, status, message, nil)
+}
+
+// WriteError writes an error response in the envelope every API error uses,
+// so that the middleware in front of the API handlers can use it too. The
+// request ID is taken from the response header set by the RequestID
+// middleware.
+func WriteError(w http.ResponseWriter, status int, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      errorCode(status),
+		Message:   strings.TrimSpace(message),
+		Details:   details,
+		RequestID: w.Header().Get(RequestIDHeader),
+	})
+}
+
+func badRequest(w *http.ResponseWriter, err error) {
+	writeError(*w, http.StatusBadRequest, err.Error())
+}
+
+func serverError(w *http.ResponseWriter, err error) {
+	log.Printf("server error (request %s): %v", (*w).Header().Get(RequestIDHeader), err)
+	writeError(*w, http.StatusInternalServerError, err.Error())
+}
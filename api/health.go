@@ -0,0 +1,262 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/TheCacophonyProject/rtc-utils/rtc"
+)
+
+const (
+	// healthCheckTimeout is how long each part of the device gets to report
+	// before it is given as an error.
+	healthCheckTimeout = 10 * time.Second
+	lowBatteryPercent  = 10
+	// maxClockDrift is how far the RTC can be from the system time before
+	// the clock is degraded.
+	maxClockDrift = time.Minute
+)
+
+// The status of each part of the device, and of the device as a whole.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthError    = "error"
+	// HealthAbsent is for parts that the device doesn't have, such as a
+	// modem, which don't count against the device.
+	HealthAbsent = "absent"
+)
+
+// healthServices are the systemd services that are checked by GetHealth.
+var healthServices = []string{"tc2-agent", "thermal-recorder", "rpi-net-manager", "event-reporter"}
+
+// ComponentHealth is the health of one part of the device.
+type ComponentHealth struct {
+	Status    string      `json:"status"`
+	Message   string      `json:"message"`
+	CheckedAt time.Time   `json:"checkedAt"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Health is the health of the device, which is the worst of its parts.
+type Health struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// healthCheck checks one part of the device. It doesn't need to set CheckedAt.
+type healthCheck func(ctx context.Context) ComponentHealth
+
+func (api *ManagementAPI) healthChecks() map[string]healthCheck {
+	checks := map[string]healthCheck{
+		"battery": api.checkBattery,
+		"clock":   api.checkClock,
+		"modem":   api.checkIf(device.Modem, api.checkModem),
+		"offload": api.checkIf(device.RP2040, api.checkOffload),
+		"wifi":    api.checkWifi,
+	}
+	for _, service := range healthServices {
+		checks["service:"+service] = func(ctx context.Context) ComponentHealth {
+			return api.checkService(ctx, service)
+		}
+	}
+	return checks
+}
+
+// checkIf makes a check report the part as absent on devices without the
+// capability it needs.
+func (api *ManagementAPI) checkIf(c device.Capability, check healthCheck) healthCheck {
+	return func(ctx context.Context) ComponentHealth {
+		if !api.profile.Has(c) {
+			return ComponentHealth{Status: HealthAbsent, Message: fmt.Sprintf("%s devices don't have %s", api.profile.Type, c)}
+		}
+		return check(ctx)
+	}
+}
+
+// GetHealth checks the parts of the device at the same time and returns
+// their health in one response.
+func (api *ManagementAPI) GetHealth(w http.ResponseWriter, r *http.Request) {
+	checks := api.healthChecks()
+	health := Health{Status: HealthOK, Components: map[string]ComponentHealth{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Go(func() {
+			result := runHealthCheck(r.Context(), check)
+			mu.Lock()
+			defer mu.Unlock()
+			health.Components[name] = result
+		})
+	}
+	wg.Wait()
+	for _, c := range health.Components {
+		health.Status = worseHealth(health.Status, c.Status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// runHealthCheck runs a check, giving up on it after healthCheckTimeout.
+// The D-Bus calls that most checks make can't be cancelled, so a check
+// that times out is left to finish in the background.
+func runHealthCheck(ctx context.Context, check healthCheck) ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	done := make(chan ComponentHealth, 1)
+	go func() { done <- check(ctx) }()
+	var result ComponentHealth
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = ComponentHealth{Status: HealthError, Message: fmt.Sprintf("check timed out after %v", healthCheckTimeout)}
+	}
+	result.CheckedAt = time.Now()
+	return result
+}
+
+// worseHealth returns the worse of two statuses, where absent counts as ok.
+func worseHealth(a, b string) string {
+	rank := map[string]int{HealthOK: 0, HealthAbsent: 0, HealthDegraded: 1, HealthError: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// checkFailed is the health of a part that couldn't be checked.
+func checkFailed(err error) ComponentHealth {
+	if peers.IsAbsent(err) {
+		return ComponentHealth{Status: HealthAbsent, Message: err.Error()}
+	}
+	return ComponentHealth{Status: HealthError, Message: err.Error()}
+}
+
+func (api *ManagementAPI) checkBattery(ctx context.Context) ComponentHealth {
+	reading, err := getLastBatteryReading(api.settings.BatteryReadingsFile)
+	if os.IsNotExist(err) {
+		return ComponentHealth{Status: HealthAbsent, Message: "no battery readings"}
+	} else if err != nil {
+		return checkFailed(err)
+	}
+	health := ComponentHealth{Status: HealthOK, Message: "main battery " + reading.MainBattery + "V", Details: reading}
+	if percent, err := strconv.ParseFloat(reading.BatteryPercentage, 64); err == nil {
+		health.Message = fmt.Sprintf("%s, %.0f%%", health.Message, percent)
+		if percent < lowBatteryPercent {
+			health.Status = HealthDegraded
+			health.Message = "low battery: " + health.Message
+		}
+	}
+	return health
+}
+
+func (api *ManagementAPI) checkClock(ctx context.Context) ComponentHealth {
+	var rtcTime time.Time
+	var integrity bool
+	if api.profile.DBusRTC {
+		var err error
+		if rtcTime, integrity, err = api.peers.RTC.Time(); err != nil {
+			return checkFailed(err)
+		}
+	} else {
+		// Devices other than the TC2 have the RTC on i2c rather than behind
+		// a service.
+		state, err := rtc.State(1)
+		if err != nil {
+			return ComponentHealth{Status: HealthAbsent, Message: "no RTC: " + err.Error()}
+		}
+		rtcTime, integrity = state.Time, state.ClockIntegrity
+	}
+	ntpSynced, _ := api.isNTPSynced(ctx)
+	drift := time.Since(rtcTime).Round(time.Second)
+	health := ComponentHealth{
+		Status:  HealthOK,
+		Message: fmt.Sprintf("RTC is %v from the system time, NTP synced: %t", drift, ntpSynced),
+		Details: map[string]interface{}{
+			"rtcTime":      rtcTime.UTC().Format(timeFormat),
+			"rtcIntegrity": integrity,
+			"ntpSynced":    ntpSynced,
+		},
+	}
+	switch {
+	case !integrity:
+		health.Status = HealthDegraded
+		health.Message = "RTC has lost its clock integrity"
+	case drift > maxClockDrift || drift < -maxClockDrift:
+		health.Status = HealthDegraded
+	}
+	return health
+}
+
+func (api *ManagementAPI) checkModem(ctx context.Context) ComponentHealth {
+	status, err := api.peers.Modemd.Status()
+	if err != nil {
+		return checkFailed(err)
+	}
+	message := "modem is off"
+	if powered, _ := status["powered"].(bool); powered {
+		message = "modem is on"
+	}
+	return ComponentHealth{Status: HealthOK, Message: message, Details: status}
+}
+
+func (api *ManagementAPI) checkOffload(ctx context.Context) ComponentHealth {
+	status, err := api.peers.TC2Agent.OffloadStatus()
+	if err != nil {
+		return checkFailed(err)
+	}
+	message := fmt.Sprintf("%d files waiting to offload", status.FilesRemaining)
+	if status.InProgress {
+		message = fmt.Sprintf("offloading, %d%% complete with %d files remaining", status.PercentComplete, status.FilesRemaining)
+	}
+	return ComponentHealth{Status: HealthOK, Message: message, Details: status}
+}
+
+func (api *ManagementAPI) checkWifi(ctx context.Context) ComponentHealth {
+	state, err := api.peers.NetManager.State()
+	if err != nil {
+		return checkFailed(err)
+	}
+	return ComponentHealth{Status: HealthOK, Message: string(state)}
+}
+
+func (api *ManagementAPI) checkService(ctx context.Context, service string) ComponentHealth {
+	status, err := api.getServiceStatus(ctx, service)
+	switch {
+	case err != nil:
+		return checkFailed(err)
+	case status.Active:
+		running := (time.Duration(status.Duration) * time.Second).String()
+		return ComponentHealth{Status: HealthOK, Message: "running for " + running, Details: status}
+	case status.Enabled:
+		return ComponentHealth{Status: HealthError, Message: "enabled but not running", Details: status}
+	}
+	// Services that aren't enabled are taken to be ones the device doesn't use.
+	return ComponentHealth{Status: HealthAbsent, Message: "not enabled", Details: status}
+}
@@ -24,12 +24,6 @@ import (
 )
 
 func (api *ManagementAPI) RecordingOffloadStatus(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
 	type OffloadNotInProgress struct {
 		InProgress      bool `json:"offload-in-progress"`
 		FilesTotal      int  `json:"files-total"`
@@ -47,54 +41,40 @@ func (api *ManagementAPI) RecordingOffloadStatus(w http.ResponseWriter, r *http.
 		EventsRemaining  int  `json:"events-remaining"`
 	}
 
-	var isOffloading int
-	var percentComplete int
-	var secondsRemaining int
-	var filesTotal int
-	var filesRemaining int
-	var eventsTotal int
-	var eventsRemaining int
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.offloadstatus", 0).Store(&isOffloading, &percentComplete, &secondsRemaining, &filesTotal, &filesRemaining, &eventsTotal, &eventsRemaining)
+	status, err := api.peers.TC2Agent.OffloadStatus()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request recording offload status", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request recording offload status", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	if isOffloading == 1 {
+	if status.InProgress {
 		json.NewEncoder(w).Encode(OffloadInProgress{
 			InProgress:       true,
-			PercentComplete:  percentComplete,
-			SecondsRemaining: secondsRemaining,
-			FilesTotal:       filesTotal,
-			FilesRemaining:   filesRemaining,
-			EventsTotal:      eventsTotal,
-			EventsRemaining:  eventsRemaining,
+			PercentComplete:  status.PercentComplete,
+			SecondsRemaining: status.SecondsRemaining,
+			FilesTotal:       status.FilesTotal,
+			FilesRemaining:   status.FilesRemaining,
+			EventsTotal:      status.EventsTotal,
+			EventsRemaining:  status.EventsRemaining,
 		})
 	} else {
 		json.NewEncoder(w).Encode(OffloadNotInProgress{
 			InProgress:      false,
-			FilesTotal:      filesTotal,
-			FilesRemaining:  filesRemaining,
-			EventsTotal:     eventsTotal,
-			EventsRemaining: eventsRemaining,
+			FilesTotal:      status.FilesTotal,
+			FilesRemaining:  status.FilesRemaining,
+			EventsTotal:     status.EventsTotal,
+			EventsRemaining: status.EventsRemaining,
 		})
 	}
 
 }
 
 func (api *ManagementAPI) CancelOffload(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	var result string
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.canceloffload", 0).Store(&result)
+	result, err := api.peers.TC2Agent.CancelOffload()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to cancel offload", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to cancel offload", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -103,17 +83,10 @@ func (api *ManagementAPI) CancelOffload(w http.ResponseWriter, r *http.Request)
 }
 
 func (api *ManagementAPI) ForceRp2040Offload(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
+	result, err := api.peers.TC2Agent.ForceOffload()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	var result string
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.forcerp2040offload", 0).Store(&result)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to request forced offload of rp2040", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request forced offload of rp2040", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -122,17 +95,10 @@ func (api *ManagementAPI) ForceRp2040Offload(w http.ResponseWriter, r *http.Requ
 }
 
 func (api *ManagementAPI) PrioritiseFrameServe(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-	var result string
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.prioritiseframeserve", 0).Store(&result)
+	result, err := api.peers.TC2Agent.PrioritiseFrameServe()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request frame serve priority from rp2040", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request frame serve priority from rp2040", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
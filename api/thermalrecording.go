@@ -25,22 +25,13 @@ import (
 )
 
 func (api *ManagementAPI) TestThermalRecordingStatus(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
+	status, err := api.peers.TC2Agent.ThermalStatus()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to get test thermal recording status", err.Error())
 		return
 	}
-
-	var status int
-	var mode int
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.testthermalstatus", 0).Store(&mode, &status)
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to get test thermal recording status", http.StatusInternalServerError)
-		return
-	}
-	rp2040status := map[string]int{"mode": mode, "status": status}
+	rp2040status := map[string]int{"mode": status.Mode, "status": status.Status}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(rp2040status)
@@ -48,23 +39,15 @@ func (api *ManagementAPI) TestThermalRecordingStatus(w http.ResponseWriter, r *h
 }
 
 func (api *ManagementAPI) TakeLongTestThermalRecording(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
 	seconds, err := strconv.ParseUint(r.URL.Query().Get("seconds"), 10, 32)
 	if err != nil {
 		badRequest(&w, err)
 		return
 	}
-	var result string
-
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.longtestthermalrecording", 0, seconds).Store(&result)
+	result, err := api.peers.TC2Agent.LongThermalRecording(seconds)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request 5 minute test thermal recording", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request 5 minute test thermal recording", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -73,19 +56,10 @@ func (api *ManagementAPI) TakeLongTestThermalRecording(w http.ResponseWriter, r
 }
 
 func (api *ManagementAPI) TakeShortTestThermalRecording(w http.ResponseWriter, r *http.Request) {
-	tc2AgentDbus, err := GetTC2AgentDbus()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Failed to connect to DBus", http.StatusInternalServerError)
-		return
-	}
-
-	var result string
-
-	err = tc2AgentDbus.Call("org.cacophony.TC2Agent.shorttestthermalrecording", 0).Store(&result)
+	result, err := api.peers.TC2Agent.ShortThermalRecording()
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Failed to request short test thermal recording", http.StatusInternalServerError)
+		WriteError(w, http.StatusInternalServerError, "Failed to request short test thermal recording", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -4,6 +4,11 @@ export interface FrameInfo {
   BinaryVersion: string;
   Camera: CameraInfo;
   Tracks: Track[];
+  // Region is set when only part of the frame was sent.
+  Region?: FrameRegion;
+  // Min and Max are the values 0 and 255 are in 8 bit frames.
+  Min?: number;
+  Max?: number;
 }
 
 export interface Track {
@@ -64,3 +69,68 @@ interface CameraState {
   prevFrameNum: number;
   heartbeatInterval: number;
 }
+
+// The frame protocol managementd streams frames with, see the frameproto
+// package for the details.
+export const FrameProtocolVersions = [1];
+
+export enum MessageType {
+  Frame = 1,
+  Status = 2,
+  Disconnected = 3,
+  Error = 4,
+  Stats = 5,
+}
+
+// The flags of a frame message, saying how its body is encoded.
+export enum FrameFlags {
+  Delta = 1 << 0,
+  Deflate = 1 << 1,
+  Zstd = 1 << 2,
+  EightBit = 1 << 3,
+}
+
+export interface FrameRegion {
+  x: number;
+  y: number;
+  width: number;
+  height: number;
+}
+
+// Profile is how a client wants to be sent frames.
+export interface Profile {
+  encoding?: "raw" | "delta";
+  compression?: "none" | "deflate" | "zstd";
+  depth?: 8 | 16;
+  maxFPS?: number;
+  roi?: FrameRegion;
+}
+
+export interface WelcomeMessage {
+  type: "Welcome";
+  version: number;
+  messageTypes: string[];
+  appVersion: string;
+  profile: Profile;
+}
+
+export interface ErrorMessage {
+  type: "Error";
+  message: string;
+}
+
+export interface Status {
+  connected: boolean;
+  camera?: CameraInfo;
+  appVersion: string;
+  binaryVersion?: string;
+}
+
+export interface Disconnected {
+  reason: string;
+}
+
+export interface Stats {
+  framesSent: number;
+  framesSkipped: number;
+}
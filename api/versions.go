@@ -0,0 +1,250 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Versions are the versions of the API that are served under /api/v<n>,
+// oldest first. The unversioned /api prefix is an alias for the latest.
+var Versions = []int{9, apiVersion}
+
+// LatestVersion is the current version of the API.
+const LatestVersion = apiVersion
+
+// adapter converts the responses of some routes from the latest version to
+// the shape an older version returned.
+type adapter struct {
+	// routes are the path templates the adapter is used for, without the
+	// version prefix.
+	routes map[string]bool
+	new    func(http.ResponseWriter) responseAdapter
+}
+
+// adapters lists the changes made after each version.
+var adapters = map[int][]adapter{
+	9: {
+		// v10 returned errors as JSON instead of plain text. The routes added
+		// since v9 have only ever returned JSON errors, so are left alone.
+		{routes: v9Routes, new: newV9Errors},
+		// v10 added the capabilities of the device.
+		{routes: routes("/device-info"), new: withoutFields("capabilities")},
+	},
+}
+
+// v9Routes are the routes that v9 had.
+var v9Routes = routes(
+	"/device-info", "/recordings", "/recording/{id}", "/camera/snapshot",
+	"/camera/snapshot-recording", "/signal-strength", "/reregister",
+	"/reregister-authorized", "/reboot", "/config", "/clear-config-section",
+	"/location", "/clock", "/version", "/event-keys", "/events",
+	"/trigger-trap", "/check-salt-connection", "/salt-update", "/auto-update",
+	"/audiobait", "/play-test-sound", "/play-audiobait-sound", "/logs",
+	"/service", "/service-restart", "/modem", "/salt-grains", "/modem/apn",
+	"/modem-stay-on-for", "/battery", "/battery/config", "/test-videos",
+	"/play-test-video", "/upload-test-recording", "/network/interfaces",
+	"/network/wifi", "/network/wifi/save", "/network/wifi/saved",
+	"/network/wifi/forget", "/network/wifi/current", "/network/hotspot",
+	"/wifi-check", "/modem-check", "/wifi-networks", "/wifi-network-scan",
+	"/enable-wifi", "/enable-hotspot", "/wifi-status", "/upload-logs",
+	"/audiorecording", "/audio/long-recording", "/audio/test-recording",
+	"/audio/audio-status", "/audio/recordings", "/offload-status",
+	"/cancel-offload", "/thermal/long-test-recording",
+	"/thermal/short-test-recording", "/thermal/thermal-status",
+	"/offload-now", "/serve-frames-now",
+)
+
+func routes(paths ...string) map[string]bool {
+	m := map[string]bool{}
+	for _, path := range paths {
+		m[path] = true
+	}
+	return m
+}
+
+// VersionPrefix returns the path prefix routes of a version are served under.
+func VersionPrefix(version int) string {
+	return fmt.Sprintf("/api/v%d", version)
+}
+
+// VersionFromContext returns the version of the API the request was made to.
+func VersionFromContext(ctx context.Context) int {
+	if version, ok := ctx.Value(versionKey).(int); ok {
+		return version
+	}
+	return LatestVersion
+}
+
+// Version is middleware for the routes of a version of the API. It adapts
+// responses for older versions and marks responses from older versions and
+// the unversioned prefix as deprecated, linking to the latest version.
+func Version(version int, unversioned bool) func(http.Handler) http.Handler {
+	prefix := "/api"
+	if !unversioned {
+		prefix = VersionPrefix(version)
+	}
+	deprecated := unversioned || version != LatestVersion
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if deprecated {
+				successor := VersionPrefix(LatestVersion) + strings.TrimPrefix(r.URL.Path, prefix)
+				w.Header().Set("Deprecation", "true")
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+			}
+			r = r.WithContext(context.WithValue(r.Context(), versionKey, version))
+			route := ""
+			if current := mux.CurrentRoute(r); current != nil {
+				template, _ := current.GetPathTemplate()
+				route = strings.TrimPrefix(template, prefix)
+			}
+			var pending []responseAdapter
+			for _, adapter := range adapters[version] {
+				if !adapter.routes[route] {
+					continue
+				}
+				a := adapter.new(w)
+				pending = append(pending, a)
+				w = a
+			}
+			next.ServeHTTP(w, r)
+			// Flush the innermost adapter first so its output passes through the others.
+			for i := len(pending) - 1; i >= 0; i-- {
+				pending[i].flush()
+			}
+		})
+	}
+}
+
+// responseAdapter is a ResponseWriter that changes a response before passing
+// it on once the handler has finished.
+type responseAdapter interface {
+	http.ResponseWriter
+	flush()
+}
+
+// bufferedAdapter holds back the responses that it wants to change until the
+// handler has finished, and passes the others straight on.
+type bufferedAdapter struct {
+	http.ResponseWriter
+	wants   func(status int, header http.Header) bool
+	convert func(w http.ResponseWriter, status int, body []byte)
+	status  int
+	buf     *bytes.Buffer
+}
+
+func (b *bufferedAdapter) WriteHeader(status int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = status
+	if b.wants(status, b.Header()) {
+		b.buf = &bytes.Buffer{}
+		return
+	}
+	b.ResponseWriter.WriteHeader(status)
+}
+
+func (b *bufferedAdapter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.buf != nil {
+		return b.buf.Write(p)
+	}
+	return b.ResponseWriter.Write(p)
+}
+
+func (b *bufferedAdapter) flush() {
+	if b.buf == nil {
+		return
+	}
+	b.Header().Del("Content-Length")
+	b.convert(b.ResponseWriter, b.status, b.buf.Bytes())
+}
+
+// newV9Errors returns JSON error responses as v9 did: the message in plain
+// text, the same as http.Error, with a 403 for bad credentials. A missing
+// role was already JSON in v9, though without the envelope.
+func newV9Errors(w http.ResponseWriter) responseAdapter {
+	return &bufferedAdapter{
+		ResponseWriter: w,
+		wants: func(status int, header http.Header) bool {
+			return status >= http.StatusBadRequest && strings.HasPrefix(header.Get("Content-Type"), "application/json")
+		},
+		convert: func(w http.ResponseWriter, status int, body []byte) {
+			var resp ErrorResponse
+			if err := json.Unmarshal(body, &resp); err != nil || resp.Code == "" {
+				// Not an error envelope, so pass it on unchanged.
+				w.WriteHeader(status)
+				w.Write(body)
+				return
+			}
+			if details, ok := resp.Details.(map[string]interface{}); ok && details["missingPermission"] != nil {
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"message":           resp.Message,
+					"missingPermission": details["missingPermission"],
+				})
+				return
+			}
+			if status == http.StatusUnauthorized {
+				w.Header().Del("WWW-Authenticate")
+				status = http.StatusForbidden
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(status)
+			fmt.Fprintln(w, resp.Message)
+		},
+	}
+}
+
+// withoutFields removes fields added since a version from the JSON object in
+// a successful response. Other responses are passed on unchanged.
+func withoutFields(fields ...string) func(http.ResponseWriter) responseAdapter {
+	return func(w http.ResponseWriter) responseAdapter {
+		return &bufferedAdapter{
+			ResponseWriter: w,
+			wants: func(status int, header http.Header) bool {
+				return status < http.StatusBadRequest
+			},
+			convert: func(w http.ResponseWriter, status int, body []byte) {
+				var object map[string]json.RawMessage
+				if err := json.Unmarshal(body, &object); err != nil {
+					w.WriteHeader(status)
+					w.Write(body)
+					return
+				}
+				for _, field := range fields {
+					delete(object, field)
+				}
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(object)
+			},
+		}
+	}
+}
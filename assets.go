@@ -0,0 +1,107 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package managementinterface
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// embedded has the html templates and static files built into the binary.
+//
+//go:embed html static
+var embedded embed.FS
+
+var (
+	// assets are where the html templates and static files are read from.
+	assets fs.FS = embedded
+	// reloadTemplates is set when the templates are read from disk, so that
+	// changes to them show up without restarting.
+	reloadTemplates bool
+	// tmpl is our pointer to our parsed templates.
+	tmpl *template.Template
+)
+
+// This parses our html templates up front.
+func init() {
+	var err error
+	if tmpl, err = parseTemplates(assets); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTemplates(assets fs.FS) (*template.Template, error) {
+	// The name of the device we are running this executable on.
+	deviceName := getDeviceName()
+	t := template.New("")
+	t.Funcs(template.FuncMap{"DeviceName": func() string { return deviceName }})
+	return t.ParseFS(assets, "html/*.html")
+}
+
+// UseAssetsDir serves the html templates and static files from the html and
+// static directories in dir instead of from the binary. They are read again
+// for each request, so that changes show up when the page is reloaded.
+func UseAssetsDir(dir string) error {
+	for _, sub := range []string{"html", "static"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", filepath.Join(dir, sub))
+		}
+	}
+	diskAssets := os.DirFS(dir)
+	t, err := parseTemplates(diskAssets)
+	if err != nil {
+		return err
+	}
+	assets, tmpl, reloadTemplates = diskAssets, t, true
+	return nil
+}
+
+// StaticFiles returns the static files, such as the scripts and styles used
+// by the pages.
+func StaticFiles() fs.FS {
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		// fs.Sub only fails for an invalid path.
+		panic(err)
+	}
+	return static
+}
+
+// executeTemplate renders a page, parsing the templates again first when
+// they are being read from disk.
+func executeTemplate(w http.ResponseWriter, name string, data interface{}) {
+	t := tmpl
+	if reloadTemplates {
+		var err error
+		if t, err = parseTemplates(assets); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("failed to render %s: %v", name, err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package managementinterface
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedAssets(t *testing.T) {
+	if tmpl.Lookup("index.html") == nil {
+		t.Error("index.html template not embedded")
+	}
+	if _, err := fs.Stat(StaticFiles(), "favicon.ico"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAssetsDir(t *testing.T) {
+	embeddedAssets, embeddedTmpl := assets, tmpl
+	defer func() { assets, tmpl, reloadTemplates = embeddedAssets, embeddedTmpl, false }()
+
+	dir := t.TempDir()
+	for _, sub := range []string{"html", "static"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := filepath.Join(dir, "html", "index.html")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(page, "first")
+	writeFile(filepath.Join(dir, "static", "app.js"), "app")
+
+	if err := UseAssetsDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing assets dir")
+	}
+	if err := UseAssetsDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	render := func() string {
+		w := httptest.NewRecorder()
+		executeTemplate(w, "index.html", nil)
+		return w.Body.String()
+	}
+	if body := render(); body != "first" {
+		t.Errorf("got %q, want first", body)
+	}
+	writeFile(page, "second")
+	if body := render(); body != "second" {
+		t.Errorf("got %q after changing the template, want second", body)
+	}
+	writeFile(page, "{{ .Broken")
+	if body := render(); !strings.Contains(body, "index.html") {
+		t.Errorf("got %q, want the template error", body)
+	}
+
+	if b, err := fs.ReadFile(StaticFiles(), "app.js"); err != nil || string(b) != "app" {
+		t.Errorf("got %q, %v reading app.js from the assets dir", b, err)
+	}
+}
@@ -46,5 +46,5 @@ func AudioRecordingHandler(config *goconfig.Config, w http.ResponseWriter, r *ht
 		AudioRecording: &audioRecording,
 		ErrorMessage:   errorMessage(err),
 	}
-	tmpl.ExecuteTemplate(w, "audiorecording.html", resp)
+	executeTemplate(w, "audiorecording.html", resp)
 }
@@ -0,0 +1,213 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package audit keeps a log of the API calls that change something on the device.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+)
+
+const (
+	// DefaultMaxSize is how big the audit log can get before it is rotated.
+	DefaultMaxSize = 1 << 20
+	// DefaultMaxBackups is how many rotated audit logs are kept.
+	DefaultMaxBackups = 3
+)
+
+var log = logging.NewLogger("info")
+
+// Record is one API call in the audit log.
+type Record struct {
+	Time       time.Time         `json:"time"`
+	User       string            `json:"user"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Method     string            `json:"method"`
+	Route      string            `json:"route"`
+	Path       string            `json:"path"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     int               `json:"status"`
+}
+
+// Log appends records as JSON lines to a file, rotating it to path.1,
+// path.2, ... when it gets too big.
+type Log struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// New opens the audit log at path, creating it if needed.
+func New(path string, maxSize int64, maxBackups int, l *logging.Logger) (*Log, error) {
+	if l != nil {
+		log = l
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	a := &Log{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Log) open() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// Append writes a record to the log.
+func (a *Log) Append(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.size+int64(len(data)) > a.maxSize && a.size > 0 {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	return err
+}
+
+// rotate must be called with a.mu held.
+func (a *Log) rotate() error {
+	if err := a.file.Close(); err != nil {
+		log.Printf("failed to close audit log: %v", err)
+	}
+	for i := a.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(a.backupPath(i), a.backupPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if a.maxBackups > 0 {
+		if err := os.Rename(a.path, a.backupPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(a.path, 0); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+func (a *Log) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", a.path, i)
+}
+
+// Filter selects records from the audit log. Zero values match everything.
+type Filter struct {
+	From  time.Time
+	To    time.Time
+	Route string
+}
+
+func (f Filter) match(rec Record) bool {
+	if !f.From.IsZero() && rec.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && rec.Time.After(f.To) {
+		return false
+	}
+	if f.Route != "" && !strings.HasPrefix(rec.Route, f.Route) && !strings.HasPrefix(rec.Path, f.Route) {
+		return false
+	}
+	return true
+}
+
+// Query returns the records matching the filter, oldest first.
+func (a *Log) Query(f Filter) ([]Record, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	records := []Record{}
+	for i := a.maxBackups; i >= 0; i-- {
+		path := a.path
+		if i > 0 {
+			path = a.backupPath(i)
+		}
+		var err error
+		records, err = readRecords(path, f, records)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func readRecords(path string, f Filter, records []Record) ([]Record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("skipping bad audit record in %s: %v", path, err)
+			continue
+		}
+		if f.match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Close closes the audit log file.
+func (a *Log) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
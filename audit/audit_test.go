@@ -0,0 +1,194 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+)
+
+func newTestLog(t *testing.T, maxSize int64, maxBackups int) *Log {
+	t.Helper()
+	a, err := New(filepath.Join(t.TempDir(), "audit", "audit.log"), maxSize, maxBackups, logging.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+// paths returns the paths of the records, in the order they were returned.
+func paths(records []Record) []string {
+	p := []string{}
+	for _, rec := range records {
+		p = append(p, rec.Path)
+	}
+	return p
+}
+
+// pathsIn returns the paths of the records in a log file.
+func pathsIn(t *testing.T, path string) []string {
+	t.Helper()
+	records, err := readRecords(path, Filter{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths(records)
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		files      map[string][]string
+		query      []string
+	}{
+		{
+			name:       "backups",
+			maxBackups: 2,
+			files: map[string][]string{
+				"":   {"/api/4"},
+				".1": {"/api/3"},
+				".2": {"/api/2"},
+			},
+			query: []string{"/api/2", "/api/3", "/api/4"},
+		},
+		{
+			name:       "no backups",
+			maxBackups: 0,
+			files: map[string][]string{
+				"": {"/api/4"},
+			},
+			query: []string{"/api/4"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Each record is too big to share a file with another.
+			a := newTestLog(t, 100, test.maxBackups)
+			for i := range 5 {
+				if err := a.Append(Record{Path: "/api/" + strconv.Itoa(i), Method: "POST", Status: 200}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for suffix, want := range test.files {
+				if got := pathsIn(t, a.path+suffix); !reflect.DeepEqual(got, want) {
+					t.Errorf("audit.log%s has %q, want %q", suffix, got, want)
+				}
+			}
+			if _, err := os.Stat(a.backupPath(test.maxBackups + 1)); !os.IsNotExist(err) {
+				t.Errorf("too many backups were kept: %v", err)
+			}
+			records, err := a.Query(Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(records); !reflect.DeepEqual(got, test.query) {
+				t.Errorf("query got %q, want %q", got, test.query)
+			}
+		})
+	}
+}
+
+func TestAppendKeepsExistingLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	for _, p := range []string{"/api/reboot", "/api/config"} {
+		a, err := New(path, DefaultMaxSize, DefaultMaxBackups, logging.NewLogger("error"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Append(Record{Path: p}); err != nil {
+			t.Fatal(err)
+		}
+		a.Close()
+	}
+	if got := pathsIn(t, path); !reflect.DeepEqual(got, []string{"/api/reboot", "/api/config"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: start, Route: "/api/network/wifi", Path: "/api/network/wifi"},
+		{Time: start.Add(time.Hour), Route: "/api/network/wifi/{ssid}", Path: "/api/network/wifi/home"},
+		{Time: start.Add(2 * time.Hour), Route: "/api/reboot", Path: "/api/reboot"},
+		{Time: start.Add(3 * time.Hour), Path: "/api/v9/config"},
+	}
+	for _, rec := range records {
+		if err := a.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"everything", Filter{}, []string{"/api/network/wifi", "/api/network/wifi/home", "/api/reboot", "/api/v9/config"}},
+		{"from", Filter{From: start.Add(time.Hour)}, []string{"/api/network/wifi/home", "/api/reboot", "/api/v9/config"}},
+		{"to", Filter{To: start.Add(time.Hour)}, []string{"/api/network/wifi", "/api/network/wifi/home"}},
+		{"between", Filter{From: start.Add(30 * time.Minute), To: start.Add(2 * time.Hour)}, []string{"/api/network/wifi/home", "/api/reboot"}},
+		{"route", Filter{Route: "/api/network"}, []string{"/api/network/wifi", "/api/network/wifi/home"}},
+		{"route template", Filter{Route: "/api/network/wifi/{ssid}"}, []string{"/api/network/wifi/home"}},
+		{"path without a route", Filter{Route: "/api/v9"}, []string{"/api/v9/config"}},
+		{"route and time", Filter{Route: "/api/network", From: start.Add(time.Minute)}, []string{"/api/network/wifi/home"}},
+		{"nothing", Filter{Route: "/api/salt-update"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := a.Query(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(records); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuerySkipsBadRecords(t *testing.T) {
+	a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+	if err := a.Append(Record{Path: "/api/reboot"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.file.WriteString("not json\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Append(Record{Path: "/api/config"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := a.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(records); !reflect.DeepEqual(got, []string{"/api/reboot", "/api/config"}) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/TheCacophonyProject/management-interface/auth"
+)
+
+const (
+	// maxSummarisedBody is how much of a request body is read to summarise its parameters.
+	maxSummarisedBody = 64 * 1024
+	maxParamLength    = 200
+	redacted          = "[redacted]"
+)
+
+// Parameters with any of these in their name are not written to the log.
+var secretParams = []string{"pass", "psk", "secret", "token"}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Middleware records every request that isn't a GET. It needs to be used
+// before auth.RequireUser so that requests without valid credentials, or
+// that were throttled, are recorded too.
+func (a *Log) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		params := summariseParams(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		r, recordedUser := auth.RecordUser(r)
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		record := Record{
+			Time:       time.Now(),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Params:     params,
+			Status:     rec.status,
+		}
+		route := mux.CurrentRoute(r)
+		if route != nil {
+			record.Route, _ = route.GetPathTemplate()
+		}
+		if user, ok := recordedUser(); ok {
+			record.User = user.Name
+		} else if route != nil && route.GetName() == auth.LoginRoute {
+			// Login requests are made before there is a user.
+			record.User = params["username"]
+		} else if name, _, ok := r.BasicAuth(); ok {
+			// The user whose credentials weren't accepted.
+			record.User = name
+		}
+		if err := a.Append(record); err != nil {
+			log.Printf("failed to write audit record for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+// summariseParams collects the route variables, query and body parameters
+// of a request, with secrets redacted. The body is put back for the handler.
+func summariseParams(r *http.Request) map[string]string {
+	params := map[string]string{}
+	for k, v := range mux.Vars(r) {
+		params[k] = v
+	}
+	addValues(params, r.URL.Query())
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Body == nil || r.ContentLength == 0 {
+		return redact(params)
+	}
+	// Uploads are too big to keep a copy of, so just note their size.
+	if strings.HasPrefix(contentType, "multipart/") || r.ContentLength > maxSummarisedBody {
+		params["body"] = fmt.Sprintf("%s, %d bytes", contentType, r.ContentLength)
+		return redact(params)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSummarisedBody))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) == 0 {
+		return redact(params)
+	}
+
+	var fields map[string]interface{}
+	if contentType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			addValues(params, values)
+		}
+	} else if err := json.Unmarshal(body, &fields); err == nil {
+		for k, v := range fields {
+			params[k] = fmt.Sprint(v)
+		}
+	} else {
+		params["body"] = fmt.Sprintf("%s, %d bytes", contentType, len(body))
+	}
+	return redact(params)
+}
+
+func addValues(params map[string]string, values url.Values) {
+	for k, v := range values {
+		params[k] = strings.Join(v, ",")
+	}
+}
+
+func redact(params map[string]string) map[string]string {
+	for k, v := range params {
+		lower := strings.ToLower(k)
+		for _, secret := range secretParams {
+			if strings.Contains(lower, secret) {
+				v = redacted
+				break
+			}
+		}
+		if len(v) > maxParamLength {
+			v = v[:maxParamLength] + "..."
+		}
+		params[k] = v
+	}
+	return params
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// QueryHandler returns the audit records as JSON. The optional from and to
+// parameters are RFC 3339 times, and route matches the start of the route or
+// path of a record, e.g. /api/network.
+func (a *Log) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	var f Filter
+	var err error
+	if from := r.URL.Query().Get("from"); from != "" {
+		if f.From, err = time.Parse(time.RFC3339, from); err != nil {
+			api.WriteError(w, http.StatusBadRequest, "invalid from time: "+err.Error(), nil)
+			return
+		}
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		if f.To, err = time.Parse(time.RFC3339, to); err != nil {
+			api.WriteError(w, http.StatusBadRequest, "invalid to time: "+err.Error(), nil)
+			return
+		}
+	}
+	f.Route = r.URL.Query().Get("route")
+
+	records, err := a.Query(f)
+	if err != nil {
+		log.Printf("failed to read audit log: %v", err)
+		api.WriteError(w, http.StatusInternalServerError, "failed to read audit log", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
@@ -0,0 +1,271 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/gorilla/mux"
+)
+
+// newTestRouter serves routes that echo the request body behind the audit
+// middleware and RequireUser, as the API does. The user "alice"
+// has the password "alice-password".
+func newTestRouter(t *testing.T, a *Log) *mux.Router {
+	t.Helper()
+	dir := t.TempDir()
+	hash, err := auth.HashPassword("alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := "[[managementd.users]]\nname = \"alice\"\npassword-hash = \"" + hash + "\"\nrole = \"admin\"\n"
+	if err := os.WriteFile(filepath.Join(dir, goconfig.ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := goconfig.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.New(conf, dir, logging.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusConflict)
+		}
+		w.Write(body)
+	}
+	router := mux.NewRouter()
+	router.Use(a.Middleware, authenticator.RequireUser)
+	router.HandleFunc("/api/network/wifi/{ssid}", echo)
+	router.HandleFunc("/api/login", echo).Name(auth.LoginRoute)
+	router.HandleFunc("/api/audit", a.QueryHandler)
+	return router
+}
+
+func TestMiddleware(t *testing.T) {
+	multipartBody := &bytes.Buffer{}
+	mw := multipart.NewWriter(multipartBody)
+	mw.WriteField("password", "hunter22")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		user        string
+		status      int
+		route       string
+		params      map[string]string
+	}{
+		{
+			name:        "json",
+			method:      "POST",
+			target:      "/api/network/wifi/home?psk=abcdefgh",
+			contentType: "application/json",
+			body:        `{"password": "hunter22", "newPassword": "hunter23", "apiToken": "x", "hidden": true}`,
+			user:        "alice",
+			status:      http.StatusOK,
+			route:       "/api/network/wifi/{ssid}",
+			params:      map[string]string{"ssid": "home", "psk": redacted, "password": redacted, "newPassword": redacted, "apiToken": redacted, "hidden": "true"},
+		},
+		{
+			name:        "form",
+			method:      "PUT",
+			target:      "/api/network/wifi/home",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"PSK": {"abcdefgh"}, "priority": {"2"}, "name": {strings.Repeat("n", maxParamLength+1)}}.Encode(),
+			user:        "alice",
+			status:      http.StatusOK,
+			route:       "/api/network/wifi/{ssid}",
+			params:      map[string]string{"ssid": "home", "PSK": redacted, "priority": "2", "name": strings.Repeat("n", maxParamLength) + "..."},
+		},
+		{
+			name:        "multipart",
+			method:      "POST",
+			target:      "/api/network/wifi/home",
+			contentType: mw.FormDataContentType(),
+			body:        multipartBody.String(),
+			user:        "alice",
+			status:      http.StatusOK,
+			route:       "/api/network/wifi/{ssid}",
+			params:      map[string]string{"ssid": "home", "body": "multipart/form-data, " + strconv.Itoa(multipartBody.Len()) + " bytes"},
+		},
+		{
+			name:        "not json",
+			method:      "DELETE",
+			target:      "/api/network/wifi/home?fail=1",
+			contentType: "text/plain",
+			body:        "token=abc",
+			user:        "alice",
+			status:      http.StatusConflict,
+			route:       "/api/network/wifi/{ssid}",
+			params:      map[string]string{"ssid": "home", "fail": "1", "body": "text/plain, 9 bytes"},
+		},
+		{
+			name:        "login",
+			method:      "POST",
+			target:      "/api/login",
+			contentType: "application/json",
+			body:        `{"username": "bob", "password": "bob-password"}`,
+			user:        "bob",
+			status:      http.StatusOK,
+			route:       "/api/login",
+			params:      map[string]string{"username": "bob", "password": redacted},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+			router := newTestRouter(t, a)
+			r := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			r.SetBasicAuth("alice", "alice-password")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			// The handler can still read the whole body.
+			if w.Body.String() != test.body {
+				t.Errorf("handler read %q, want %q", w.Body.String(), test.body)
+			}
+			records, err := a.Query(Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("got %d records, want 1", len(records))
+			}
+			rec := records[0]
+			if rec.User != test.user || rec.Method != test.method || rec.Status != test.status || rec.Route != test.route || rec.Path != r.URL.Path {
+				t.Errorf("got record %+v", rec)
+			}
+			if !reflect.DeepEqual(rec.Params, test.params) {
+				t.Errorf("got params %v, want %v", rec.Params, test.params)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRecordsRefused(t *testing.T) {
+	a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+	router := newTestRouter(t, a)
+	wrongPassword := httptest.NewRequest("DELETE", "/api/network/wifi/home", nil)
+	wrongPassword.SetBasicAuth("alice", "wrong-password")
+	for _, r := range []*http.Request{wrongPassword, httptest.NewRequest("DELETE", "/api/network/wifi/home", nil)} {
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	records, err := a.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	for i, user := range []string{"alice", ""} {
+		if rec := records[i]; rec.User != user || rec.Status != http.StatusUnauthorized || rec.Route != "/api/network/wifi/{ssid}" {
+			t.Errorf("got record %+v", rec)
+		}
+	}
+}
+
+func TestMiddlewareSkipsReads(t *testing.T) {
+	a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+	router := newTestRouter(t, a)
+	for _, method := range []string{"GET", "HEAD", "OPTIONS"} {
+		r := httptest.NewRequest(method, "/api/network/wifi/home", nil)
+		r.SetBasicAuth("alice", "alice-password")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	records, err := a.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("got records %+v", records)
+	}
+}
+
+func TestQueryHandler(t *testing.T) {
+	a := newTestLog(t, DefaultMaxSize, DefaultMaxBackups)
+	router := newTestRouter(t, a)
+	for _, path := range []string{"/api/network/wifi/home", "/api/network/wifi/work"} {
+		r := httptest.NewRequest("DELETE", path, nil)
+		r.SetBasicAuth("alice", "alice-password")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		want   int
+	}{
+		{"", http.StatusOK, 2},
+		{"?route=/api/network/wifi/work", http.StatusOK, 1},
+		{"?from=2000-01-01T00:00:00Z&to=2001-01-01T00:00:00Z", http.StatusOK, 0},
+		{"?from=yesterday", http.StatusBadRequest, 0},
+		{"?to=2026-01-01", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/audit"+test.query, nil)
+			r.SetBasicAuth("alice", "alice-password")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d, body %q", w.Code, test.status, w.Body.String())
+			}
+			if test.status != http.StatusOK {
+				var resp api.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != "bad_request" {
+					t.Errorf("got %q, %v", w.Body.String(), err)
+				}
+				return
+			}
+			var records []Record
+			if err := json.NewDecoder(w.Body).Decode(&records); err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != test.want {
+				t.Errorf("got %d records, want %d", len(records), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// ChangePasswordRoute is the name the change password route must be
+	// registered with, it is the only route a user can call until they have
+	// changed a default password.
+	ChangePasswordRoute = "change-password"
+
+	// LoginRoute is the name the login route must be registered with, it can
+	// be called without any credentials.
+	LoginRoute = "login"
+
+	// realm is sent to Basic clients when their credentials aren't accepted.
+	realm = "managementd"
+)
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	tokenKey
+	sessionIDKey
+	recordedUserKey
+)
+
+// UserFromContext returns the user that made the request.
+func UserFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey).(User)
+	return u, ok
+}
+
+// RecordUser is for middleware that runs before RequireUser, so that it also
+// sees the requests RequireUser refuses. RequireUser records the user in the
+// returned request, and the returned function gives that user once the
+// request has been handled.
+func RecordUser(r *http.Request) (*http.Request, func() (User, bool)) {
+	var recorded *User
+	ctx := context.WithValue(r.Context(), recordedUserKey, &recorded)
+	return r.WithContext(ctx), func() (User, bool) {
+		if recorded == nil {
+			return User{}, false
+		}
+		return *recorded, true
+	}
+}
+
+// SessionFromContext returns the ID of the session the request was made
+// with, if it was made with a session token.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionIDKey).(string)
+	return id, ok
+}
+
+// RequireUser is middleware that only lets through requests from a known
+// user. A session token can be given as a bearer token or in the session
+// cookie, Basic credentials are still accepted for scripts and older apps.
+func (a *Authenticator) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if routeName(r) == LoginRoute {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		var user User
+		var err error
+		if token := sessionToken(r); token != "" {
+			// Session tokens can't be guessed, and stale ones are sent by
+			// every open page after a restart, so they aren't throttled.
+			var id string
+			id, user, err = a.sessionUser(token)
+			ctx = context.WithValue(ctx, tokenKey, token)
+			ctx = context.WithValue(ctx, sessionIDKey, id)
+		} else if name, password, ok := r.BasicAuth(); ok {
+			ip := clientIP(r)
+			if wait := a.throttle.wait(ip); wait > 0 {
+				tooManyRequests(w, wait)
+				return
+			}
+			user, err = a.Authenticate(name, password)
+			if err != nil {
+				a.throttle.failure(ip)
+			} else {
+				a.throttle.success(ip)
+			}
+		} else {
+			err = ErrInvalidCredentials
+		}
+		if err != nil {
+			// Ask Basic clients to prompt for credentials again. Pages with a
+			// stale session sign in on their own, so browsers aren't asked to.
+			if _, ok := ctx.Value(tokenKey).(string); !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			}
+			api.WriteError(w, http.StatusUnauthorized, err.Error(), nil)
+			return
+		}
+		if recorded, ok := ctx.Value(recordedUserKey).(**User); ok {
+			*recorded = &user
+		}
+		if user.MustChangePassword && routeName(r) != ChangePasswordRoute {
+			api.WriteError(w, http.StatusForbidden, "password must be changed before using the API", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, userKey, user)))
+	})
+}
+
+func routeName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	return route.GetName()
+}
+
+// sessionToken returns the bearer token or session cookie of the request.
+func sessionToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// LoginHandler checks a user's password and starts a session. The token is
+// returned and set as a cookie so that it is also sent when opening the
+// websocket, which browsers won't add headers to.
+func (a *Authenticator) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	ip := clientIP(r)
+	if wait := a.throttle.wait(ip); wait > 0 {
+		tooManyRequests(w, wait)
+		return
+	}
+	token, expires, err := a.Login(req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		log.Printf("failed login for '%s' from %s", req.Username, ip)
+		a.throttle.failure(ip)
+		api.WriteError(w, http.StatusForbidden, err.Error(), nil)
+		return
+	} else if err != nil {
+		log.Printf("failed to start session for '%s': %v", req.Username, err)
+		api.WriteError(w, http.StatusInternalServerError, "failed to start session", nil)
+		return
+	}
+	a.throttle.success(ip)
+	user, _ := a.SessionUser(token)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":              token,
+		"expires":            expires.Format(time.RFC3339),
+		"user":               user.Name,
+		"role":               user.Role,
+		"mustChangePassword": user.MustChangePassword,
+	})
+}
+
+// LogoutHandler revokes the session used to make the request.
+func (a *Authenticator) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   SessionCookie,
+		Path:   "/",
+		MaxAge: -1,
+	})
+	token, ok := r.Context().Value(tokenKey).(string)
+	if !ok {
+		api.WriteError(w, http.StatusBadRequest, "request was not made with a session token", nil)
+		return
+	}
+	if err := a.Logout(token); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RevokeSessionsHandler revokes every session of the user named in the route.
+func (a *Authenticator) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["user"]
+	count, err := a.RevokeSessions(name)
+	if err != nil {
+		api.WriteError(w, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	log.Printf("revoked %d sessions of user '%s'", count, name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"revoked": count})
+}
+
+// ChangePasswordHandler changes the password of the user making the request.
+func (a *Authenticator) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		api.WriteError(w, http.StatusForbidden, ErrInvalidCredentials.Error(), nil)
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	ip := clientIP(r)
+	if wait := a.throttle.wait(ip); wait > 0 {
+		tooManyRequests(w, wait)
+		return
+	}
+	err := a.ChangePassword(user.Name, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, ErrInvalidCredentials) {
+		a.throttle.failure(ip)
+	}
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrPasswordTooShort), errors.Is(err, ErrPasswordUnchanged):
+		api.WriteError(w, http.StatusBadRequest, err.Error(), nil)
+	default:
+		log.Printf("failed to change password for '%s': %v", user.Name, err)
+		api.WriteError(w, http.StatusInternalServerError, "failed to change password", nil)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+)
+
+// Role is what a user is allowed to do with the API. Each role can do
+// everything the roles below it can.
+type Role string
+
+const (
+	// Viewer can look at the camera and the state of the device.
+	Viewer Role = "viewer"
+	// Operator can also do the jobs needed when deploying a device, such as
+	// setting its location and making test recordings.
+	Operator Role = "operator"
+	// Admin can change anything, including the config, networking and
+	// rebooting or updating the device.
+	Admin Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	Viewer:   1,
+	Operator: 2,
+	Admin:    3,
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Includes reports whether r has all the permissions of other.
+func (r Role) Includes(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+// RequireRole wraps a handler so that it can only be called by users with at
+// least the given role. It must be used behind RequireUser.
+func (a *Authenticator) RequireRole(role Role, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			api.WriteError(w, http.StatusForbidden, ErrInvalidCredentials.Error(), nil)
+			return
+		}
+		if !user.Role.Includes(role) {
+			api.WriteError(w, http.StatusForbidden,
+				fmt.Sprintf("user '%s' with role '%s' needs the '%s' role for this request", user.Name, user.Role, role),
+				map[string]string{"missingPermission": string(role)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,210 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionCookie is the name of the cookie a session token is set in on login.
+	SessionCookie = "managementd-session"
+
+	// SessionLifetime is how long a session token is valid for after logging in.
+	SessionLifetime = 12 * time.Hour
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// session is a token that has been issued and not yet revoked.
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// Sessions are kept in memory and signed with a key generated at startup, so
+// restarting managementd logs everyone out.
+func newSessionKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Login checks the password and issues a session token for the user.
+func (a *Authenticator) Login(name, password string) (string, time.Time, error) {
+	if _, err := a.Authenticate(name, password); err != nil {
+		return "", time.Time{}, err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", time.Time{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	expires := time.Now().Add(SessionLifetime).Truncate(time.Second)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pruneSessions()
+	a.sessions[id] = session{user: name, expires: expires}
+	return a.signToken(id, name, expires), expires, nil
+}
+
+// signToken makes a token of the form payload.signature, where the payload
+// holds the session ID, user name and expiry.
+func (a *Authenticator) signToken(id, name string, expires time.Time) string {
+	payload := id + ":" + strconv.FormatInt(expires.Unix(), 10) + ":" + name
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseToken checks the signature and expiry of a token and returns its session ID.
+func (a *Authenticator) parseToken(token string) (string, error) {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSession
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", ErrInvalidSession
+	}
+	parts := strings.SplitN(string(payload), ":", 3)
+	if len(parts) != 3 {
+		return "", ErrInvalidSession
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return "", ErrInvalidSession
+	}
+	return parts[0], nil
+}
+
+// SessionUser returns the user a session token was issued to, if the token
+// is valid and hasn't been revoked.
+func (a *Authenticator) SessionUser(token string) (User, error) {
+	_, u, err := a.sessionUser(token)
+	return u, err
+}
+
+// sessionUser returns the session ID of a token as well as its user.
+func (a *Authenticator) sessionUser(token string) (string, User, error) {
+	id, err := a.parseToken(token)
+	if err != nil {
+		return "", User{}, err
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	s, ok := a.sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		return "", User{}, ErrInvalidSession
+	}
+	u, ok := a.users[s.user]
+	if !ok {
+		return "", User{}, ErrInvalidSession
+	}
+	return id, *u, nil
+}
+
+// OnRevoke sets f to be called with the IDs of sessions after they are
+// revoked, by logging out, revoking a user's sessions or changing their
+// password, so that connections opened with them can be closed. It has to
+// be set before any requests are handled.
+func (a *Authenticator) OnRevoke(f func(ids []string)) {
+	a.onRevoke = f
+}
+
+func (a *Authenticator) revoked(ids []string) {
+	if a.onRevoke != nil && len(ids) > 0 {
+		a.onRevoke(ids)
+	}
+}
+
+// Logout revokes a single session token.
+func (a *Authenticator) Logout(token string) error {
+	id, err := a.parseToken(token)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	_, ok := a.sessions[id]
+	delete(a.sessions, id)
+	a.mu.Unlock()
+	if !ok {
+		return ErrInvalidSession
+	}
+	a.revoked([]string{id})
+	return nil
+}
+
+// RevokeSessions revokes all sessions of a user and returns how many there were.
+func (a *Authenticator) RevokeSessions(name string) (int, error) {
+	a.mu.Lock()
+	if _, ok := a.users[name]; !ok {
+		a.mu.Unlock()
+		return 0, fmt.Errorf("unknown user '%s'", name)
+	}
+	ids := a.revokeSessions(name)
+	a.mu.Unlock()
+	a.revoked(ids)
+	return len(ids), nil
+}
+
+// revokeSessions returns the IDs of the sessions it revoked. Must be called
+// with a.mu held.
+func (a *Authenticator) revokeSessions(name string) []string {
+	var ids []string
+	for id, s := range a.sessions {
+		if s.user == name {
+			delete(a.sessions, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// pruneSessions removes expired sessions. Must be called with a.mu held.
+func (a *Authenticator) pruneSessions() {
+	now := time.Now()
+	for id, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// changedAuthenticator has the default admin user with its password
+// changed to "new-password".
+func changedAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a := defaultAuthenticator(t)
+	if err := a.ChangePassword(defaultUser, defaultPassword, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func login(t *testing.T, a *Authenticator) string {
+	t.Helper()
+	token, _, err := a.Login(defaultUser, "new-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSessionTokens(t *testing.T) {
+	a := changedAuthenticator(t)
+	token, expires, err := a.Login(defaultUser, "new-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := time.Until(expires); lifetime <= SessionLifetime-time.Minute || lifetime > SessionLifetime {
+		t.Errorf("session expires in %v", lifetime)
+	}
+	if _, _, err := a.Login(defaultUser, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got %v logging in with the wrong password", err)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	data, _ := base64.RawURLEncoding.DecodeString(payload)
+	id, _, _ := strings.Cut(string(data), ":")
+	otherKey := defaultAuthenticator(t)
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", token, nil},
+		{"empty", "", ErrInvalidSession},
+		{"no signature", payload, ErrInvalidSession},
+		{"not base64", "!!!." + sig, ErrInvalidSession},
+		{"changed payload", base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(data), defaultUser, "root", 1))) + "." + sig, ErrInvalidSession},
+		{"signed with another key", otherKey.signToken(id, defaultUser, expires), ErrInvalidSession},
+		{"expired", a.signToken(id, defaultUser, time.Now().Add(-time.Second)), ErrInvalidSession},
+		{"unknown session", a.signToken("0123456789abcdef", defaultUser, expires), ErrInvalidSession},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := a.SessionUser(test.token)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err == nil && (user.Name != defaultUser || user.Role != Admin) {
+				t.Errorf("got user %+v", user)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a := changedAuthenticator(t)
+	var revoked []string
+	a.OnRevoke(func(ids []string) { revoked = append(revoked, ids...) })
+	token := login(t, a)
+	other := login(t, a)
+
+	if err := a.Logout(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SessionUser(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("got %v using a token after logging out", err)
+	}
+	if _, err := a.SessionUser(other); err != nil {
+		t.Errorf("other session was logged out: %v", err)
+	}
+	if err := a.Logout(token); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("got %v logging out twice", err)
+	}
+	if len(revoked) != 1 {
+		t.Errorf("got revoked sessions %q, want the one logged out", revoked)
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(a *Authenticator) error
+	}{
+		{"revoked", func(a *Authenticator) error {
+			count, err := a.RevokeSessions(defaultUser)
+			if err == nil && count != 2 {
+				t.Errorf("revoked %d sessions, want 2", count)
+			}
+			return err
+		}},
+		{"password changed", func(a *Authenticator) error {
+			return a.ChangePassword(defaultUser, "new-password", "another-password")
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := changedAuthenticator(t)
+			var revoked []string
+			a.OnRevoke(func(ids []string) { revoked = append(revoked, ids...) })
+			tokens := []string{login(t, a), login(t, a)}
+			if err := test.revoke(a); err != nil {
+				t.Fatal(err)
+			}
+			for _, token := range tokens {
+				if _, err := a.SessionUser(token); !errors.Is(err, ErrInvalidSession) {
+					t.Errorf("got %v using a revoked token", err)
+				}
+			}
+			if len(revoked) != 2 || revoked[0] == revoked[1] {
+				t.Errorf("got revoked sessions %q, want both", revoked)
+			}
+		})
+	}
+
+	a := changedAuthenticator(t)
+	if _, err := a.RevokeSessions("nobody"); err == nil {
+		t.Error("no error revoking the sessions of an unknown user")
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	a := changedAuthenticator(t)
+	router := testRouter(a)
+	router.HandleFunc("/api/logout", a.LogoutHandler)
+	router.HandleFunc("/api/session", a.LoginHandler).Name(LoginRoute)
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(httptest.NewRequest("POST", "/api/session", strings.NewReader(`{"username": "admin", "password": "wrong-password"}`)))
+	checkError(t, w, http.StatusForbidden)
+
+	w = serve(httptest.NewRequest("POST", "/api/session", strings.NewReader(`{"username": "admin", "password": "new-password"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %q", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+		User  string `json:"user"`
+		Role  Role   `json:"role"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.User != defaultUser || resp.Role != Admin {
+		t.Errorf("got %+v", resp)
+	}
+	cookies := w.Result().Cookies()
+	if !slices.ContainsFunc(cookies, func(c *http.Cookie) bool {
+		return c.Name == SessionCookie && c.Value == resp.Token && c.HttpOnly
+	}) {
+		t.Errorf("session cookie wasn't set, got %v", cookies)
+	}
+
+	// The token can be sent as a bearer token or in the cookie.
+	bearer := httptest.NewRequest("GET", "/api/config", nil)
+	bearer.Header.Set("Authorization", "Bearer "+resp.Token)
+	cookie := httptest.NewRequest("GET", "/api/config", nil)
+	cookie.AddCookie(&http.Cookie{Name: SessionCookie, Value: resp.Token})
+	for _, r := range []*http.Request{bearer, cookie} {
+		if w := serve(r); w.Code != http.StatusOK {
+			t.Errorf("got status %d, body %q", w.Code, w.Body.String())
+		}
+	}
+
+	// Logging out needs a session, not Basic credentials.
+	basic := httptest.NewRequest("POST", "/api/logout", nil)
+	basic.SetBasicAuth(defaultUser, "new-password")
+	checkError(t, serve(basic), http.StatusBadRequest)
+	logout := httptest.NewRequest("POST", "/api/logout", nil)
+	logout.Header.Set("Authorization", "Bearer "+resp.Token)
+	if w := serve(logout); w.Code != http.StatusOK {
+		t.Fatalf("got status %d logging out, body %q", w.Code, w.Body.String())
+	}
+	w = serve(bearer)
+	checkError(t, w, http.StatusUnauthorized)
+	if got := w.Header().Get("WWW-Authenticate"); got != "" {
+		t.Errorf("got WWW-Authenticate %q for a session token", got)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+)
+
+const (
+	// freeFailures is how many failed attempts a client gets before it has
+	// to wait between attempts.
+	freeFailures = 3
+	// maxFailures is how many failed attempts in a row lock a client out.
+	maxFailures    = 10
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+	lockoutTime    = 15 * time.Minute
+)
+
+type clientFailures struct {
+	count       int
+	blockedTill time.Time
+	lastFailure time.Time
+}
+
+// throttle counts failed logins from each client IP, making the client wait
+// longer after each failure and locking it out after too many.
+type throttle struct {
+	mu      sync.Mutex
+	clients map[string]*clientFailures
+	now     func() time.Time
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		clients: map[string]*clientFailures{},
+		now:     time.Now,
+	}
+}
+
+// wait returns how long the client has to wait before it can try again.
+func (t *throttle) wait(ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.clients[ip]
+	if !ok {
+		return 0
+	}
+	if wait := c.blockedTill.Sub(t.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (t *throttle) failure(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.prune(now)
+	c, ok := t.clients[ip]
+	if !ok {
+		c = &clientFailures{}
+		t.clients[ip] = c
+	}
+	c.count++
+	c.lastFailure = now
+	switch {
+	case c.count >= maxFailures:
+		c.blockedTill = now.Add(lockoutTime)
+		log.Printf("locking out %s for %v after %d failed logins", ip, lockoutTime, c.count)
+		c.count = 0
+	case c.count > freeFailures:
+		backoff := time.Duration(float64(initialBackoff) * math.Pow(2, float64(c.count-freeFailures-1)))
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		c.blockedTill = now.Add(backoff)
+		log.Debugf("%d failed logins from %s, blocking for %v", c.count, ip, backoff)
+	}
+}
+
+func (t *throttle) success(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.clients, ip)
+}
+
+// prune forgets clients that haven't failed for a while. Must be called with t.mu held.
+func (t *throttle) prune(now time.Time) {
+	for ip, c := range t.clients {
+		if now.After(c.blockedTill) && now.Sub(c.lastFailure) > lockoutTime {
+			delete(t.clients, ip)
+		}
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyRequests responds with how long the client needs to wait.
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	api.WriteError(w, http.StatusTooManyRequests, fmt.Sprintf("too many failed logins, try again in %d seconds", seconds), nil)
+}
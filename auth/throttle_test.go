@@ -0,0 +1,182 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock sets the throttle's clock to one that only moves when it is
+// advanced.
+func fakeClock(th *throttle) func(time.Duration) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	th.now = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	th := newThrottle()
+	fakeClock(th)
+	tests := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{9, 32 * time.Second},
+		{10, lockoutTime},
+	}
+	failures := 0
+	for _, test := range tests {
+		for ; failures < test.failures; failures++ {
+			th.failure("192.0.2.1")
+		}
+		if got := th.wait("192.0.2.1"); got != test.wait {
+			t.Errorf("after %d failures got wait %v, want %v", test.failures, got, test.wait)
+		}
+	}
+	if got := th.wait("192.0.2.2"); got != 0 {
+		t.Errorf("another client has to wait %v", got)
+	}
+	th.success("192.0.2.1")
+	if got := th.wait("192.0.2.1"); got != 0 {
+		t.Errorf("got wait %v after a success", got)
+	}
+}
+
+func TestThrottleForgetsOldFailures(t *testing.T) {
+	th := newThrottle()
+	advance := fakeClock(th)
+	for range freeFailures {
+		th.failure("192.0.2.1")
+	}
+	advance(lockoutTime + time.Second)
+	// Pruning happens on the next failure, from any client.
+	th.failure("192.0.2.2")
+	th.failure("192.0.2.1")
+	if got := th.wait("192.0.2.1"); got != 0 {
+		t.Errorf("got wait %v, old failures weren't forgotten", got)
+	}
+}
+
+func TestLoginThrottled(t *testing.T) {
+	a := changedAuthenticator(t)
+	advance := fakeClock(a.throttle)
+	router := testRouter(a)
+	router.HandleFunc("/api/session", a.LoginHandler).Name(LoginRoute)
+	login := func(password, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/session", strings.NewReader(`{"username": "admin", "password": "`+password+`"}`))
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	type step struct {
+		password   string
+		ip         string
+		status     int
+		retryAfter string
+		advance    time.Duration
+	}
+	steps := []step{
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		// The fourth failure has to wait a second, then each doubles it.
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		{"new-password", "192.0.2.1", http.StatusTooManyRequests, "1", time.Second},
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		{"wrong-password", "192.0.2.1", http.StatusTooManyRequests, "2", time.Second},
+		{"wrong-password", "192.0.2.1", http.StatusTooManyRequests, "1", time.Second},
+		// Other clients aren't held up.
+		{"wrong-password", "192.0.2.2", http.StatusForbidden, "", 0},
+		// Logging in forgets the failures.
+		{"new-password", "192.0.2.1", http.StatusOK, "", 0},
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+		{"wrong-password", "192.0.2.1", http.StatusForbidden, "", 0},
+	}
+	for i, s := range steps {
+		w := login(s.password, s.ip)
+		if s.status == http.StatusOK {
+			if w.Code != http.StatusOK {
+				t.Fatalf("step %d: got status %d, body %q", i, w.Code, w.Body.String())
+			}
+		} else {
+			checkError(t, w, s.status)
+		}
+		if got := w.Header().Get("Retry-After"); got != s.retryAfter {
+			t.Errorf("step %d: got Retry-After %q, want %q", i, got, s.retryAfter)
+		}
+		advance(s.advance)
+	}
+}
+
+func TestBasicCredentialsThrottled(t *testing.T) {
+	a := changedAuthenticator(t)
+	fakeClock(a.throttle)
+	router := testRouter(a)
+	call := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/config", nil)
+		r.SetBasicAuth(defaultUser, password)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	for range freeFailures + 1 {
+		w := call("wrong-password")
+		checkError(t, w, http.StatusUnauthorized)
+		if got := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, "Basic ") {
+			t.Errorf("got WWW-Authenticate %q", got)
+		}
+	}
+	// Even the right password has to wait.
+	w := call("new-password")
+	checkError(t, w, http.StatusTooManyRequests)
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("got Retry-After %q", got)
+	}
+}
+
+func TestChangePasswordThrottled(t *testing.T) {
+	a := changedAuthenticator(t)
+	fakeClock(a.throttle)
+	router := testRouter(a)
+	router.HandleFunc("/api/password", a.ChangePasswordHandler)
+	token := login(t, a)
+	call := func(current string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/password", strings.NewReader(`{"currentPassword": "`+current+`", "newPassword": "another-password"}`))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	for range freeFailures + 1 {
+		checkError(t, call("wrong-password"), http.StatusBadRequest)
+	}
+	// The current password isn't checked until the wait is over.
+	checkError(t, call("new-password"), http.StatusTooManyRequests)
+}
@@ -0,0 +1,266 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// ConfigKey is the section of the cacophony config that managementd reads its users from.
+	ConfigKey = "managementd"
+
+	// CredentialsFile holds password changes made through the API. go-config
+	// will only write sections it knows about so these are kept separately
+	// and take precedence over the password-hash of a user in the config.
+	CredentialsFile = "managementd-credentials.json"
+
+	defaultUser       = "admin"
+	defaultPassword   = "feathers"
+	minPasswordLength = 8
+)
+
+var log = logging.NewLogger("info")
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrPasswordTooShort   = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrPasswordUnchanged  = errors.New("new password must be different to the current password")
+)
+
+// User is a user allowed to access the management API.
+type User struct {
+	Name               string `mapstructure:"name"`
+	PasswordHash       string `mapstructure:"password-hash"`
+	Role               Role   `mapstructure:"role"`
+	MustChangePassword bool   `mapstructure:"must-change-password"`
+}
+
+// savedPassword is a password change kept in the credentials file.
+type savedPassword struct {
+	Name         string `json:"name"`
+	PasswordHash string `json:"passwordHash"`
+}
+
+// Config is the managementd section of the cacophony config, e.g.
+//
+//	[[managementd.users]]
+//	name = "admin"
+//	password-hash = "$2a$10$..."
+//	role = "admin"
+type Config struct {
+	Users []User `mapstructure:"users"`
+}
+
+// Authenticator checks credentials against the configured users.
+type Authenticator struct {
+	mu              sync.RWMutex
+	users           map[string]*User
+	credentialsPath string
+	savedPasswords  map[string]string
+	sessionKey      []byte
+	sessions        map[string]session
+	throttle        *throttle
+	onRevoke        func(ids []string)
+}
+
+// New loads the users from the managementd config section and any password
+// changes saved in configDir. When no users are configured the legacy default
+// admin user is created and flagged so that its password has to be changed.
+func New(conf *goconfig.Config, configDir string, l *logging.Logger) (*Authenticator, error) {
+	if l != nil {
+		log = l
+	}
+	var c Config
+	if err := conf.Unmarshal(ConfigKey, &c); err != nil {
+		return nil, err
+	}
+	sessionKey, err := newSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	a := &Authenticator{
+		users:           map[string]*User{},
+		credentialsPath: filepath.Join(configDir, CredentialsFile),
+		savedPasswords:  map[string]string{},
+		sessionKey:      sessionKey,
+		sessions:        map[string]session{},
+		throttle:        newThrottle(),
+	}
+	for i := range c.Users {
+		u := c.Users[i]
+		if u.Name == "" || u.PasswordHash == "" {
+			return nil, fmt.Errorf("%s user %d is missing a name or password-hash", ConfigKey, i)
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("invalid password-hash for user '%s': %v", u.Name, err)
+		}
+		if u.Role == "" {
+			log.Printf("no role set for user '%s', defaulting to '%s'", u.Name, Viewer)
+			u.Role = Viewer
+		}
+		if !u.Role.Valid() {
+			return nil, fmt.Errorf("invalid role '%s' for user '%s'", u.Role, u.Name)
+		}
+		a.users[u.Name] = &u
+	}
+
+	if len(a.users) == 0 {
+		log.Printf("no %s users configured, using default '%s' user until its password is changed", ConfigKey, defaultUser)
+		hash, err := HashPassword(defaultPassword)
+		if err != nil {
+			return nil, err
+		}
+		a.users[defaultUser] = &User{
+			Name:               defaultUser,
+			PasswordHash:       hash,
+			Role:               Admin,
+			MustChangePassword: true,
+		}
+	}
+
+	saved, err := readCredentialsFile(a.credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range saved {
+		a.savedPasswords[p.Name] = p.PasswordHash
+		if u, ok := a.users[p.Name]; ok {
+			u.PasswordHash = p.PasswordHash
+			u.MustChangePassword = false
+		}
+	}
+	return a, nil
+}
+
+// HashPassword returns the bcrypt hash of password, in the format expected for
+// password-hash in the config.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Authenticate returns a copy of the user if the password matches. bcrypt is
+// deliberately slow, so callers handling requests should check the client
+// isn't being throttled first.
+func (a *Authenticator) Authenticate(name, password string) (User, error) {
+	a.mu.RLock()
+	u, ok := a.users[name]
+	var user User
+	if ok {
+		user = *u
+	}
+	a.mu.RUnlock()
+
+	if !ok {
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ChangePassword sets a new password for the user after checking the current one.
+func (a *Authenticator) ChangePassword(name, currentPassword, newPassword string) error {
+	if _, err := a.Authenticate(name, currentPassword); err != nil {
+		return err
+	}
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if newPassword == currentPassword || newPassword == defaultPassword {
+		return ErrPasswordUnchanged
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The sessions are revoked after the lock is released.
+	var revoked []string
+	defer func() { a.revoked(revoked) }()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, ok := a.users[name]
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	previous, hadSaved := a.savedPasswords[name]
+	a.savedPasswords[name] = hash
+	if err := a.saveCredentials(); err != nil {
+		if hadSaved {
+			a.savedPasswords[name] = previous
+		} else {
+			delete(a.savedPasswords, name)
+		}
+		return err
+	}
+	u.PasswordHash = hash
+	u.MustChangePassword = false
+	// Sessions started with the old password shouldn't outlive it.
+	revoked = a.revokeSessions(name)
+	log.Printf("password changed for user '%s'", name)
+	return nil
+}
+
+// saveCredentials writes the changed passwords to the credentials file. Must be called with a.mu held.
+func (a *Authenticator) saveCredentials() error {
+	saved := []savedPassword{}
+	for name, hash := range a.savedPasswords {
+		saved = append(saved, savedPassword{Name: name, PasswordHash: hash})
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Name < saved[j].Name })
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.credentialsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.credentialsPath)
+}
+
+func readCredentialsFile(path string) ([]savedPassword, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var saved []savedPassword
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,352 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestAuthenticator loads the users from the config in dir, which is
+// written first if it isn't there.
+func newTestAuthenticator(t *testing.T, dir, config string) (*Authenticator, error) {
+	t.Helper()
+	path := filepath.Join(dir, goconfig.ConfigFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, err := goconfig.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(conf, dir, logging.NewLogger("error"))
+}
+
+// defaultAuthenticator has only the default admin user.
+func defaultAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a, err := newTestAuthenticator(t, t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// checkError checks the response is an error envelope.
+func checkError(t *testing.T, w *httptest.ResponseRecorder, status int) api.ErrorResponse {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d, body %q", w.Code, status, w.Body.String())
+	}
+	var resp api.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if resp.Code == "" || resp.Message == "" {
+		t.Errorf("unexpected error response %+v", resp)
+	}
+	return resp
+}
+
+func TestHashPassword(t *testing.T) {
+	hash := hashPassword(t, "secret-password")
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("secret-password")); err != nil {
+		t.Errorf("hash doesn't match the password: %v", err)
+	}
+	if strings.Contains(hash, "secret-password") {
+		t.Error("hash contains the password")
+	}
+	if hashPassword(t, "secret-password") == hash {
+		t.Error("hashes of the same password aren't salted")
+	}
+}
+
+func TestNewUsers(t *testing.T) {
+	hash := hashPassword(t, "secret-password")
+	tests := []struct {
+		name   string
+		config string
+		want   map[string]Role
+		err    string
+	}{
+		{
+			name: "default admin",
+			want: map[string]Role{"admin": Admin},
+		},
+		{
+			name: "configured users",
+			config: `[[managementd.users]]
+name = "alice"
+password-hash = "` + hash + `"
+role = "admin"
+[[managementd.users]]
+name = "bob"
+password-hash = "` + hash + `"
+role = "operator"`,
+			want: map[string]Role{"alice": Admin, "bob": Operator},
+		},
+		{
+			name: "role defaults to viewer",
+			config: `[[managementd.users]]
+name = "carol"
+password-hash = "` + hash + `"`,
+			want: map[string]Role{"carol": Viewer},
+		},
+		{
+			name: "invalid role",
+			config: `[[managementd.users]]
+name = "dave"
+password-hash = "` + hash + `"
+role = "owner"`,
+			err: "invalid role 'owner'",
+		},
+		{
+			name: "missing password hash",
+			config: `[[managementd.users]]
+name = "erin"`,
+			err: "missing a name or password-hash",
+		},
+		{
+			name: "plain text password",
+			config: `[[managementd.users]]
+name = "frank"
+password-hash = "secret-password"`,
+			err: "invalid password-hash for user 'frank'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := newTestAuthenticator(t, t.TempDir(), test.config)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]Role{}
+			for name, u := range a.users {
+				got[name] = u.Role
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got users %v, want %v", got, test.want)
+			}
+			for name, role := range test.want {
+				if got[name] != role {
+					t.Errorf("got users %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultPasswordMustBeChanged(t *testing.T) {
+	dir := t.TempDir()
+	a, err := newTestAuthenticator(t, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := a.Authenticate(defaultUser, defaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.MustChangePassword {
+		t.Error("default password doesn't have to be changed")
+	}
+
+	tests := []struct {
+		name     string
+		current  string
+		new      string
+		err      error
+		password string
+	}{
+		{"wrong current password", "wrong-password", "new-password", ErrInvalidCredentials, defaultPassword},
+		{"too short", defaultPassword, "short", ErrPasswordTooShort, defaultPassword},
+		{"same as current", defaultPassword, defaultPassword, ErrPasswordUnchanged, defaultPassword},
+		{"changed", defaultPassword, "new-password", nil, "new-password"},
+		{"back to the default", "new-password", defaultPassword, ErrPasswordUnchanged, "new-password"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := a.ChangePassword(defaultUser, test.current, test.new); !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			user, err := a.Authenticate(defaultUser, test.password)
+			if err != nil {
+				t.Fatalf("password is not %q: %v", test.password, err)
+			}
+			if user.MustChangePassword != (test.password == defaultPassword) {
+				t.Errorf("got MustChangePassword %v", user.MustChangePassword)
+			}
+		})
+	}
+	if _, err := a.Authenticate(defaultUser, defaultPassword); err == nil {
+		t.Error("default password still works")
+	}
+
+	// The change is kept in the credentials file, which only managementd
+	// can read, and loaded on the next start.
+	path := filepath.Join(dir, CredentialsFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credentials file has permissions %v", perm)
+	}
+	saved, err := readCredentialsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Name != defaultUser || bcrypt.CompareHashAndPassword([]byte(saved[0].PasswordHash), []byte("new-password")) != nil {
+		t.Errorf("got saved credentials %+v", saved)
+	}
+	restarted, err := newTestAuthenticator(t, dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = restarted.Authenticate(defaultUser, "new-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MustChangePassword {
+		t.Error("password has to be changed again after a restart")
+	}
+}
+
+func TestSavedPasswordOverridesConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := `[[managementd.users]]
+name = "alice"
+password-hash = "` + hashPassword(t, "config-password") + `"
+role = "admin"`
+	a, err := newTestAuthenticator(t, dir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ChangePassword("alice", "config-password", "saved-password"); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := newTestAuthenticator(t, dir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Authenticate("alice", "config-password"); err == nil {
+		t.Error("password from the config still works")
+	}
+	if _, err := restarted.Authenticate("alice", "saved-password"); err != nil {
+		t.Errorf("saved password doesn't work: %v", err)
+	}
+}
+
+func TestInvalidCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, CredentialsFile), []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestAuthenticator(t, dir, ""); err == nil {
+		t.Error("no error for an invalid credentials file")
+	}
+}
+
+// testRouter has the routes that RequireUser treats specially, and one
+// that it doesn't.
+func testRouter(a *Authenticator) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(a.RequireUser)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc("/api/login", ok).Name(LoginRoute)
+	router.HandleFunc("/api/change-password", ok).Name(ChangePasswordRoute)
+	router.HandleFunc("/api/config", ok)
+	return router
+}
+
+func TestMustChangePasswordBlocksRoutes(t *testing.T) {
+	a := defaultAuthenticator(t)
+	router := testRouter(a)
+	call := func(route string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", route, nil)
+		r.SetBasicAuth(defaultUser, defaultPassword)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		route  string
+		status int
+	}{
+		{"/api/login", http.StatusOK},
+		{"/api/change-password", http.StatusOK},
+		{"/api/config", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.route, func(t *testing.T) {
+			w := call(test.route)
+			if test.status == http.StatusOK {
+				if w.Code != http.StatusOK {
+					t.Fatalf("got status %d, body %q", w.Code, w.Body.String())
+				}
+				return
+			}
+			if resp := checkError(t, w, test.status); !strings.Contains(resp.Message, "password must be changed") {
+				t.Errorf("got %+v", resp)
+			}
+		})
+	}
+
+	if err := a.ChangePassword(defaultUser, defaultPassword, "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	// The old password no longer works anywhere but the login route.
+	checkError(t, call("/api/config"), http.StatusUnauthorized)
+	r := httptest.NewRequest("GET", "/api/config", nil)
+	r.SetBasicAuth(defaultUser, "new-password")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d after changing the password, body %q", w.Code, w.Body.String())
+	}
+}
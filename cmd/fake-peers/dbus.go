@@ -0,0 +1,209 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/godbus/dbus"
+)
+
+const (
+	tc2AgentName        = "org.cacophony.TC2Agent"
+	thermalRecorderName = "org.cacophony.thermalrecorder"
+	modemdName          = "org.cacophony.modemd"
+	rtcName             = "org.cacophony.RTC"
+	// controlName is the interface used to change the state of fake-peers
+	// while it is running.
+	controlName = "org.cacophony.FakePeers"
+
+	rtcTimeFormat = "2006-01-02T15:04:05Z07:00"
+)
+
+// objectPath returns the path of the object for a service, which is named
+// after the service as on the device.
+func objectPath(name string) dbus.ObjectPath {
+	return dbus.ObjectPath("/" + strings.ReplaceAll(name, ".", "/"))
+}
+
+// export puts the fakes on the bus with the names, paths and method names
+// that the real services use.
+func export(conn *dbus.Conn, fakes *peers.Fakes, control *control) error {
+	objects := []struct {
+		name    string
+		object  interface{}
+		methods map[string]string
+	}{
+		{tc2AgentName, tc2Agent{fakes.TC2Agent}, tc2AgentMethods},
+		{thermalRecorderName, thermalRecorder{fakes.ThermalRecorder}, nil},
+		{modemdName, modemd{fakes.Modemd}, nil},
+		{rtcName, rtc{fakes.RTC}, nil},
+		{controlName, control, nil},
+	}
+	for _, o := range objects {
+		if err := conn.ExportWithMap(o.object, o.methods, objectPath(o.name), o.name); err != nil {
+			return err
+		}
+		reply, err := conn.RequestName(o.name, dbus.NameFlagDoNotQueue)
+		if err != nil {
+			return err
+		}
+		if reply != dbus.RequestNameReplyPrimaryOwner {
+			return fmt.Errorf("%s is already on the bus", o.name)
+		}
+	}
+	return nil
+}
+
+func dbusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.MakeFailedError(err)
+}
+
+// tc2Agent has the methods of tc2-agent, which are all lower case.
+type tc2Agent struct {
+	agent peers.TC2Agent
+}
+
+var tc2AgentMethods = map[string]string{
+	"AudioStatus":               "audiostatus",
+	"LongAudioRecording":        "longaudiorecording",
+	"TestAudio":                 "testaudio",
+	"TestThermalStatus":         "testthermalstatus",
+	"LongTestThermalRecording":  "longtestthermalrecording",
+	"ShortTestThermalRecording": "shorttestthermalrecording",
+	"OffloadStatus":             "offloadstatus",
+	"CancelOffload":             "canceloffload",
+	"ForceRP2040Offload":        "forcerp2040offload",
+	"PrioritiseFrameServe":      "prioritiseframeserve",
+}
+
+func (a tc2Agent) AudioStatus() (int32, int32, *dbus.Error) {
+	s, err := a.agent.AudioStatus()
+	return int32(s.Mode), int32(s.Status), dbusError(err)
+}
+
+func (a tc2Agent) LongAudioRecording(seconds uint64) (string, *dbus.Error) {
+	result, err := a.agent.LongAudioRecording(seconds)
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) TestAudio() (string, *dbus.Error) {
+	result, err := a.agent.TestAudioRecording()
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) TestThermalStatus() (int32, int32, *dbus.Error) {
+	s, err := a.agent.ThermalStatus()
+	return int32(s.Mode), int32(s.Status), dbusError(err)
+}
+
+func (a tc2Agent) LongTestThermalRecording(seconds uint64) (string, *dbus.Error) {
+	result, err := a.agent.LongThermalRecording(seconds)
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) ShortTestThermalRecording() (string, *dbus.Error) {
+	result, err := a.agent.ShortThermalRecording()
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) OffloadStatus() (int32, int32, int32, int32, int32, int32, int32, *dbus.Error) {
+	s, err := a.agent.OffloadStatus()
+	inProgress := 0
+	if s.InProgress {
+		inProgress = 1
+	}
+	return int32(inProgress), int32(s.PercentComplete), int32(s.SecondsRemaining),
+		int32(s.FilesTotal), int32(s.FilesRemaining), int32(s.EventsTotal), int32(s.EventsRemaining),
+		dbusError(err)
+}
+
+func (a tc2Agent) CancelOffload() (string, *dbus.Error) {
+	result, err := a.agent.CancelOffload()
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) ForceRP2040Offload() (string, *dbus.Error) {
+	result, err := a.agent.ForceOffload()
+	return result, dbusError(err)
+}
+
+func (a tc2Agent) PrioritiseFrameServe() (string, *dbus.Error) {
+	result, err := a.agent.PrioritiseFrameServe()
+	return result, dbusError(err)
+}
+
+type thermalRecorder struct {
+	recorder peers.ThermalRecorder
+}
+
+func (t thermalRecorder) TakeSnapshot() *dbus.Error {
+	return dbusError(t.recorder.TakeSnapshot())
+}
+
+func (t thermalRecorder) TakeTestRecording() *dbus.Error {
+	return dbusError(t.recorder.TakeTestRecording())
+}
+
+type modemd struct {
+	modem peers.Modemd
+}
+
+func (m modemd) GetStatus() (map[string]dbus.Variant, *dbus.Error) {
+	status, err := m.modem.Status()
+	if err != nil {
+		return nil, dbusError(err)
+	}
+	values := map[string]dbus.Variant{}
+	for k, v := range status {
+		values[k] = dbus.MakeVariant(v)
+	}
+	return values, nil
+}
+
+func (m modemd) StayOnFor(minutes int32) *dbus.Error {
+	return dbusError(m.modem.StayOnFor(int(minutes)))
+}
+
+func (m modemd) SetAPN(apn string) *dbus.Error {
+	return dbusError(m.modem.SetAPN(apn))
+}
+
+type rtc struct {
+	clock peers.RTC
+}
+
+func (r rtc) GetTime() (string, bool, *dbus.Error) {
+	t, integrity, err := r.clock.Time()
+	return t.Format(rtcTimeFormat), integrity, dbusError(err)
+}
+
+func (r rtc) SetTime(t string) *dbus.Error {
+	rtcTime, err := time.Parse(rtcTimeFormat, t)
+	if err != nil {
+		return dbusError(err)
+	}
+	return dbusError(r.clock.SetTime(rtcTime))
+}
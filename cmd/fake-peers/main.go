@@ -0,0 +1,92 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// fake-peers puts simulated versions of tc2-agent, thermal-recorder, modemd
+// and the RTC service on a bus, so that managementd can be run without a
+// TC2. Run managementd with --bus set to the same bus to use them.
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/alexflint/go-arg"
+)
+
+var log = logging.NewLogger("info")
+
+type Args struct {
+	Bus    string `arg:"--bus" default:"session" help:"bus to use: system, session or the address of a bus"`
+	Script string `arg:"--script" help:"JSON file with the state to start with and the steps to change it over time"`
+	Set    string `arg:"--set" help:"apply a JSON state to the fake-peers running on the bus and exit"`
+	Get    bool   `arg:"--get" help:"print the state of the fake-peers running on the bus and exit"`
+	logging.LogArgs
+}
+
+func main() {
+	var args Args
+	arg.MustParse(&args)
+	log = logging.NewLogger(args.LogLevel)
+	if err := runMain(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runMain(args Args) error {
+	conn, err := peers.BusConnect(args.Bus)()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the %s bus: %v", args.Bus, err)
+	}
+	running := conn.Object(controlName, objectPath(controlName))
+	switch {
+	case args.Set != "":
+		return running.Call(controlName+".SetState", 0, args.Set).Err
+	case args.Get:
+		var state string
+		if err := running.Call(controlName+".GetState", 0).Store(&state); err != nil {
+			return err
+		}
+		fmt.Println(state)
+		return nil
+	}
+
+	fakes := peers.NewFakes()
+	var script Script
+	if args.Script != "" {
+		if script, err = readScript(args.Script); err != nil {
+			return err
+		}
+	}
+	if err := script.State.apply(fakes); err != nil {
+		return err
+	}
+	if err := export(conn, fakes, &control{fakes}); err != nil {
+		return err
+	}
+	log.Printf("fake tc2-agent, thermal-recorder, modemd and RTC are on the %s bus", args.Bus)
+	go script.run(fakes)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	return nil
+}
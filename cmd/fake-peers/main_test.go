@@ -0,0 +1,194 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/godbus/dbus"
+)
+
+// startBus runs a private bus for a test, which is skipped when dbus-daemon
+// isn't installed.
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon isn't installed")
+	}
+	socket := filepath.Join(t.TempDir(), "bus")
+	address := "unix:path=" + socket
+	cmd := exec.Command(daemon, "--session", "--nofork", "--address="+address)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	// The socket is created before dbus-daemon listens on it.
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return address
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("dbus-daemon didn't start")
+	return ""
+}
+
+func TestFakePeers(t *testing.T) {
+	address := startBus(t)
+	conn, err := peers.BusConnect(address)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakes := peers.NewFakes()
+	if err := export(conn, fakes, &control{fakes}); err != nil {
+		t.Fatal(err)
+	}
+	// managementd has its own connection to the bus.
+	clientConn, err := peers.BusConnect(address)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := peers.NewDBus(func() (*dbus.Conn, error) { return clientConn, nil })
+	running := clientConn.Object(controlName, objectPath(controlName))
+	setState := func(state string) error {
+		return running.Call(controlName+".SetState", 0, state).Err
+	}
+
+	rtcTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := setState(`{
+		"audioStatus": {"Mode": 2, "Status": 3},
+		"offload": {"InProgress": true, "PercentComplete": 40, "SecondsRemaining": 90, "FilesTotal": 10, "FilesRemaining": 6},
+		"modem": {"powered": true},
+		"rtcTime": "2030-01-02T03:04:05Z",
+		"rtcIntegrity": false
+	}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := p.TC2Agent.AudioStatus(); err != nil || s != (peers.RP2040Status{Mode: 2, Status: 3}) {
+		t.Errorf("got audio status %+v, %v", s, err)
+	}
+	wantOffload := peers.OffloadStatus{InProgress: true, PercentComplete: 40, SecondsRemaining: 90, FilesTotal: 10, FilesRemaining: 6}
+	if s, err := p.TC2Agent.OffloadStatus(); err != nil || s != wantOffload {
+		t.Errorf("got offload status %+v, %v", s, err)
+	}
+	if result, err := p.TC2Agent.CancelOffload(); err != nil || result != "ok" {
+		t.Errorf("got %q, %v", result, err)
+	}
+	if s, _ := p.TC2Agent.OffloadStatus(); s.InProgress {
+		t.Error("offload wasn't cancelled")
+	}
+
+	if status, err := p.Modemd.Status(); err != nil || status["powered"] != true {
+		t.Errorf("got modem status %v, %v", status, err)
+	}
+	if err := p.Modemd.StayOnFor(5); err != nil {
+		t.Error(err)
+	}
+	if err := p.Modemd.SetAPN("internet"); err != nil {
+		t.Error(err)
+	}
+
+	if now, integrity, err := p.RTC.Time(); err != nil || integrity || now.Sub(rtcTime) < 0 || now.Sub(rtcTime) > time.Minute {
+		t.Errorf("got RTC time %v, %v, %v", now, integrity, err)
+	}
+	if err := p.RTC.SetTime(rtcTime.Add(time.Hour)); err != nil {
+		t.Error(err)
+	}
+	if _, integrity, _ := p.RTC.Time(); !integrity {
+		t.Error("setting the RTC time didn't restore its integrity")
+	}
+
+	if err := p.ThermalRecorder.TakeSnapshot(); err != nil {
+		t.Error(err)
+	}
+
+	var stateJSON string
+	if err := running.Call(controlName+".GetState", 0).Store(&stateJSON); err != nil {
+		t.Fatal(err)
+	}
+	var state State
+	if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+		t.Fatal(err)
+	}
+	if *state.Snapshots != 1 || *state.StayOnFor != 5 || *state.APN != "internet" {
+		t.Errorf("unexpected state %s", stateJSON)
+	}
+
+	if err := setState(`{"failures": {"org.cacophony.modemd": "modem is off"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Modemd.Status(); err == nil || !strings.Contains(err.Error(), "modem is off") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := setState(`{"failures": {"org.cacophony.modemd": ""}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Modemd.Status(); err != nil {
+		t.Error(err)
+	}
+	if err := setState(`{"failures": {"org.cacophony.attiny": "off"}}`); err == nil {
+		t.Error("failing an unknown service didn't return an error")
+	}
+}
+
+func TestScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.json")
+	err := os.WriteFile(path, []byte(`{
+		"state": {"thermalStatus": {"Mode": 1, "Status": 1}},
+		"steps": [
+			{"at": "10ms", "state": {"thermalStatus": {"Mode": 1, "Status": 2}}},
+			{"at": "20ms", "state": {"result": "busy"}}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := readScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakes := peers.NewFakes()
+	if err := script.State.apply(fakes); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := fakes.TC2Agent.ThermalStatus(); s.Status != 1 {
+		t.Errorf("got %+v", s)
+	}
+	script.run(fakes)
+	if s, _ := fakes.TC2Agent.ThermalStatus(); s.Status != 2 {
+		t.Errorf("got %+v", s)
+	}
+	if result, _ := fakes.TC2Agent.ShortThermalRecording(); result != "busy" {
+		t.Errorf("got %q", result)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/godbus/dbus"
+)
+
+// State is the state of the fake services. Only the fields that are given
+// are changed when a state is applied, so a script only needs to give what
+// changes at each step.
+type State struct {
+	AudioStatus   *peers.RP2040Status  `json:"audioStatus,omitempty"`
+	ThermalStatus *peers.RP2040Status  `json:"thermalStatus,omitempty"`
+	Offload       *peers.OffloadStatus `json:"offload,omitempty"`
+	// Result is what tc2-agent replies to requests that start something.
+	Result *string `json:"result,omitempty"`
+	// Modem is the status returned by modemd. It replaces the whole status.
+	Modem        map[string]interface{} `json:"modem,omitempty"`
+	APN          *string                `json:"apn,omitempty"`
+	StayOnFor    *int                   `json:"stayOnFor,omitempty"`
+	RTCTime      *time.Time             `json:"rtcTime,omitempty"`
+	RTCIntegrity *bool                  `json:"rtcIntegrity,omitempty"`
+	// Snapshots and TestRecordings count the calls to thermal-recorder.
+	Snapshots      *int `json:"snapshots,omitempty"`
+	TestRecordings *int `json:"testRecordings,omitempty"`
+	// Failures makes every call to a service fail with the given message,
+	// or work again when the message is empty. Services are named as on
+	// the bus, e.g. "org.cacophony.modemd".
+	Failures map[string]string `json:"failures,omitempty"`
+}
+
+// Script is a state to start with and the steps to change it over time.
+type Script struct {
+	State State  `json:"state"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is a state applied once the script has been running for At.
+type Step struct {
+	At    Duration `json:"at"`
+	State State    `json:"state"`
+}
+
+// Duration is a time.Duration given as a string, such as "90s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func readScript(path string) (Script, error) {
+	var script Script
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return script, err
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return script, fmt.Errorf("failed to parse script %s: %v", path, err)
+	}
+	return script, nil
+}
+
+// run applies the steps of the script at their times.
+func (s Script) run(fakes *peers.Fakes) {
+	start := time.Now()
+	for _, step := range s.Steps {
+		time.Sleep(time.Until(start.Add(time.Duration(step.At))))
+		log.Printf("applying step at %v", time.Duration(step.At))
+		if err := step.State.apply(fakes); err != nil {
+			log.Printf("failed to apply step at %v: %v", time.Duration(step.At), err)
+		}
+	}
+}
+
+// apply sets the state of the fakes to the fields given in s.
+func (s State) apply(fakes *peers.Fakes) error {
+	failing := map[string]interface{ Fail(error) }{
+		tc2AgentName:        fakes.TC2Agent,
+		thermalRecorderName: fakes.ThermalRecorder,
+		modemdName:          fakes.Modemd,
+		rtcName:             fakes.RTC,
+	}
+	for name := range s.Failures {
+		if _, ok := failing[name]; !ok {
+			return fmt.Errorf("can't make unknown service '%s' fail", name)
+		}
+	}
+
+	agent := fakes.TC2Agent
+	agent.Update(func() {
+		if s.AudioStatus != nil {
+			agent.Audio = *s.AudioStatus
+		}
+		if s.ThermalStatus != nil {
+			agent.Thermal = *s.ThermalStatus
+		}
+		if s.Offload != nil {
+			agent.Offload = *s.Offload
+		}
+		if s.Result != nil {
+			agent.Result = *s.Result
+		}
+	})
+	modem := fakes.Modemd
+	modem.Update(func() {
+		if s.Modem != nil {
+			modem.Values = s.Modem
+		}
+		if s.APN != nil {
+			modem.APN = *s.APN
+		}
+		if s.StayOnFor != nil {
+			modem.StayOnForMin = *s.StayOnFor
+		}
+	})
+	clock := fakes.RTC
+	clock.Update(func() {
+		if s.RTCTime != nil {
+			offset := time.Until(*s.RTCTime)
+			clock.Now = func() time.Time { return time.Now().Add(offset) }
+		}
+		if s.RTCIntegrity != nil {
+			clock.Integrity = *s.RTCIntegrity
+		}
+	})
+	recorder := fakes.ThermalRecorder
+	recorder.Update(func() {
+		if s.Snapshots != nil {
+			recorder.Snapshots = *s.Snapshots
+		}
+		if s.TestRecordings != nil {
+			recorder.TestRecordings = *s.TestRecordings
+		}
+	})
+	for name, message := range s.Failures {
+		var err error
+		if message != "" {
+			err = errors.New(message)
+		}
+		failing[name].Fail(err)
+	}
+	return nil
+}
+
+// currentState returns the state of the fakes, apart from their failures.
+func currentState(fakes *peers.Fakes) State {
+	var s State
+	agent := fakes.TC2Agent
+	agent.Update(func() {
+		audio, thermal, offload, result := agent.Audio, agent.Thermal, agent.Offload, agent.Result
+		s.AudioStatus, s.ThermalStatus, s.Offload, s.Result = &audio, &thermal, &offload, &result
+	})
+	modem := fakes.Modemd
+	modem.Update(func() {
+		s.Modem = map[string]interface{}{}
+		for k, v := range modem.Values {
+			s.Modem[k] = v
+		}
+		apn, stayOnFor := modem.APN, modem.StayOnForMin
+		s.APN, s.StayOnFor = &apn, &stayOnFor
+	})
+	clock := fakes.RTC
+	clock.Update(func() {
+		now, integrity := clock.Now(), clock.Integrity
+		s.RTCTime, s.RTCIntegrity = &now, &integrity
+	})
+	recorder := fakes.ThermalRecorder
+	recorder.Update(func() {
+		snapshots, testRecordings := recorder.Snapshots, recorder.TestRecordings
+		s.Snapshots, s.TestRecordings = &snapshots, &testRecordings
+	})
+	return s
+}
+
+// control is the object used to get and set the state of a running
+// fake-peers, as JSON.
+type control struct {
+	fakes *peers.Fakes
+}
+
+func (c *control) GetState() (string, *dbus.Error) {
+	data, err := json.Marshal(currentState(c.fakes))
+	if err != nil {
+		return "", dbusError(err)
+	}
+	return string(data), nil
+}
+
+func (c *control) SetState(state string) *dbus.Error {
+	var s State
+	if err := json.Unmarshal([]byte(state), &s); err != nil {
+		return dbusError(err)
+	}
+	return dbusError(s.apply(c.fakes))
+}
@@ -0,0 +1,97 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// frame-source sends thermal frames to managementd over its frame socket as
+// tc2-agent does, either of a synthetic scene or replayed from a CPTV file,
+// so that the camera page can be used without a camera.
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/framesource"
+	"github.com/alexflint/go-arg"
+)
+
+const reconnectDelay = time.Second
+
+var log = logging.NewLogger("info")
+
+type Args struct {
+	Socket      string        `arg:"--socket" default:"/var/spool/managementd" help:"frame socket that managementd is listening on"`
+	CPTV        string        `arg:"--cptv" help:"CPTV file to replay instead of a synthetic scene"`
+	Loop        bool          `arg:"--loop" help:"replay the CPTV file from the start when it ends"`
+	Blobs       int           `arg:"--blobs" default:"3" help:"number of warm blobs in the synthetic scene"`
+	FFCInterval time.Duration `arg:"--ffc-interval" default:"60s" help:"time between FFCs in the synthetic scene, or 0 for none"`
+	Seed        int64         `arg:"--seed" default:"1" help:"seed for the synthetic scene"`
+	logging.LogArgs
+}
+
+func main() {
+	var args Args
+	arg.MustParse(&args)
+	log = logging.NewLogger(args.LogLevel)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runMain(ctx, args); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
+
+// runMain sends frames to managementd, connecting again whenever it goes
+// away, until the source has no more frames.
+func runMain(ctx context.Context, args Args) error {
+	src, err := newSource(args)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := net.Dial("unix", args.Socket)
+		if err != nil {
+			log.Printf("waiting for managementd: %v", err)
+		} else {
+			h := src.Header()
+			log.Printf("sending %dx%d frames at %d fps to %s", h.ResX, h.ResY, h.FPS, args.Socket)
+			err = framesource.Stream(ctx, conn, src)
+			conn.Close()
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			log.Printf("lost connection to managementd: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func newSource(args Args) (framesource.Source, error) {
+	if args.CPTV != "" {
+		return framesource.OpenRecording(args.CPTV, args.Loop)
+	}
+	return framesource.NewScene(framesource.Lepton35, args.Blobs, args.FFCInterval, args.Seed), nil
+}
@@ -0,0 +1,158 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the version of the API that managementctl was written
+// against. Devices keep serving older versions, so it is pinned rather than
+// using the unversioned /api.
+const apiPrefix = "/api/v10"
+
+// client makes requests to the API of a device.
+type client struct {
+	base     *url.URL
+	user     string
+	password string
+	http     *http.Client
+}
+
+// newClient returns a client for the device, which is a host name, an IP
+// address or a URL. Plain HTTP is used unless the URL says otherwise.
+func newClient(deviceAddr, user, password string, timeout time.Duration, insecure bool) (*client, error) {
+	if !strings.Contains(deviceAddr, "://") {
+		deviceAddr = "http://" + deviceAddr
+	}
+	base, err := url.Parse(deviceAddr)
+	if err != nil {
+		return nil, err
+	}
+	if base.Host == "" {
+		return nil, fmt.Errorf("no host in %q", deviceAddr)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		// The device's certificate is self-signed.
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &client{
+		base:     base,
+		user:     user,
+		password: password,
+		http:     &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+// apiError is an error response from the API.
+type apiError struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// request makes a request to an API route. A url.Values body is sent as a
+// form and anything else as JSON. It returns the response for the caller to
+// read and close, or the error the API responded with.
+func (c *client) request(method, route string, query url.Values, body interface{}) (*http.Response, error) {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + apiPrefix + route
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case url.Values:
+		reader = strings.NewReader(b.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.SetBasicAuth(c.user, c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	apiErr := &apiError{Status: resp.StatusCode}
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		// Not from an API handler, such as a 404 for an unknown route.
+		apiErr.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(resp.StatusCode), " ", "_"))
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
+
+// call makes a request and decodes a JSON response into out, unless out is
+// nil, in which case the response is returned as text.
+func (c *client) call(method, route string, query url.Values, body, out interface{}) (string, error) {
+	resp, err := c.request(method, route, query, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return "", fmt.Errorf("reading %s response: %v", route, err)
+		}
+		return "", nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data)), err
+}
@@ -0,0 +1,469 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultDiscoverWait = 2 * time.Second
+	saltPollInterval    = 5 * time.Second
+	// timeFormat is the format the API takes times in.
+	timeFormat = "2006-01-02T15:04:05Z07:00"
+)
+
+// done tells people that an action worked. Nothing is printed for JSON, as
+// the exit status says the same.
+func (p printer) done(format string, args ...interface{}) {
+	if !p.json {
+		fmt.Fprintf(p.w, format+"\n", args...)
+	}
+}
+
+type DiscoverCmd struct {
+	Wait time.Duration `arg:"--wait" default:"2s" help:"how long to wait for devices to answer"`
+}
+
+func (cmd *DiscoverCmd) run(ctx context.Context, out printer) error {
+	devices, err := discover(ctx, mdnsAddr, cmd.Wait)
+	if err != nil {
+		return err
+	}
+	rows := []interface{}{}
+	for _, d := range devices {
+		rows = append(rows, map[string]interface{}{
+			"name":      d.Name,
+			"host":      d.Host,
+			"addresses": strings.Join(d.Addrs, ","),
+			"url":       d.URL(),
+		})
+	}
+	if len(rows) == 0 && !out.json {
+		out.done("no devices found")
+		return nil
+	}
+	return out.print(rows, "name", "host", "addresses", "url")
+}
+
+type DeviceInfoCmd struct{}
+
+func (cmd *DeviceInfoCmd) run(c *client, out printer) error {
+	var info interface{}
+	if _, err := c.call("GET", "/device-info", nil, nil, &info); err != nil {
+		return err
+	}
+	return out.print(info)
+}
+
+type ConfigCmd struct {
+	Get   *ConfigGetCmd   `arg:"subcommand:get" help:"show the config, or one section of it"`
+	Set   *ConfigSetCmd   `arg:"subcommand:set" help:"set values in a section"`
+	Clear *ConfigClearCmd `arg:"subcommand:clear" help:"clear a section back to its defaults"`
+}
+
+type ConfigGetCmd struct {
+	Section  string `arg:"positional" help:"section to show, such as location or thermal-recorder"`
+	Defaults bool   `arg:"--defaults" help:"show the defaults rather than the values that are set"`
+}
+
+type ConfigSetCmd struct {
+	Section string `arg:"positional,required" help:"section to set values in"`
+	Values  string `arg:"positional,required" help:"JSON object of the values, or - to read it from stdin"`
+}
+
+type ConfigClearCmd struct {
+	Section string `arg:"positional,required" help:"section to clear"`
+}
+
+func (cmd *ConfigCmd) run(c *client, out printer) error {
+	switch {
+	case cmd.Set != nil:
+		values := cmd.Set.Values
+		if values == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			values = string(data)
+		}
+		// Checked here to give a clearer error than the device's.
+		if err := json.Unmarshal([]byte(values), &map[string]interface{}{}); err != nil {
+			return fmt.Errorf("values aren't a JSON object: %v", err)
+		}
+		form := url.Values{"section": {cmd.Set.Section}, "config": {values}}
+		if _, err := c.call("POST", "/config", nil, form, nil); err != nil {
+			return err
+		}
+		out.done("set %s", cmd.Set.Section)
+		return nil
+	case cmd.Clear != nil:
+		form := url.Values{"section": {cmd.Clear.Section}}
+		if _, err := c.call("POST", "/clear-config-section", nil, form, nil); err != nil {
+			return err
+		}
+		out.done("cleared %s", cmd.Clear.Section)
+		return nil
+	}
+
+	get := cmd.Get
+	if get == nil {
+		get = &ConfigGetCmd{}
+	}
+	var config struct {
+		Values   map[string]interface{} `json:"values"`
+		Defaults map[string]interface{} `json:"defaults"`
+	}
+	if _, err := c.call("GET", "/config", nil, nil, &config); err != nil {
+		return err
+	}
+	sections := config.Values
+	if get.Defaults {
+		sections = config.Defaults
+	}
+	if get.Section == "" {
+		return out.print(map[string]interface{}(sections))
+	}
+	// The API gives section names in camel case.
+	for _, name := range []string{get.Section, toCamelCase(get.Section)} {
+		if section, ok := sections[name]; ok {
+			return out.print(section)
+		}
+	}
+	return fmt.Errorf("no %s section is set", get.Section)
+}
+
+func toCamelCase(s string) string {
+	parts := strings.Split(s, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			r := []rune(parts[i])
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+type RecordingsCmd struct {
+	List     *struct{}              `arg:"subcommand:list" help:"list the recordings on the device"`
+	Download *RecordingsDownloadCmd `arg:"subcommand:download" help:"download recordings"`
+	Delete   *RecordingsDeleteCmd   `arg:"subcommand:delete" help:"delete recordings"`
+}
+
+type RecordingsDownloadCmd struct {
+	Names []string `arg:"positional" help:"recordings to download, or all of them when none are given"`
+	Dir   string   `arg:"--dir" default:"." help:"directory to save the recordings in"`
+}
+
+type RecordingsDeleteCmd struct {
+	Names []string `arg:"positional,required" help:"recordings to delete"`
+}
+
+func (cmd *RecordingsCmd) run(c *client, out printer) error {
+	switch {
+	case cmd.Download != nil:
+		names := cmd.Download.Names
+		if len(names) == 0 {
+			if _, err := c.call("GET", "/recordings", nil, nil, &names); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			path, err := downloadRecording(c, name, cmd.Download.Dir)
+			if err != nil {
+				return err
+			}
+			out.done("downloaded %s", path)
+		}
+		return nil
+	case cmd.Delete != nil:
+		for _, name := range cmd.Delete.Names {
+			if _, err := c.call("DELETE", "/recording/"+url.PathEscape(name), nil, nil, nil); err != nil {
+				return err
+			}
+			out.done("deleted %s", name)
+		}
+		return nil
+	}
+	var names []interface{}
+	if _, err := c.call("GET", "/recordings", nil, nil, &names); err != nil {
+		return err
+	}
+	return out.print(names)
+}
+
+// downloadRecording saves a recording in dir, writing to a temporary file
+// first so that a failed download doesn't leave part of a recording.
+func downloadRecording(c *client, name, dir string) (string, error) {
+	if filepath.Base(name) != name {
+		return "", fmt.Errorf("bad recording name %q", name)
+	}
+	resp, err := c.request("GET", "/recording/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	f, err := os.CreateTemp(dir, name+".*.part")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("downloading %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	return path, os.Rename(f.Name(), path)
+}
+
+type EventsCmd struct {
+	List   *struct{}        `arg:"subcommand:list" help:"list the events on the device"`
+	Delete *EventsDeleteCmd `arg:"subcommand:delete" help:"delete events"`
+}
+
+type EventsDeleteCmd struct {
+	Keys []uint64 `arg:"positional" help:"keys of the events to delete"`
+	All  bool     `arg:"--all" help:"delete every event"`
+}
+
+func (cmd *EventsCmd) run(c *client, out printer) error {
+	if del := cmd.Delete; del != nil {
+		keys := del.Keys
+		if del.All {
+			if _, err := c.call("GET", "/event-keys", nil, nil, &keys); err != nil {
+				return err
+			}
+		} else if len(keys) == 0 {
+			return errors.New("give the keys of the events to delete, or --all")
+		}
+		if len(keys) == 0 {
+			out.done("no events to delete")
+			return nil
+		}
+		if _, err := c.call("DELETE", "/events", keysQuery(keys), nil, nil); err != nil {
+			return err
+		}
+		out.done("deleted %d events", len(keys))
+		return nil
+	}
+
+	var keys []uint64
+	if _, err := c.call("GET", "/event-keys", nil, nil, &keys); err != nil {
+		return err
+	}
+	events := map[string]struct {
+		Success bool                   `json:"success"`
+		Event   map[string]interface{} `json:"event"`
+		Error   string                 `json:"error"`
+	}{}
+	if len(keys) > 0 {
+		if _, err := c.call("GET", "/events", keysQuery(keys), nil, &events); err != nil {
+			return err
+		}
+	}
+	rows := []interface{}{}
+	for _, key := range keys {
+		event := events[strconv.FormatUint(key, 10)]
+		row := map[string]interface{}{"key": key}
+		if event.Success {
+			row["time"] = event.Event["Timestamp"]
+			row["type"] = event.Event["Type"]
+			row["details"] = event.Event["Details"]
+		} else {
+			row["details"] = event.Error
+		}
+		rows = append(rows, row)
+	}
+	return out.print(rows, "key", "time", "type", "details")
+}
+
+func keysQuery(keys []uint64) url.Values {
+	data, _ := json.Marshal(keys)
+	return url.Values{"keys": {string(data)}}
+}
+
+type LogsCmd struct {
+	Service string `arg:"positional,required" help:"service to show the logs of"`
+	Lines   int    `arg:"-n,--lines" default:"50" help:"how many lines to show"`
+}
+
+func (cmd *LogsCmd) run(c *client, out printer) error {
+	var lines []interface{}
+	query := url.Values{"service": {cmd.Service}, "lines": {strconv.Itoa(cmd.Lines)}}
+	if _, err := c.call("GET", "/logs", query, nil, &lines); err != nil {
+		return err
+	}
+	return out.print(lines)
+}
+
+type ServiceCmd struct {
+	Status  *ServiceNameCmd `arg:"subcommand:status" help:"show whether a service is enabled and running"`
+	Restart *ServiceNameCmd `arg:"subcommand:restart" help:"restart a service"`
+}
+
+type ServiceNameCmd struct {
+	Name string `arg:"positional,required" help:"name of the service, such as thermal-recorder"`
+}
+
+func (cmd *ServiceCmd) run(c *client, out printer) error {
+	switch {
+	case cmd.Restart != nil:
+		form := url.Values{"service": {cmd.Restart.Name}}
+		if _, err := c.call("POST", "/service-restart", nil, form, nil); err != nil {
+			return err
+		}
+		out.done("restarted %s", cmd.Restart.Name)
+		return nil
+	case cmd.Status != nil:
+		var status interface{}
+		query := url.Values{"service": {cmd.Status.Name}}
+		if _, err := c.call("GET", "/service", query, nil, &status); err != nil {
+			return err
+		}
+		return out.print(status)
+	}
+	return errors.New("give status or restart")
+}
+
+type WifiCmd struct {
+	Scan   *struct{}      `arg:"subcommand:scan" help:"list the WiFi networks the device can see"`
+	Add    *WifiAddCmd    `arg:"subcommand:add" help:"save a WiFi network for the device to connect to"`
+	Forget *WifiForgetCmd `arg:"subcommand:forget" help:"forget a saved WiFi network"`
+}
+
+type WifiAddCmd struct {
+	SSID     string `arg:"positional,required"`
+	Password string `arg:"positional" help:"password of the network, if it has one"`
+	Connect  bool   `arg:"--connect" help:"connect to the network now rather than saving it for later"`
+}
+
+type WifiForgetCmd struct {
+	SSID string `arg:"positional,required"`
+}
+
+func (cmd *WifiCmd) run(c *client, out printer) error {
+	switch {
+	case cmd.Add != nil:
+		route := "/network/wifi/save"
+		if cmd.Add.Connect {
+			route = "/network/wifi"
+		}
+		body := map[string]string{"ssid": cmd.Add.SSID, "password": cmd.Add.Password}
+		if _, err := c.call("POST", route, nil, body, nil); err != nil {
+			return err
+		}
+		out.done("added %s", cmd.Add.SSID)
+		return nil
+	case cmd.Forget != nil:
+		body := map[string]string{"ssid": cmd.Forget.SSID}
+		if _, err := c.call("DELETE", "/network/wifi/forget", nil, body, nil); err != nil {
+			return err
+		}
+		out.done("forgot %s", cmd.Forget.SSID)
+		return nil
+	}
+	var networks []interface{}
+	if _, err := c.call("GET", "/network/wifi", nil, nil, &networks); err != nil {
+		return err
+	}
+	return out.print(networks, "SSID", "Quality", "InUse", "AuthFailed")
+}
+
+type ClockCmd struct {
+	Set *ClockSetCmd `arg:"subcommand:set" help:"set the device's clock to the time on this machine"`
+}
+
+type ClockSetCmd struct {
+	Timezone string `arg:"--timezone" help:"time zone to set on the device as well, such as Pacific/Auckland"`
+}
+
+func (cmd *ClockCmd) run(c *client, out printer) error {
+	if cmd.Set != nil {
+		now := time.Now()
+		form := url.Values{"date": {now.Format(timeFormat)}}
+		if cmd.Set.Timezone != "" {
+			form.Set("timezone", cmd.Set.Timezone)
+		}
+		if _, err := c.call("POST", "/clock", nil, form, nil); err != nil {
+			return err
+		}
+		out.done("set the clock to %s", now.Format(timeFormat))
+		return nil
+	}
+	var clock interface{}
+	if _, err := c.call("GET", "/clock", nil, nil, &clock); err != nil {
+		return err
+	}
+	return out.print(clock)
+}
+
+type SaltUpdateCmd struct {
+	Status bool `arg:"--status" help:"show the state of the last update rather than starting one"`
+	Force  bool `arg:"--force" help:"update even if the device is up to date"`
+	Wait   bool `arg:"--wait" help:"wait for the update to finish, showing its progress"`
+}
+
+func (cmd *SaltUpdateCmd) run(ctx context.Context, c *client, out printer) error {
+	if !cmd.Status {
+		text, err := c.call("POST", "/salt-update", nil, map[string]bool{"force": cmd.Force}, nil)
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			text = "started a salt update"
+		}
+		out.done("%s", text)
+	}
+	var state map[string]interface{}
+	if _, err := c.call("GET", "/salt-update", nil, nil, &state); err != nil {
+		return err
+	}
+	lastProgress := ""
+	for cmd.Wait && state["RunningUpdate"] == true {
+		progress := fmt.Sprintf("%v%% %v", state["UpdateProgressPercentage"], state["UpdateProgressStr"])
+		if progress != lastProgress {
+			out.done("%s", progress)
+			lastProgress = progress
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(saltPollInterval):
+		}
+		if _, err := c.call("GET", "/salt-update", nil, nil, &state); err != nil {
+			return err
+		}
+	}
+	return out.print(map[string]interface{}(state))
+}
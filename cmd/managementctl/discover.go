@@ -0,0 +1,173 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serviceType is what managementd is advertised as by avahi.
+const serviceType = "_cacophonator-management._tcp.local."
+
+// mdnsAddr is where mDNS queries are sent.
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// device is a managementd found with mDNS.
+type device struct {
+	Name  string   `json:"name"`
+	Host  string   `json:"host"`
+	Port  int      `json:"port"`
+	Addrs []string `json:"addresses"`
+}
+
+// URL returns the address of the device's API, preferring an IPv4 address
+// as .local host names don't resolve everywhere.
+func (d device) URL() string {
+	host := strings.TrimSuffix(d.Host, ".")
+	for _, addr := range d.Addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			host = addr
+			break
+		}
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, fmt.Sprint(d.Port)))
+}
+
+// discover asks for managementd services with mDNS and returns the devices
+// that answer within wait. The query is sent from an ephemeral port, so
+// responders answer straight back to it rather than to the multicast group.
+func discover(ctx context.Context, to *net.UDPAddr, wait time.Duration) ([]device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := mdnsQuery(serviceType, dnsmessage.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, to); err != nil {
+		return nil, fmt.Errorf("sending mDNS query: %v", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	records := newMDNSRecords()
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		records.add(buf[:n])
+	}
+	return records.devices(), nil
+}
+
+func mdnsQuery(name string, qtype dnsmessage.Type) ([]byte, error) {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: n, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	return msg.Pack()
+}
+
+// mdnsRecords collects the records from mDNS responses, which can come in
+// any order and from several responders.
+type mdnsRecords struct {
+	instances map[string]bool
+	srv       map[string]dnsmessage.SRVResource
+	addrs     map[string][]string
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{
+		instances: map[string]bool{},
+		srv:       map[string]dnsmessage.SRVResource{},
+		addrs:     map[string][]string{},
+	}
+}
+
+func (m *mdnsRecords) add(packet []byte) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil || !msg.Response {
+		return
+	}
+	for _, rr := range append(msg.Answers, msg.Additionals...) {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == serviceType {
+				m.instances[strings.ToLower(body.PTR.String())] = true
+			}
+		case *dnsmessage.SRVResource:
+			m.srv[name] = *body
+		case *dnsmessage.AResource:
+			m.addAddr(name, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			m.addAddr(name, net.IP(body.AAAA[:]).String())
+		}
+	}
+}
+
+func (m *mdnsRecords) addAddr(host, addr string) {
+	for _, a := range m.addrs[host] {
+		if a == addr {
+			return
+		}
+	}
+	m.addrs[host] = append(m.addrs[host], addr)
+}
+
+// devices returns the services that have been resolved to a host and port.
+func (m *mdnsRecords) devices() []device {
+	var devices []device
+	for instance := range m.instances {
+		srv, ok := m.srv[instance]
+		if !ok {
+			continue
+		}
+		host := strings.ToLower(srv.Target.String())
+		devices = append(devices, device{
+			Name:  strings.TrimSuffix(instance, "."+serviceType),
+			Host:  strings.TrimSuffix(host, "."),
+			Port:  int(srv.Port),
+			Addrs: m.addrs[host],
+		})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
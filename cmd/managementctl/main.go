@@ -0,0 +1,137 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// managementctl manages a device through the managementd API, for
+// technicians scripting against devices. The device is found with mDNS when
+// it isn't given.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+)
+
+var version = "<not set>"
+
+type Args struct {
+	Device   string        `arg:"-d,--device,env:MANAGEMENTCTL_DEVICE" help:"device to manage, as a host name, IP address or URL such as https://192.168.4.1; found with mDNS when not given"`
+	User     string        `arg:"-u,--user,env:MANAGEMENTCTL_USER" default:"admin" help:"API user"`
+	Password string        `arg:"-p,--password,env:MANAGEMENTCTL_PASSWORD" help:"password of the API user"`
+	JSON     bool          `arg:"--json" help:"print JSON rather than tables"`
+	Timeout  time.Duration `arg:"--timeout" default:"30s" help:"how long to wait for each request"`
+	Insecure bool          `arg:"--insecure" help:"accept the device's self-signed certificate over HTTPS"`
+
+	Discover   *DiscoverCmd   `arg:"subcommand:discover" help:"list the devices found with mDNS"`
+	DeviceInfo *DeviceInfoCmd `arg:"subcommand:device-info" help:"show the device's name, group and server"`
+	Config     *ConfigCmd     `arg:"subcommand:config" help:"show or change the device config"`
+	Recordings *RecordingsCmd `arg:"subcommand:recordings" help:"list, download or delete recordings"`
+	Events     *EventsCmd     `arg:"subcommand:events" help:"list or delete events"`
+	Logs       *LogsCmd       `arg:"subcommand:logs" help:"show the logs of a service"`
+	Service    *ServiceCmd    `arg:"subcommand:service" help:"show the status of a service or restart it"`
+	Wifi       *WifiCmd       `arg:"subcommand:wifi" help:"scan for, add or forget WiFi networks"`
+	Clock      *ClockCmd      `arg:"subcommand:clock" help:"show the device's clock or set it from this machine"`
+	SaltUpdate *SaltUpdateCmd `arg:"subcommand:salt-update" help:"run a salt update or show the state of the last one"`
+}
+
+func (Args) Version() string {
+	return version
+}
+
+func (Args) Description() string {
+	return "managementctl manages a Cacophony device through its management API."
+}
+
+func main() {
+	var args Args
+	p := arg.MustParse(&args)
+	if p.Subcommand() == nil {
+		p.Fail("missing command")
+	}
+	if err := run(context.Background(), args, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "managementctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command given in args, writing its output to w.
+func run(ctx context.Context, args Args, w io.Writer) error {
+	out := printer{w: w, json: args.JSON}
+	if args.Discover != nil {
+		return args.Discover.run(ctx, out)
+	}
+
+	c, err := connect(ctx, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args.DeviceInfo != nil:
+		return args.DeviceInfo.run(c, out)
+	case args.Config != nil:
+		return args.Config.run(c, out)
+	case args.Recordings != nil:
+		return args.Recordings.run(c, out)
+	case args.Events != nil:
+		return args.Events.run(c, out)
+	case args.Logs != nil:
+		return args.Logs.run(c, out)
+	case args.Service != nil:
+		return args.Service.run(c, out)
+	case args.Wifi != nil:
+		return args.Wifi.run(c, out)
+	case args.Clock != nil:
+		return args.Clock.run(c, out)
+	case args.SaltUpdate != nil:
+		return args.SaltUpdate.run(ctx, c, out)
+	}
+	return errors.New("missing command")
+}
+
+// connect returns a client for the device in args, or for the only device
+// found with mDNS.
+func connect(ctx context.Context, args Args) (*client, error) {
+	if args.Password == "" {
+		return nil, errors.New("no password, give one with --password or MANAGEMENTCTL_PASSWORD")
+	}
+	addr := args.Device
+	if addr == "" {
+		devices, err := discover(ctx, mdnsAddr, defaultDiscoverWait)
+		if err != nil {
+			return nil, fmt.Errorf("finding a device with mDNS: %v", err)
+		}
+		switch len(devices) {
+		case 0:
+			return nil, errors.New("no devices found with mDNS, give one with --device")
+		case 1:
+			addr = devices[0].URL()
+		default:
+			names := ""
+			for _, d := range devices {
+				names += "\n  " + d.Name + " " + d.URL()
+			}
+			return nil, fmt.Errorf("%d devices found with mDNS, pick one with --device:%s", len(devices), names)
+		}
+	}
+	return newClient(addr, args.User, args.Password, args.Timeout, args.Insecure)
+}
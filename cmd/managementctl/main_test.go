@@ -0,0 +1,203 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// request is what the fake device was asked for.
+type request struct {
+	method, path, query, body string
+}
+
+// fakeDevice answers each "METHOD /path" with a canned response and records
+// the requests it gets.
+func fakeDevice(t *testing.T, responses map[string]string) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, r.URL.RawQuery, string(body)})
+		response, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code":"not_found","message":"no such route","requestId":"abc"}`)
+			return
+		}
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func runArgs(t *testing.T, server *httptest.Server, cmdline ...string) (string, error) {
+	t.Helper()
+	var args Args
+	p, err := arg.NewParser(arg.Config{}, &args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Parse(append([]string{"--device", server.URL, "--password", "secret"}, cmdline...)); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	err = run(context.Background(), args, &out)
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	server, requests := fakeDevice(t, map[string]string{
+		"GET /api/v10/device-info":            `{"devicename":"tc2-1","deviceID":123456789}`,
+		"GET /api/v10/config":                 `{"values":{"thermalRecorder":{"use-low-power-mode":true}},"defaults":{}}`,
+		"POST /api/v10/config":                ``,
+		"GET /api/v10/recordings":             `["a.cptv"]`,
+		"GET /api/v10/recording/a.cptv":       `CPTV`,
+		"GET /api/v10/event-keys":             `[7]`,
+		"GET /api/v10/events":                 `{"7":{"success":true,"event":{"Type":"rpi-power-on","Timestamp":"2026-10-16T00:00:00Z"}}}`,
+		"GET /api/v10/network/wifi":           `[{"SSID":"bushnet","Quality":"70","InUse":true}]`,
+		"POST /api/v10/network/wifi/save":     ``,
+		"POST /api/v10/service-restart":       ``,
+		"POST /api/v10/clock":                 ``,
+		"GET /api/v10/salt-update":            `{"RunningUpdate":false,"LastCallSuccess":true}`,
+		"POST /api/v10/salt-update":           `Update started`,
+		"DELETE /api/v10/network/wifi/forget": ``,
+	})
+	dir := t.TempDir()
+
+	for _, test := range []struct {
+		cmdline []string
+		want    []string
+		request request
+	}{
+		{[]string{"device-info"}, []string{"deviceID    123456789", "devicename  tc2-1"}, request{method: "GET", path: "/api/v10/device-info"}},
+		{[]string{"--json", "config", "get", "thermal-recorder"}, []string{`"use-low-power-mode": true`}, request{method: "GET", path: "/api/v10/config"}},
+		{[]string{"config", "set", "location", `{"latitude":-43.5}`}, []string{"set location"},
+			request{"POST", "/api/v10/config", "", "config=%7B%22latitude%22%3A-43.5%7D&section=location"}},
+		{[]string{"recordings", "download", "--dir", dir}, []string{"downloaded " + filepath.Join(dir, "a.cptv")}, request{method: "GET", path: "/api/v10/recording/a.cptv"}},
+		{[]string{"events"}, []string{"KEY  TIME", "7    2026-10-16T00:00:00Z  rpi-power-on"}, request{"GET", "/api/v10/events", "keys=%5B7%5D", ""}},
+		{[]string{"wifi", "scan"}, []string{"SSID     QUALITY  INUSE  AUTHFAILED", "bushnet  70       true   -"}, request{method: "GET", path: "/api/v10/network/wifi"}},
+		{[]string{"wifi", "add", "bushnet", "pw"}, []string{"added bushnet"}, request{"POST", "/api/v10/network/wifi/save", "", `{"password":"pw","ssid":"bushnet"}`}},
+		{[]string{"wifi", "forget", "bushnet"}, []string{"forgot bushnet"}, request{"DELETE", "/api/v10/network/wifi/forget", "", `{"ssid":"bushnet"}`}},
+		{[]string{"service", "restart", "thermal-recorder"}, []string{"restarted thermal-recorder"}, request{"POST", "/api/v10/service-restart", "", "service=thermal-recorder"}},
+		{[]string{"salt-update", "--force"}, []string{"Update started", "LastCallSuccess  true"}, request{method: "GET", path: "/api/v10/salt-update"}},
+	} {
+		*requests = nil
+		got, err := runArgs(t, server, test.cmdline...)
+		if err != nil {
+			t.Errorf("%v: %v", test.cmdline, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%v printed:\n%s\nwant %q", test.cmdline, got, want)
+			}
+		}
+		found := false
+		for _, r := range *requests {
+			found = found || r == test.request ||
+				(test.request.query == "" && test.request.body == "" && r.method == test.request.method && r.path == test.request.path)
+		}
+		if !found {
+			t.Errorf("%v made %+v, want %+v", test.cmdline, *requests, test.request)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "a.cptv")); err != nil || string(data) != "CPTV" {
+		t.Errorf("got %q, %v for the downloaded recording", data, err)
+	}
+
+	*requests = nil
+	if _, err := runArgs(t, server, "clock", "set", "--timezone", "Pacific/Auckland"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 || !strings.Contains((*requests)[0].body, "timezone=Pacific%2FAuckland") || !strings.Contains((*requests)[0].body, "date=") {
+		t.Errorf("clock set made %+v", *requests)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	server, _ := fakeDevice(t, nil)
+	_, err := runArgs(t, server, "logs", "tc2-agent")
+	if err == nil || err.Error() != "404 not_found: no such route (request abc)" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		n, from, err := responder.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 || query.Questions[0].Name.String() != serviceType {
+			return
+		}
+		service := dnsmessage.MustNewName(serviceType)
+		instance := dnsmessage.MustNewName("tc2-1." + serviceType)
+		host := dnsmessage.MustNewName("tc2-1.local.")
+		header := func(name dnsmessage.Name, rrtype dnsmessage.Type) dnsmessage.ResourceHeader {
+			return dnsmessage.ResourceHeader{Name: name, Type: rrtype, Class: dnsmessage.ClassINET, TTL: 120}
+		}
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+			Questions: query.Questions,
+			Answers: []dnsmessage.Resource{
+				{Header: header(service, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: instance}},
+			},
+			Additionals: []dnsmessage.Resource{
+				{Header: header(instance, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: host, Port: 80}},
+				{Header: header(host, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 4, 1}}},
+			},
+		}
+		packet, _ := response.Pack()
+		responder.WriteToUDP(packet, from)
+	}()
+
+	devices, err := discover(context.Background(), responder.LocalAddr().(*net.UDPAddr), 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "tc2-1" || devices[0].URL() != "http://192.168.4.1:80" {
+		t.Errorf("got %+v", devices)
+	}
+}
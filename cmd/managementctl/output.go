@@ -0,0 +1,115 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes results as indented JSON, or as tables for people.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v, which is decoded JSON. Tables of objects have the given
+// columns, or every key in order when none are given.
+func (p printer) print(v interface{}, columns ...string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			fmt.Fprintf(tw, "%s\t%s\n", key, cell(v[key]))
+		}
+	case []interface{}:
+		p.printRows(tw, v, columns)
+	default:
+		fmt.Fprintln(tw, cell(v))
+	}
+	return tw.Flush()
+}
+
+func (p printer) printRows(tw io.Writer, rows []interface{}, columns []string) {
+	objects := len(rows) > 0
+	for _, row := range rows {
+		if _, ok := row.(map[string]interface{}); !ok {
+			objects = false
+		}
+	}
+	if !objects {
+		for _, row := range rows {
+			fmt.Fprintln(tw, cell(row))
+		}
+		return
+	}
+	if len(columns) == 0 {
+		seen := map[string]interface{}{}
+		for _, row := range rows {
+			for key := range row.(map[string]interface{}) {
+				seen[key] = nil
+			}
+		}
+		columns = sortedKeys(seen)
+	}
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = cell(row.(map[string]interface{})[column])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+}
+
+// cell formats a value for a table, with nested values as compact JSON.
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	case float64:
+		// Without an exponent, as JSON numbers are often IDs or sizes.
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
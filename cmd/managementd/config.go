@@ -22,17 +22,32 @@ import (
 	"fmt"
 
 	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/TheCacophonyProject/management-interface/settings"
 )
 
 // Config for management interface
 type Config struct {
-	Port    int
-	CPTVDir string
-	config  *goconfig.Config
+	Port            int
+	TLSPort         int
+	RedirectToHTTPS bool
+	CPTVDir         string
+	Settings        settings.Settings
+	config          *goconfig.Config
+}
+
+// managementdSection holds the settings read from the managementd section of
+// the cacophony config.
+type managementdSection struct {
+	TLSPort         int  `mapstructure:"tls-port"`
+	RedirectToHTTPS bool `mapstructure:"redirect-to-https"`
+	// The paths and timings, which default to the ones for a TC2.
+	settings.Settings `mapstructure:",squash"`
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("{ Port: %d, CPTVDir: %s }", c.Port, c.CPTVDir)
+	return fmt.Sprintf("{ Port: %d, TLSPort: %d, RedirectToHTTPS: %t, CPTVDir: %s, Settings: %+v }",
+		c.Port, c.TLSPort, c.RedirectToHTTPS, c.CPTVDir, c.Settings)
 }
 
 // ParseConfig parses the config
@@ -52,9 +67,26 @@ func ParseConfig(configDir string) (*Config, error) {
 		return nil, err
 	}
 
+	managementd := managementdSection{Settings: settings.Default()}
+	if err := config.Unmarshal(auth.ConfigKey, &managementd); err != nil {
+		return nil, err
+	}
+	if managementd.TLSPort < 0 || managementd.TLSPort > 65535 || (managementd.TLSPort != 0 && managementd.TLSPort == ports.Managementd) {
+		return nil, fmt.Errorf("invalid %s tls-port %d", auth.ConfigKey, managementd.TLSPort)
+	}
+	if managementd.RedirectToHTTPS && managementd.TLSPort == 0 {
+		return nil, fmt.Errorf("%s redirect-to-https needs a tls-port", auth.ConfigKey)
+	}
+	if err := managementd.Settings.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s settings: %w", auth.ConfigKey, err)
+	}
+
 	return &Config{
-		Port:    ports.Managementd,
-		CPTVDir: thermalRecorder.OutputDir,
-		config:  config,
+		Port:            ports.Managementd,
+		TLSPort:         managementd.TLSPort,
+		RedirectToHTTPS: managementd.RedirectToHTTPS,
+		CPTVDir:         thermalRecorder.OutputDir,
+		Settings:        managementd.Settings,
+		config:          config,
 	}, nil
 }
@@ -0,0 +1,74 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/management-interface/settings"
+)
+
+func parseConfig(t *testing.T, toml string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, goconfig.ConfigFileName), []byte(toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ParseConfig(dir)
+}
+
+func TestParseConfigSettings(t *testing.T) {
+	config, err := parseConfig(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Settings != settings.Default() {
+		t.Errorf("got %+v with no managementd section, want the defaults", config.Settings)
+	}
+
+	config, err = parseConfig(t, `
+[managementd]
+tls-port = 8443
+test-recordings-dir = "/tmp/rig/test-recordings"
+classifier = "/opt/classifier"
+stay-on-for = "0s"
+socket-timeout = "30s"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := settings.Default()
+	want.TestRecordingsDir = "/tmp/rig/test-recordings"
+	want.Classifier = "/opt/classifier"
+	want.StayOnFor = 0
+	want.SocketTimeout = 30 * time.Second
+	if config.Settings != want || config.TLSPort != 8443 {
+		t.Errorf("got %v, want settings %+v and tls-port 8443", config, want)
+	}
+
+	_, err = parseConfig(t, "[managementd]\nkeep-hotspot-on-for = \"0s\"\n")
+	if err == nil || !strings.Contains(err.Error(), "keep-hotspot-on-for") {
+		t.Errorf("got error %v for an invalid setting", err)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/gorilla/websocket"
+)
+
+// received is a websocket message and whether it was binary.
+type received struct {
+	data   []byte
+	binary bool
+}
+
+func readMessage(ws *websocket.Conn) (received, error) {
+	messageType, data, err := ws.ReadMessage()
+	return received{data, messageType == websocket.BinaryMessage}, err
+}
+
+func dialWebsocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(websocketURL(server), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func websocketURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func receive(t *testing.T, ws *websocket.Conn) received {
+	t.Helper()
+	msg, err := readMessage(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// receiveMessage reads a binary message using the protocol.
+func receiveMessage(t *testing.T, ws *websocket.Conn, want frameproto.MessageType) frameproto.Message {
+	t.Helper()
+	msg := receive(t, ws)
+	if !msg.binary {
+		t.Fatalf("got text %q, want a %v message", msg.data, want)
+	}
+	m, err := frameproto.Decode(msg.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != want {
+		t.Fatalf("got a %v message, want %v", m.Type, want)
+	}
+	return m
+}
+
+func TestFrameProtocol(t *testing.T) {
+	h, server := startHub(t)
+	ctx := context.Background()
+
+	client := dialWebsocket(t, server)
+	client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 1, Versions: []int{2, 1}})
+	var welcome frameproto.WelcomeMessage
+	if err := json.Unmarshal(receive(t, client).data, &welcome); err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Type != frameproto.Welcome || welcome.Version != 1 || welcome.AppVersion != version || len(welcome.MessageTypes) != 5 {
+		t.Errorf("got %+v", welcome)
+	}
+	var status frameproto.Status
+	receiveMessage(t, client, frameproto.TypeStatus).Unmarshal(&status)
+	if status.Connected {
+		t.Errorf("got %+v with no camera", status)
+	}
+
+	legacy := dialWebsocket(t, server)
+	legacy.WriteJSON(frameproto.ClientMessage{Type: frameproto.Register, Uuid: 2})
+	if msg := receive(t, legacy); msg.binary || string(msg.data) != frameproto.LegacyDisconnected {
+		t.Fatalf("got %q, want the legacy disconnected message", msg.data)
+	}
+
+	// The camera connects and sends a frame.
+	camera := &frameproto.FrameInfo{Camera: frameproto.Camera{Model: "lepton3.5", ResX: 2, ResY: 1}, AppVersion: version, BinaryVersion: "1.0"}
+	h.CameraConnected(ctx, camera)
+	receiveMessage(t, client, frameproto.TypeStatus).Unmarshal(&status)
+	if !status.Connected || status.Camera.Model != "lepton3.5" || status.BinaryVersion != "1.0" {
+		t.Errorf("got %+v with the camera connected", status)
+	}
+
+	pix := [][]uint16{{0x0102, 0x0304}}
+	h.Publish(ctx, &FrameData{Frame: &cptvframe.Frame{Pix: pix, Status: cptvframe.Telemetry{FrameCount: 9}}})
+	info, gotPix, err := receiveMessage(t, client, frameproto.TypeFrame).Frame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Telemetry.FrameCount != 9 || info.Camera != camera.Camera || info.BinaryVersion != "1.0" || !reflect.DeepEqual(gotPix, pix) {
+		t.Errorf("got frame %+v %v", info, gotPix)
+	}
+	var stats frameproto.Stats
+	receiveMessage(t, client, frameproto.TypeStats).Unmarshal(&stats)
+	if stats.FramesSent != 1 || stats.FramesSkipped != 0 {
+		t.Errorf("got %+v", stats)
+	}
+	msg := receive(t, legacy)
+	n := binary.LittleEndian.Uint16(msg.data)
+	if !msg.binary || len(msg.data) != 2+int(n)+4 || !strings.Contains(string(msg.data[2:2+n]), `"FrameCount":9`) {
+		t.Errorf("got legacy frame %q", msg.data)
+	}
+
+	// The camera disconnects.
+	h.CameraDisconnected(ctx, "EOF")
+	var disconnected frameproto.Disconnected
+	receiveMessage(t, client, frameproto.TypeDisconnected).Unmarshal(&disconnected)
+	if disconnected.Reason != "EOF" {
+		t.Errorf("got %+v", disconnected)
+	}
+	if msg := receive(t, legacy); msg.binary || string(msg.data) != frameproto.LegacyDisconnected {
+		t.Errorf("got %q, want the legacy disconnected message", msg.data)
+	}
+}
+
+func TestFrameProtocolUnsupportedVersion(t *testing.T) {
+	h, server := startHub(t)
+	client := dialWebsocket(t, server)
+	client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 3, Versions: []int{99}})
+	var resp frameproto.ErrorMessage
+	if err := json.Unmarshal(receive(t, client).data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != "Error" || !strings.Contains(resp.Message, "no supported protocol version") {
+		t.Errorf("got %+v", resp)
+	}
+	if msg, err := readMessage(client); err == nil {
+		t.Errorf("websocket still open, got %q", msg.data)
+	}
+	if h.HasClients() {
+		t.Error("client was registered")
+	}
+}
+
+func TestFrameProtocolErrors(t *testing.T) {
+	h, server := startHub(t)
+	client, _ := hello(t, server, 4, nil)
+
+	// Messages managementd doesn't know get an error but leave the client
+	// connected.
+	client.WriteJSON(frameproto.ClientMessage{Type: "Nonsense", Uuid: 4})
+	var resp frameproto.Error
+	if _, m := receiveSkippingStats(t, client); m.Type != frameproto.TypeError {
+		t.Fatalf("got a %v message, want error", m.Type)
+	} else if err := m.Unmarshal(&resp); err != nil || !strings.Contains(resp.Message, "unknown message type 'Nonsense'") {
+		t.Errorf("got %+v, %v", resp, err)
+	}
+	if !stillRegistered(h, 4) {
+		t.Error("client was unregistered")
+	}
+
+	// An invalid message gets an error before the websocket is closed.
+	client.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if _, m := receiveSkippingStats(t, client); m.Type != frameproto.TypeError {
+		t.Fatalf("got a %v message, want error", m.Type)
+	} else if err := m.Unmarshal(&resp); err != nil || !strings.Contains(resp.Message, "invalid message") {
+		t.Errorf("got %+v, %v", resp, err)
+	}
+	var closeErr *websocket.CloseError
+	if _, err := readMessage(client); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseUnsupportedData {
+		t.Errorf("got %v, want close code %d", err, websocket.CloseUnsupportedData)
+	}
+}
+
+// hello connects a client using the protocol with the profile.
+func hello(t *testing.T, server *httptest.Server, uuid int64, profile *frameproto.Profile) (*websocket.Conn, frameproto.WelcomeMessage) {
+	t.Helper()
+	ws := dialWebsocket(t, server)
+	ws.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: uuid, Versions: []int{1}, Profile: profile})
+	var welcome frameproto.WelcomeMessage
+	if err := json.Unmarshal(receive(t, ws).data, &welcome); err != nil {
+		t.Fatal(err)
+	}
+	receiveMessage(t, ws, frameproto.TypeStatus)
+	return ws, welcome
+}
+
+func TestFrameProfiles(t *testing.T) {
+	h, server := startHub(t)
+	ctx := context.Background()
+	h.CameraConnected(ctx, &frameproto.FrameInfo{Camera: frameproto.Camera{ResX: 2, ResY: 2}})
+
+	profile := &frameproto.Profile{Encoding: frameproto.EncodingDelta, Compression: frameproto.CompressionZstd}
+	first, welcome := hello(t, server, 11, profile)
+	want := frameproto.Profile{Encoding: frameproto.EncodingDelta, Compression: frameproto.CompressionZstd, Depth: 16}
+	if welcome.Profile != want {
+		t.Errorf("got profile %+v, want %+v", welcome.Profile, want)
+	}
+	second, _ := hello(t, server, 12, profile)
+	slow, _ := hello(t, server, 13, &frameproto.Profile{MaxFPS: 1})
+
+	frames := [][][]uint16{{{1, 2}, {3, 4}}, {{1, 2}, {3, 5}}}
+	decoders := []*frameproto.Decoder{{}, {}, {}}
+	for i, pix := range frames {
+		h.Publish(ctx, &FrameData{Frame: &cptvframe.Frame{Pix: pix, Status: cptvframe.Telemetry{FrameCount: i}}})
+		var shared []byte
+		for j, ws := range []*websocket.Conn{first, second, slow} {
+			if ws == slow && i > 0 {
+				continue
+			}
+			msg, m := receiveSkippingStats(t, ws)
+			_, got, err := decoders[j].Frame(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, pix) {
+				t.Errorf("client %d frame %d: got %v, want %v", j, i, got, pix)
+			}
+			if ws == slow {
+				if m.Flags != 0 {
+					t.Errorf("got flags %#x for the default profile", m.Flags)
+				}
+				continue
+			}
+			if delta := m.Flags&frameproto.FlagDelta != 0; delta != (i > 0) || m.Flags&frameproto.FlagZstd == 0 {
+				t.Errorf("client %d frame %d: got flags %#x", j, i, m.Flags)
+			}
+			if shared == nil {
+				shared = msg.data
+			} else if !reflect.DeepEqual(shared, msg.data) {
+				t.Errorf("frame %d was encoded differently for clients on the same profile", i)
+			}
+		}
+	}
+
+	// The slow client was only sent the first frame.
+	h.CameraDisconnected(ctx, "")
+	if _, m := receiveSkippingStats(t, slow); m.Type != frameproto.TypeDisconnected {
+		t.Errorf("got a %v message, want disconnected", m.Type)
+	}
+}
+
+// receiveSkippingStats reads the next binary message that isn't stats.
+func receiveSkippingStats(t *testing.T, ws *websocket.Conn) (received, frameproto.Message) {
+	t.Helper()
+	for {
+		msg := receive(t, ws)
+		m, err := frameproto.Decode(msg.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != frameproto.TypeStats {
+			return msg, m
+		}
+	}
+}
+
+func TestFrameProfileInvalid(t *testing.T) {
+	_, server := startHub(t)
+	client := dialWebsocket(t, server)
+	client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 14, Versions: []int{1}, Profile: &frameproto.Profile{Depth: 4}})
+	var resp frameproto.ErrorMessage
+	if err := json.Unmarshal(receive(t, client).data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != "Error" || !strings.Contains(resp.Message, "invalid profile") {
+		t.Errorf("got %+v", resp)
+	}
+}
@@ -0,0 +1,632 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/gorilla/websocket"
+)
+
+// FrameData is a frame from the camera, or news that the camera has
+// connected or disconnected.
+type FrameData struct {
+	Connected    bool
+	Disconnected bool
+	// Reason is why the camera disconnected.
+	Reason string
+	Frame  *cptvframe.Frame
+	Tracks []map[string]interface{}
+}
+
+// WebsocketRegistration is a client's websocket registered with a hub.
+type WebsocketRegistration struct {
+	hub             *frameHub
+	uuid            int64
+	Socket          *websocket.Conn
+	LastHeartbeatAt time.Time
+	// session is the ID of the session the websocket was opened with, or
+	// "" if it was opened with Basic credentials.
+	session string
+	// Version is the frame protocol version agreed with the client, or 0
+	// for a legacy client that registered without a Hello.
+	Version int
+	// Profile is how frames are sent to a client using the protocol.
+	Profile frameproto.Profile
+	// framesSent and framesSkipped are reported to the client in stats
+	// messages.
+	framesSent    atomic.Int64
+	framesSkipped atomic.Int64
+
+	// queue has the messages for the sender goroutine, which stops when
+	// stopping is closed and closes stopped when it has.
+	queueLock sync.Mutex
+	queue     *sendQueue
+	stopping  chan struct{}
+	stopped   chan struct{}
+	stopOnce  sync.Once
+	// lastSeq numbers the last frame sent to the client, for deltas, and
+	// lastStats is when stats were last sent. Only the sender goroutine
+	// uses them.
+	lastSeq   uint64
+	lastStats time.Time
+}
+
+// key is what the websocket is registered under.
+func (socket *WebsocketRegistration) key() clientKey {
+	return clientKey{session: socket.session, uuid: socket.uuid}
+}
+
+func (socket *WebsocketRegistration) Inactive() bool {
+	return time.Since(socket.LastHeartbeatAt) >= deviceSettings.SocketTimeout
+}
+
+// clientKey identifies a client. Clients choose their own UUIDs, so a
+// client is only the same one if it is in the same session too.
+type clientKey struct {
+	session string
+	uuid    int64
+}
+
+// frameHub passes the frames from the camera on to the websocket clients.
+// It owns the registered clients and what is known about the camera, which
+// are only changed through its methods.
+type frameHub struct {
+	mu sync.RWMutex
+	// clients are the registered websockets by the client's session and
+	// UUID. The LastHeartbeatAt of each is guarded by mu too.
+	clients map[clientKey]*WebsocketRegistration
+	// camera has the frame info shared by each frame while the camera is
+	// connected, or is nil when it isn't.
+	camera atomic.Pointer[frameproto.FrameInfo]
+	frames chan *FrameData
+	// senders are the goroutines sending to each client.
+	senders sync.WaitGroup
+	// firstClient is called when a client registers and there are no
+	// others, and the client is dropped if it fails.
+	firstClient func() error
+}
+
+func newFrameHub(firstClient func() error) *frameHub {
+	return &frameHub{
+		clients:     map[clientKey]*WebsocketRegistration{},
+		frames:      make(chan *FrameData, 4),
+		firstClient: firstClient,
+	}
+}
+
+// Clients returns how many websockets are registered.
+func (h *frameHub) Clients() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// HasClients reports whether any websockets are registered.
+func (h *frameHub) HasClients() bool {
+	return h.Clients() > 0
+}
+
+// Register adds the websocket to the ones sent frames, in place of an
+// earlier one from the same client, and tells it whether the camera is
+// connected. Only a websocket with the same UUID and session is replaced,
+// so that one client can't take another's place by using its UUID.
+func (h *frameHub) Register(uuid int64, ws *websocket.Conn, session string, version int, profile frameproto.Profile) (*WebsocketRegistration, error) {
+	socket := h.newRegistration(uuid, ws, session, version, profile)
+	h.mu.Lock()
+	first := len(h.clients) == 0
+	old := h.clients[socket.key()]
+	h.clients[socket.key()] = socket
+	// The status is queued with the lock held so that it comes before
+	// anything broadcast after the client is registered.
+	if version > 0 {
+		if msg, err := frameproto.Encode(frameproto.TypeStatus, h.Status(), nil); err == nil {
+			socket.enqueue(outgoing{msg: msg})
+		}
+	} else if h.Camera() == nil {
+		socket.enqueue(outgoing{msg: []byte(frameproto.LegacyDisconnected), text: true})
+	}
+	h.mu.Unlock()
+
+	if old != nil {
+		// The client has connected again.
+		old.stop()
+		if old.Socket != ws {
+			old.Socket.Close()
+		}
+	}
+	if first && h.firstClient != nil {
+		log.Print("Get new client register")
+		if err := h.firstClient(); err != nil {
+			// Nothing else can be sent until the sender has stopped.
+			h.unregister(socket)
+			<-socket.stopped
+			return nil, err
+		}
+	}
+	return socket, nil
+}
+
+// unregister removes the websocket if it is still registered, and stops
+// sending to it. It returns false if it had already been removed.
+func (h *frameHub) unregister(socket *WebsocketRegistration) bool {
+	h.mu.Lock()
+	registered := h.clients[socket.key()] == socket
+	if registered {
+		delete(h.clients, socket.key())
+	}
+	h.mu.Unlock()
+	socket.stop()
+	return registered
+}
+
+// Heartbeat keeps the client's websocket registered.
+func (h *frameHub) Heartbeat(socket *WebsocketRegistration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	socket.LastHeartbeatAt = time.Now()
+}
+
+// cull drops the websockets whose clients haven't answered a ping or sent
+// a message for the socket timeout.
+func (h *frameHub) cull() {
+	var inactive []*WebsocketRegistration
+	h.mu.Lock()
+	for key, socket := range h.clients {
+		if socket.Inactive() {
+			delete(h.clients, key)
+			inactive = append(inactive, socket)
+		}
+	}
+	h.mu.Unlock()
+	for _, socket := range inactive {
+		socket.stop()
+		go func() {
+			log.Println("Dropping old socket", socket.uuid)
+			_ = socket.Socket.Close()
+			log.Println("Dropped old socket", socket.uuid)
+		}()
+	}
+}
+
+// Camera returns the frame info of the camera, or nil if it isn't
+// connected.
+func (h *frameHub) Camera() *frameproto.FrameInfo {
+	return h.camera.Load()
+}
+
+// Status is the status message for the camera that is connected, if any.
+func (h *frameHub) Status() frameproto.Status {
+	status := frameproto.Status{AppVersion: version}
+	if info := h.Camera(); info != nil {
+		status.Connected = true
+		status.Camera = &info.Camera
+		status.BinaryVersion = info.BinaryVersion
+	}
+	return status
+}
+
+// CameraConnected records that the camera is connected, telling the
+// clients.
+func (h *frameHub) CameraConnected(ctx context.Context, info *frameproto.FrameInfo) error {
+	h.camera.Store(info)
+	if !h.HasClients() {
+		return nil
+	}
+	return h.Publish(ctx, &FrameData{Connected: true})
+}
+
+// CameraDisconnected records that the camera has gone, telling the clients
+// why.
+func (h *frameHub) CameraDisconnected(ctx context.Context, reason string) error {
+	h.camera.Store(nil)
+	return h.Publish(ctx, &FrameData{Disconnected: true, Reason: reason})
+}
+
+// Publish passes a frame on to be sent to the clients. The frame mustn't
+// be changed after it is published.
+func (h *frameHub) Publish(ctx context.Context, data *FrameData) error {
+	select {
+	case h.frames <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run sends what is published to the clients until ctx is done.
+func (h *frameHub) Run(ctx context.Context) {
+	// encoders are kept between frames for the profiles of the clients,
+	// as deltas need the frame before.
+	encoders := map[frameproto.Profile]*frameproto.Encoder{}
+	for {
+		select {
+		case data := <-h.frames:
+			h.broadcast(data, encoders)
+			h.cull()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// broadcast queues the frame for each client.
+func (h *frameHub) broadcast(data *FrameData, encoders map[frameproto.Profile]*frameproto.Encoder) {
+	frame := &encodedFrame{hub: h, data: data, encoders: encoders}
+	if info := h.Camera(); info != nil && data.Frame != nil {
+		frame.info = *info
+		frame.info.Telemetry = data.Frame.Status
+		frame.info.Tracks = data.Tracks
+	}
+	if !frame.isFrame() {
+		// The camera has started again.
+		for _, encoder := range encoders {
+			encoder.Reset()
+		}
+	}
+	// The frame is encoded without the lock held, so that registering and
+	// heartbeats aren't held up by it.
+	h.mu.RLock()
+	clients := slices.Collect(maps.Values(h.clients))
+	h.mu.RUnlock()
+	for _, socket := range clients {
+		if data.Connected && socket.Version == 0 {
+			// Legacy clients find out from the frames.
+			continue
+		}
+		o, ok, err := frame.message(socket)
+		if err != nil {
+			log.Printf("couldn't encode a message for protocol version %d: %v", socket.Version, err)
+			continue
+		}
+		if !ok {
+			// The client asked for fewer frames.
+			continue
+		}
+		socket.enqueue(o)
+	}
+	if frame.isFrame() {
+		// Forget the profiles no client uses any more.
+		for profile := range encoders {
+			if _, ok := frame.frames[profile]; !ok {
+				delete(encoders, profile)
+			}
+		}
+	}
+}
+
+// Close unregisters every websocket and closes it, telling the client why.
+// The websockets are hijacked connections, so http.Server.Shutdown doesn't
+// close them.
+func (h *frameHub) Close(ctx context.Context, reason string) {
+	h.mu.Lock()
+	registered := h.clients
+	h.clients = map[clientKey]*WebsocketRegistration{}
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, socket := range registered {
+		wg.Go(func() {
+			if err := socket.Close(ctx, websocket.CloseGoingAway, reason); err != nil {
+				log.Debugf("closing websocket %d: %v", socket.uuid, err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// sessionRevokedMessage is the reason given when a websocket is closed
+// because its session was revoked.
+const sessionRevokedMessage = "session revoked"
+
+// CloseSessions closes the websockets that were opened with the sessions,
+// which have been revoked.
+func (h *frameHub) CloseSessions(ids []string) {
+	h.mu.Lock()
+	var revoked []*WebsocketRegistration
+	for key, socket := range h.clients {
+		if socket.session != "" && slices.Contains(ids, socket.session) {
+			delete(h.clients, key)
+			revoked = append(revoked, socket)
+		}
+	}
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, socket := range revoked {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), deviceSettings.SocketWriteTimeout)
+			defer cancel()
+			if err := socket.Close(ctx, websocket.ClosePolicyViolation, sessionRevokedMessage); err != nil {
+				log.Debugf("closing websocket %d: %v", socket.uuid, err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// maxClientMessage is the largest message a client can send. Client
+// messages are small JSON, so a larger one closes the websocket.
+const maxClientMessage = 4096
+
+// upgrader only accepts websockets from pages served by managementd, as
+// the cookie is enough to use /ws.
+var upgrader = websocket.Upgrader{}
+
+// ServeWebsocket upgrades the request to a websocket for a client, which is
+// registered once it says hello and unregistered when it goes away.
+func (h *frameHub) ServeWebsocket(w http.ResponseWriter, r *http.Request) {
+	// The timeouts are read once for each websocket, before it is used.
+	timeout := deviceSettings.SocketTimeout
+	writeTimeout := deviceSettings.SocketWriteTimeout
+	session, _ := auth.SessionFromContext(r.Context())
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has replied with the error.
+		log.Debugf("websocket upgrade failed: %v", err)
+		return
+	}
+	h.serve(ws, session, timeout, writeTimeout)
+}
+
+// serve reads the client's messages until the websocket is closed, the
+// client sends a message that isn't valid, or it hasn't been heard from for
+// timeout. The client is pinged so that it doesn't need to send heartbeats.
+func (h *frameHub) serve(ws *websocket.Conn, session string, timeout, writeTimeout time.Duration) {
+	defer ws.Close()
+	var registered *WebsocketRegistration
+	defer func() {
+		if registered != nil {
+			h.unregister(registered)
+		}
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	go ping(ws, timeout/3, writeTimeout, done)
+
+	ws.SetReadLimit(maxClientMessage)
+	// Any message or pong shows that the client is still there.
+	alive := func() {
+		ws.SetReadDeadline(time.Now().Add(timeout))
+		if registered != nil {
+			h.Heartbeat(registered)
+		}
+	}
+	ws.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	alive()
+	// A client registering again, possibly with another uuid, replaces its
+	// registration. The old sender has to stop first, as only one goroutine
+	// can write to the websocket.
+	release := func() {
+		if registered != nil {
+			h.unregister(registered)
+			<-registered.stopped
+			registered = nil
+		}
+	}
+	// protocolVersion is the version the client was welcomed with, which
+	// is 0 before the Welcome and for legacy clients.
+	protocolVersion := 0
+	// fail closes the websocket, first telling a client that was welcomed
+	// what went wrong with an error message.
+	fail := func(code int, reason, message string) {
+		if protocolVersion > 0 {
+			release()
+			if msg, err := frameproto.Encode(frameproto.TypeError, frameproto.Error{Message: message}, nil); err == nil {
+				ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+				ws.WriteMessage(websocket.BinaryMessage, msg)
+			}
+		}
+		writeClose(ws, code, reason, time.Now().Add(writeTimeout))
+	}
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.Printf("websocket closed: %v", err)
+			} else {
+				log.Debugf("websocket closed: %v", err)
+			}
+			return
+		}
+		alive()
+		message := frameproto.ClientMessage{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Printf("closing websocket after an invalid message: %v", err)
+			fail(websocket.CloseUnsupportedData, "invalid message", "invalid message: "+err.Error())
+			return
+		}
+		switch message.Type {
+		case frameproto.Hello:
+			release()
+			protocolVersion = 0
+			ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			negotiated, profile, err := negotiate(message)
+			if err != nil {
+				ws.WriteJSON(frameproto.ErrorMessage{Type: "Error", Message: err.Error()})
+				writeClose(ws, websocket.CloseUnsupportedData, "unsupported hello", time.Now().Add(writeTimeout))
+				return
+			}
+			err = ws.WriteJSON(frameproto.WelcomeMessage{
+				Type:         frameproto.Welcome,
+				Version:      negotiated,
+				MessageTypes: frameproto.MessageTypes(),
+				AppVersion:   version,
+				Profile:      profile,
+			})
+			if err != nil {
+				log.Printf("couldn't welcome client %d: %v", message.Uuid, err)
+				return
+			}
+			protocolVersion = negotiated
+			if registered, err = h.Register(message.Uuid, ws, session, protocolVersion, profile); err != nil {
+				log.Println(err)
+				fail(websocket.CloseInternalServerErr, "couldn't register", err.Error())
+				return
+			}
+		case frameproto.Register:
+			release()
+			protocolVersion = 0
+			if registered, err = h.Register(message.Uuid, ws, session, 0, frameproto.Profile{}); err != nil {
+				log.Println(err)
+				return
+			}
+		case frameproto.Heartbeat:
+			// Only clients that don't answer pings need to send heartbeats,
+			// which keep the client registered like any other message.
+		default:
+			if registered == nil || protocolVersion == 0 {
+				break
+			}
+			msg, err := frameproto.Encode(frameproto.TypeError, frameproto.Error{Message: fmt.Sprintf("unknown message type '%s'", message.Type)}, nil)
+			if err == nil {
+				registered.enqueue(outgoing{msg: msg})
+			}
+		}
+	}
+}
+
+// ping pings the client every interval until done is closed.
+func ping(ws *websocket.Conn, interval, writeTimeout time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				// Reading fails too once the client is gone.
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeClose sends a close frame with the code and reason. The websocket
+// still has to be closed.
+func writeClose(ws *websocket.Conn, code int, reason string, deadline time.Time) error {
+	return ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
+// negotiate picks the protocol version and the profile for a Hello.
+func negotiate(hello frameproto.ClientMessage) (int, frameproto.Profile, error) {
+	protocolVersion, err := frameproto.Negotiate(hello.Versions)
+	if err != nil {
+		return 0, frameproto.Profile{}, err
+	}
+	var profile frameproto.Profile
+	if hello.Profile != nil {
+		profile = *hello.Profile
+	}
+	profile, err = profile.Normalize()
+	if err != nil {
+		return 0, frameproto.Profile{}, fmt.Errorf("invalid profile: %w", err)
+	}
+	return protocolVersion, profile, nil
+}
+
+// encodedFrame is a message for each protocol version, and for frames each
+// profile, made when the first client that needs it is sent it.
+type encodedFrame struct {
+	hub      *frameHub
+	data     *FrameData
+	info     frameproto.FrameInfo
+	msgs     map[int][]byte
+	encoders map[frameproto.Profile]*frameproto.Encoder
+	// frames has the frame for each profile, or nil if the profile isn't
+	// due a frame.
+	frames map[frameproto.Profile]*frameproto.EncodedFrame
+}
+
+func (f *encodedFrame) isFrame() bool {
+	return !f.data.Connected && !f.data.Disconnected
+}
+
+// message returns the message to queue for the socket, or false if the
+// socket's profile isn't due a frame.
+func (f *encodedFrame) message(socket *WebsocketRegistration) (outgoing, bool, error) {
+	if socket.Version > 0 && f.isFrame() {
+		frame := f.profileFrame(socket.Profile)
+		return outgoing{frame: frame, isFrame: true}, frame != nil, nil
+	}
+	o := outgoing{
+		isFrame: f.isFrame(),
+		text:    f.data.Disconnected && socket.Version == 0,
+	}
+	if msg, ok := f.msgs[socket.Version]; ok {
+		o.msg = msg
+		return o, true, nil
+	}
+	var msg []byte
+	var err error
+	switch {
+	case f.data.Connected:
+		msg, err = frameproto.Encode(frameproto.TypeStatus, f.hub.Status(), nil)
+	case f.data.Disconnected && socket.Version == 0:
+		msg = []byte(frameproto.LegacyDisconnected)
+	case f.data.Disconnected:
+		msg, err = frameproto.Encode(frameproto.TypeDisconnected, frameproto.Disconnected{Reason: f.data.Reason}, nil)
+	default:
+		msg, err = frameproto.EncodeLegacyFrame(f.info, f.data.Frame.Pix)
+	}
+	if err != nil {
+		return o, false, err
+	}
+	if f.msgs == nil {
+		f.msgs = map[int][]byte{}
+	}
+	f.msgs[socket.Version] = msg
+	o.msg = msg
+	return o, true, nil
+}
+
+func (f *encodedFrame) profileFrame(profile frameproto.Profile) *frameproto.EncodedFrame {
+	if frame, ok := f.frames[profile]; ok {
+		return frame
+	}
+	encoder, ok := f.encoders[profile]
+	if !ok {
+		encoder = frameproto.NewEncoder(profile)
+		f.encoders[profile] = encoder
+	}
+	var frame *frameproto.EncodedFrame
+	if encoder.Due(time.Now()) {
+		frame = encoder.Encode(f.info, f.data.Frame.Pix)
+	}
+	if f.frames == nil {
+		f.frames = map[frameproto.Profile]*frameproto.EncodedFrame{}
+	}
+	f.frames[profile] = frame
+	return frame
+}
@@ -0,0 +1,534 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/TheCacophonyProject/management-interface/settings"
+	"github.com/gorilla/websocket"
+)
+
+// startHub runs a hub and serves its websocket until the test ends.
+func startHub(t *testing.T) (*frameHub, *httptest.Server) {
+	t.Helper()
+	h := newFrameHub(nil)
+	return h, serveHub(t, h)
+}
+
+func serveHub(t *testing.T, h *frameHub) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(h.ServeWebsocket))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		h.Close(context.Background(), shutdownMessage)
+		server.Close()
+		cancel()
+		<-done
+		waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if !waitFor(waitCtx, &h.senders) {
+			t.Error("senders didn't stop")
+		}
+	})
+	return server
+}
+
+func TestHubFirstClient(t *testing.T) {
+	var calls atomic.Int32
+	var refuse atomic.Bool
+	h := newFrameHub(func() error {
+		calls.Add(1)
+		if refuse.Load() {
+			return errors.New("offload status unavailable")
+		}
+		return nil
+	})
+	server := serveHub(t, h)
+
+	// The client is dropped if the first client hook fails.
+	refuse.Store(true)
+	refused := dialWebsocket(t, server)
+	refused.WriteJSON(frameproto.ClientMessage{Type: frameproto.Register, Uuid: 31})
+	for {
+		if _, err := readMessage(refused); err != nil {
+			break
+		}
+	}
+	if h.HasClients() {
+		t.Error("client was registered though the first client hook failed")
+	}
+	// A client that was welcomed is told why.
+	welcomed := dialWebsocket(t, server)
+	welcomed.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 31, Versions: []int{1}})
+	receive(t, welcomed)
+	var resp frameproto.Error
+	if m := receiveMessage(t, welcomed, frameproto.TypeError); m.Unmarshal(&resp) != nil || !strings.Contains(resp.Message, "offload status unavailable") {
+		t.Errorf("got error %+v", resp)
+	}
+	var closeErr *websocket.CloseError
+	if _, err := readMessage(welcomed); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseInternalServerErr {
+		t.Errorf("got %v, want close code %d", err, websocket.CloseInternalServerErr)
+	}
+
+	refuse.Store(false)
+	hello(t, server, 32, nil)
+	hello(t, server, 33, nil)
+	// The hook runs after the client is sent the status.
+	for start := time.Now(); calls.Load() < 3; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			break
+		}
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("first client hook called %d times, want 3", got)
+	}
+	if got := h.Clients(); got != 2 {
+		t.Errorf("got %d clients, want 2", got)
+	}
+}
+
+func TestHubReplacesClient(t *testing.T) {
+	h, server := startHub(t)
+	old, _ := hello(t, server, 41, nil)
+	hello(t, server, 41, nil)
+	if got := h.Clients(); got != 1 {
+		t.Errorf("got %d clients, want 1", got)
+	}
+	// The websocket the client had before is closed.
+	for {
+		if _, err := readMessage(old); err != nil {
+			if strings.Contains(err.Error(), "timeout") {
+				t.Error("old websocket wasn't closed")
+			}
+			break
+		}
+	}
+}
+
+func TestHubReregisterOnSameConnection(t *testing.T) {
+	deviceSettings.SocketTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { deviceSettings.SocketTimeout = settings.Default().SocketTimeout })
+	h, server := startHub(t)
+	ctx := context.Background()
+	h.CameraConnected(ctx, &frameproto.FrameInfo{Camera: frameproto.Camera{ResX: 4, ResY: 2}})
+
+	stop := make(chan struct{})
+	var publisher sync.WaitGroup
+	publisher.Go(func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pix := [][]uint16{{uint16(i), 2, 3, 4}, {5, 6, 7, 8}}
+			h.Publish(ctx, &FrameData{Frame: &cptvframe.Frame{Pix: pix, Status: cptvframe.Telemetry{FrameCount: i}}})
+			time.Sleep(time.Millisecond)
+		}
+	})
+	defer func() {
+		close(stop)
+		publisher.Wait()
+	}()
+
+	client := dialWebsocket(t, server)
+	var messages atomic.Int64
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := readMessage(client); err != nil {
+				return
+			}
+			messages.Add(1)
+		}
+	}()
+	// As camera.ts does when the welcome is slow, the client registers
+	// again while frames are being sent to it.
+	for i := range 20 {
+		msg := frameproto.ClientMessage{Type: frameproto.Register, Uuid: 81}
+		if i%2 == 0 {
+			msg = frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 81, Versions: []int{1}}
+		}
+		if err := client.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Registering with another uuid replaces the first registration.
+	if err := client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Register, Uuid: 82}); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); stillRegistered(h, 81); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("first registration is still there")
+		}
+	}
+
+	// The websocket stays open past the socket timeout, as the client
+	// answers pings.
+	time.Sleep(3 * deviceSettings.SocketTimeout)
+	select {
+	case <-closed:
+		t.Fatal("websocket was closed")
+	default:
+	}
+	if !stillRegistered(h, 82) || h.Clients() != 1 {
+		t.Errorf("got %d clients, want only 82", h.Clients())
+	}
+	before := messages.Load()
+	time.Sleep(100 * time.Millisecond)
+	if messages.Load() == before {
+		t.Error("no frames were sent after registering again")
+	}
+}
+
+func TestHubClosesRevokedSessions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, goconfig.ConfigFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := goconfig.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.New(conf, dir, logging.NewLogger("error"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticator.ChangePassword("admin", "feathers", "new-password"); err != nil {
+		t.Fatal(err)
+	}
+	h := newFrameHub(nil)
+	authenticator.OnRevoke(h.CloseSessions)
+	server := httptest.NewServer(authenticator.RequireUser(http.HandlerFunc(h.ServeWebsocket)))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { h.Close(context.Background(), shutdownMessage) })
+
+	// connect opens a websocket with a new session, and returns the session
+	// token and the websocket's close error once it is closed.
+	connect := func(uuid int64) (string, <-chan error) {
+		token, _, err := authenticator.Login("admin", "new-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := http.Header{"Cookie": {auth.SessionCookie + "=" + token}}
+		ws, _, err := websocket.DefaultDialer.Dial(websocketURL(server), header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		ws.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: uuid, Versions: []int{1}})
+		receive(t, ws)
+		receiveMessage(t, ws, frameproto.TypeStatus)
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				if _, err := readMessage(ws); err != nil {
+					closed <- err
+					return
+				}
+			}
+		}()
+		return token, closed
+	}
+	checkClosed := func(closed <-chan error) {
+		t.Helper()
+		select {
+		case err := <-closed:
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != sessionRevokedMessage {
+				t.Errorf("got %v, want close code %d", err, websocket.ClosePolicyViolation)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("websocket wasn't closed")
+		}
+	}
+
+	// The same UUID in another session is another client, which doesn't
+	// replace the first.
+	loggedOut, loggedOutClosed := connect(91)
+	_, revokedClosed := connect(91)
+	if got := h.Clients(); got != 2 {
+		t.Errorf("got %d clients, want 2", got)
+	}
+	if err := authenticator.Logout(loggedOut); err != nil {
+		t.Fatal(err)
+	}
+	checkClosed(loggedOutClosed)
+	if got := h.Clients(); got != 1 || !stillRegistered(h, 91) {
+		t.Error("logging out didn't close only the websocket of the session")
+	}
+	if _, err := authenticator.RevokeSessions("admin"); err != nil {
+		t.Fatal(err)
+	}
+	checkClosed(revokedClosed)
+
+	_, changedClosed := connect(93)
+	if err := authenticator.ChangePassword("admin", "new-password", "another-password"); err != nil {
+		t.Fatal(err)
+	}
+	checkClosed(changedClosed)
+	if h.HasClients() {
+		t.Errorf("%d clients still registered", h.Clients())
+	}
+}
+
+func TestHubStatusForNewClients(t *testing.T) {
+	h, server := startHub(t)
+	h.CameraConnected(context.Background(), &frameproto.FrameInfo{Camera: frameproto.Camera{Model: "lepton3"}, BinaryVersion: "2.0"})
+	if got := h.Status(); !got.Connected || got.Camera.Model != "lepton3" || got.BinaryVersion != "2.0" {
+		t.Errorf("got status %+v", got)
+	}
+	client := dialWebsocket(t, server)
+	client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Hello, Uuid: 51, Versions: []int{1}})
+	receive(t, client)
+	var status frameproto.Status
+	receiveMessage(t, client, frameproto.TypeStatus).Unmarshal(&status)
+	if !status.Connected || status.Camera.Model != "lepton3" {
+		t.Errorf("got %+v", status)
+	}
+
+	h.CameraDisconnected(context.Background(), "EOF")
+	if h.Camera() != nil || h.Status().Connected {
+		t.Error("camera still connected")
+	}
+}
+
+// TestHubClientsJoiningAndLeaving has clients using each protocol join,
+// send heartbeats or stop sending them, and leave while frames are
+// broadcast and the camera comes and goes. It is meant to be run with the
+// race detector.
+func TestHubClientsJoiningAndLeaving(t *testing.T) {
+	deviceSettings.SocketTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { deviceSettings.SocketTimeout = settings.Default().SocketTimeout })
+	h, server := startHub(t)
+	camera := &frameproto.FrameInfo{Camera: frameproto.Camera{ResX: 4, ResY: 2}}
+	ctx := context.Background()
+	h.CameraConnected(ctx, camera)
+
+	stop := make(chan struct{})
+	var publisher sync.WaitGroup
+	publisher.Go(func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			switch {
+			case i%50 == 25:
+				h.CameraDisconnected(ctx, "EOF")
+			case i%50 == 30:
+				h.CameraConnected(ctx, camera)
+			default:
+				pix := [][]uint16{{uint16(i), 2, 3, 4}, {5, 6, 7, 8}}
+				h.Publish(ctx, &FrameData{Frame: &cptvframe.Frame{Pix: pix, Status: cptvframe.Telemetry{FrameCount: i}}})
+			}
+			_ = h.Clients()
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	profiles := []*frameproto.Profile{
+		nil,
+		{Encoding: frameproto.EncodingDelta, Compression: frameproto.CompressionZstd},
+		{Compression: frameproto.CompressionDeflate, Depth: 8},
+		{MaxFPS: 1},
+	}
+	var clients sync.WaitGroup
+	for n := range 40 {
+		clients.Go(func() {
+			for round := range 3 {
+				if err := runClient(websocketURL(server), int64(n), n%5 == 0, func() frameproto.ClientMessage {
+					if n%3 == 0 {
+						return frameproto.ClientMessage{Type: frameproto.Register, Uuid: int64(n)}
+					}
+					return frameproto.ClientMessage{Type: frameproto.Hello, Uuid: int64(n), Versions: []int{1}, Profile: profiles[(n+round)%len(profiles)]}
+				}()); err != nil {
+					t.Errorf("client %d round %d: %v", n, round, err)
+					return
+				}
+			}
+		})
+	}
+	clients.Wait()
+	close(stop)
+	publisher.Wait()
+
+	for start := time.Now(); h.HasClients(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%d clients still registered after they left", h.Clients())
+		}
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if !waitFor(waitCtx, &h.senders) {
+		t.Error("senders didn't stop after the clients left")
+	}
+}
+
+// runClient connects a client that reads messages for a while, sending
+// heartbeats, or if it is stale waits to be dropped for not sending them.
+func runClient(url string, uuid int64, stale bool, first frameproto.ClientMessage) error {
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if stale {
+		// Pongs would keep the client registered.
+		ws.SetPingHandler(func(string) error { return nil })
+	}
+	if err := ws.WriteJSON(first); err != nil {
+		return err
+	}
+	var messages atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, err := readMessage(ws); err != nil {
+				return
+			}
+			messages.Add(1)
+		}
+	}()
+
+	if stale {
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			return fmt.Errorf("wasn't dropped without heartbeats")
+		}
+		return nil
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for heartbeats := 0; heartbeats < 4 || messages.Load() < 2; heartbeats++ {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("was sent %d messages", messages.Load())
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := ws.WriteJSON(frameproto.ClientMessage{Type: frameproto.Heartbeat, Uuid: uuid}); err != nil {
+			return err
+		}
+	}
+	ws.Close()
+	<-done
+	return nil
+}
+
+func TestHubPingsKeepClientsRegistered(t *testing.T) {
+	deviceSettings.SocketTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { deviceSettings.SocketTimeout = settings.Default().SocketTimeout })
+	h, server := startHub(t)
+
+	// Neither client sends heartbeats, but only one answers pings.
+	answering, _ := hello(t, server, 61, nil)
+	silent, _ := hello(t, server, 62, nil)
+	silent.SetPingHandler(func(string) error { return nil })
+	silentClosed := make(chan struct{})
+	go func() {
+		defer close(silentClosed)
+		for {
+			if _, err := readMessage(silent); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			if _, err := readMessage(answering); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-silentClosed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("client that didn't answer pings wasn't dropped")
+	}
+	time.Sleep(3 * deviceSettings.SocketTimeout)
+	if !stillRegistered(h, 61) {
+		t.Error("client answering pings was dropped")
+	}
+	if stillRegistered(h, 62) {
+		t.Error("client that didn't answer pings is still registered")
+	}
+}
+
+func TestHubClosesOnBadMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		code int
+	}{
+		{"invalid JSON", []byte("not json"), websocket.CloseUnsupportedData},
+		{"too big", []byte(`{"type":"Heartbeat","data":"` + strings.Repeat("x", maxClientMessage) + `"}`), websocket.CloseMessageTooBig},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, server := startHub(t)
+			client, _ := hello(t, server, int64(70+i), nil)
+			client.WriteMessage(websocket.TextMessage, test.msg)
+			for {
+				_, err := readMessage(client)
+				if err == nil {
+					continue
+				}
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) || closeErr.Code != test.code {
+					t.Errorf("got %v, want close code %d", err, test.code)
+				}
+				break
+			}
+			for start := time.Now(); h.HasClients(); time.Sleep(10 * time.Millisecond) {
+				if time.Since(start) > 2*time.Second {
+					t.Fatal("client still registered")
+				}
+			}
+		})
+	}
+}
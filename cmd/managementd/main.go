@@ -20,25 +20,21 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
+	"strings"
 	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/godbus/dbus"
-
-	"github.com/gobuffalo/packr"
-
 	"github.com/gorilla/mux"
-	"golang.org/x/net/websocket"
 
 	goconfig "github.com/TheCacophonyProject/go-config"
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
@@ -46,48 +42,60 @@ import (
 	"github.com/TheCacophonyProject/lepton3"
 	managementinterface "github.com/TheCacophonyProject/management-interface"
 	"github.com/TheCacophonyProject/management-interface/api"
-	netmanagerclient "github.com/TheCacophonyProject/rpi-net-manager/netmanagerclient"
+	"github.com/TheCacophonyProject/management-interface/audit"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/TheCacophonyProject/management-interface/command"
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/TheCacophonyProject/management-interface/metrics"
+	"github.com/TheCacophonyProject/management-interface/peers"
+	"github.com/TheCacophonyProject/management-interface/settings"
 	"github.com/TheCacophonyProject/thermal-recorder/headers"
 	"github.com/alexflint/go-arg"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	configDir     = goconfig.DefaultConfigDir
-	socketTimeout = 7 * time.Second
-	frameSocket   = "/var/spool/managementd"
+	configDir = goconfig.DefaultConfigDir
+	// statsInterval is how often clients using the frame protocol are
+	// sent stats.
+	statsInterval = 5 * time.Second
 )
 
 var (
-	haveClients = make(chan bool)
-	version     = "<not set>"
-	sockets     = make(map[int64]*WebsocketRegistration)
-	socketsLock sync.RWMutex
-	headerInfo  *headers.HeaderInfo
-	frameCh     = make(chan *FrameData, 4)
-	connected   atomic.Bool
+	version = "<not set>"
+	// hub passes the frames from tc2-agent on to the websocket clients.
+	hub         = newFrameHub(nil)
 	log         = logging.NewLogger("info")
 	stayOnForMu sync.Mutex
-	lastStayOn  time.Time
+	// devicePeers are the services on the device that managementd talks to.
+	devicePeers peers.Peers
+	// commands runs the system commands that managementd uses.
+	commands   command.Runner = command.Exec{}
+	lastStayOn time.Time
+	// deviceSettings are the paths and timings from the managementd config.
+	deviceSettings = settings.Default()
+	// background has the frame listener and the hub, which are waited for
+	// on shutdown.
+	background sync.WaitGroup
 )
 
-func hasActiveClients() bool {
-	socketsLock.RLock()
-	defer socketsLock.RUnlock()
-	return len(sockets) > 0
-}
-
 // maybeTriggerStayOnFor will run the stay-on-for command if needed.
 // The stay-on-for command will stop tc2-hat-attiny from shutting down the RPi.
 // This should be called when there is an API request, as that indicates that a user is using the camera.
-// We throttle this to once every minute to avoid unnecessary calls.
+// We throttle this to once every stay-on-for-interval (a minute by default) to avoid unnecessary calls.
 // Because of the use of mutex we run this is a goroutine to avoid blocking the main thread.
 func maybeTriggerStayOnFor() {
+	if deviceSettings.StayOnFor == 0 {
+		return
+	}
 	go func() {
 		stayOnForMu.Lock()
 		defer stayOnForMu.Unlock()
-		if time.Since(lastStayOn) > time.Minute {
-			log.Debug("triggering stay-on-for 5 minutes")
-			out, err := exec.Command("stay-on-for", "5").CombinedOutput()
+		if time.Since(lastStayOn) > deviceSettings.StayOnForInterval {
+			minutes := fmt.Sprint(int(deviceSettings.StayOnFor / time.Minute))
+			log.Debugf("triggering stay-on-for %s minutes", minutes)
+			out, err := commands.Run(context.Background(), 10*time.Second, "stay-on-for", minutes)
 			if err != nil {
 				log.Errorf("error running stay-on-for: %s, error: %v", string(out), err)
 			} else {
@@ -98,6 +106,10 @@ func maybeTriggerStayOnFor() {
 }
 
 type Args struct {
+	HashPassword bool   `arg:"--hash-password" help:"read a password from stdin, print its hash for the managementd config and exit"`
+	Bus          string `arg:"--bus" default:"system" help:"bus that tc2-agent, thermal-recorder, modemd and the RTC are on: system, session or the address of a bus such as one fake-peers is on"`
+	FrameSocket  string `arg:"--frame-socket" default:"/var/spool/managementd" help:"socket that tc2-agent, or frame-source, sends camera frames to"`
+	AssetsDir    string `arg:"--assets-dir" help:"serve the html templates and static files from html/ and static/ in this directory, such as a checkout of this repository, instead of from the binary, reloading them on each request"`
 	logging.LogArgs
 }
 
@@ -111,20 +123,23 @@ func procArgs() Args {
 	return args
 }
 
-func GetTC2AgentDbus() (dbus.BusObject, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
-	return conn.Object("org.cacophony.TC2Agent", "/org/cacophony/TC2Agent"), nil
-}
-
 // Set up and handle page requests.
 func main() {
 	args := procArgs()
 
 	log = logging.NewLogger(args.LogLevel)
 
+	// Stop cleanly when systemd stops the service.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if args.HashPassword {
+		if err := printPasswordHash(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Printf("running version: %s", version)
 
 	config, err := ParseConfig(configDir)
@@ -133,18 +148,60 @@ func main() {
 		return
 	}
 	log.Printf("config: %v", config)
+	deviceSettings = config.Settings
+	managementinterface.Settings = config.Settings
+	profile, err := device.Detect(config.Settings.DeviceType)
+	if err != nil && config.Settings.DeviceType != "" {
+		log.Fatal(err)
+		return
+	} else if err != nil {
+		log.Printf("turning on everything but the D-Bus RTC: %v", err)
+	}
+	log.Printf("device profile: %v", profile)
+	managementinterface.Profile = profile
+	if profile.RP2040 {
+		// Only the RP2040 offloads files.
+		hub.firstClient = cancelOffload
+	}
 	if config.Port != 80 {
 		log.Printf("warning: avahi service is advertised on port 80 but port %v is being used", config.Port)
 	}
 
+	devicePeers = peers.NewDBus(peers.BusConnect(args.Bus))
+	if args.Bus != "system" {
+		log.Printf("using tc2-agent, thermal-recorder, modemd and the RTC on the %s bus", args.Bus)
+	}
+
+	authenticator, err := auth.New(config.config, configDir, log)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	// Websockets don't outlive the sessions they were opened with.
+	authenticator.OnRevoke(hub.CloseSessions)
+	auditLog, err := audit.New(deviceSettings.AuditLog, audit.DefaultMaxSize, audit.DefaultMaxBackups, log)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	if args.AssetsDir != "" {
+		if err := managementinterface.UseAssetsDir(args.AssetsDir); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving html templates and static files from %s", args.AssetsDir)
+	}
+
 	router := mux.NewRouter()
+	router.Use(metrics.Requests)
 
 	// Serve up static content.
-	static := packr.NewBox("../../static")
-	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(static)))
-	router.Handle("/ws", websocket.Handler(WebsocketServer))
+	static := managementinterface.StaticFiles()
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	router.Handle("/ws", authenticator.RequireUser(http.HandlerFunc(hub.ServeWebsocket)))
+	router.Handle("/metrics", authenticator.RequireUser(promhttp.Handler())).Methods("GET")
 	router.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
-		favicon, err := static.Find("favicon.ico")
+		favicon, err := fs.ReadFile(static, "favicon.ico")
 		if err != nil {
 			http.Error(w, "Favicon not found", http.StatusNotFound)
 			return
@@ -155,7 +212,7 @@ func main() {
 		w.Write(favicon)
 	})
 
-	go sendFrameToSockets()
+	background.Go(func() { hub.Run(ctx) })
 	// UI handlers.
 	router.HandleFunc("/", managementinterface.IndexHandler).Methods("GET")
 	router.HandleFunc("/wifi-networks", managementinterface.WifiNetworkHandler).Methods("GET")
@@ -177,172 +234,157 @@ func main() {
 	router.HandleFunc("/battery", managementinterface.Battery).Methods("GET")
 	router.HandleFunc("/battery-csv", managementinterface.DownloadBatteryCSV).Methods("GET")
 	router.HandleFunc("/temperature-csv", managementinterface.DownloadTemperatureCSV).Methods("GET")
+	router.HandleFunc("/change-password", managementinterface.ChangePassword).Methods("GET")
 
 	// API
-	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiObj, err := api.NewAPI(apiRouter, config.config, version, log)
+	apiObj, err := api.NewAPI(router, config.config, config.Settings, profile, devicePeers, commands, version, log)
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
-	apiRouter.HandleFunc("/device-info", apiObj.GetDeviceInfo).Methods("GET")
-	apiRouter.HandleFunc("/recordings", apiObj.GetRecordings).Methods("GET")
-	apiRouter.HandleFunc("/recording/{id}", apiObj.GetRecording).Methods("GET")
-	apiRouter.HandleFunc("/recording/{id}", apiObj.DeleteRecording).Methods("DELETE")
-	apiRouter.HandleFunc("/camera/snapshot", apiObj.TakeSnapshot).Methods("PUT")
-	apiRouter.HandleFunc("/camera/snapshot-recording", apiObj.TakeSnapshotRecording).Methods("PUT")
-	apiRouter.HandleFunc("/signal-strength", apiObj.GetSignalStrength).Methods("GET")
-	apiRouter.HandleFunc("/reregister", apiObj.Reregister).Methods("POST")
-	apiRouter.HandleFunc("/reregister-authorized", apiObj.ReregisterAuthorized).Methods("POST")
-	apiRouter.HandleFunc("/reboot", apiObj.Reboot).Methods("POST")
-	apiRouter.HandleFunc("/config", apiObj.GetConfig).Methods("GET")
-	apiRouter.HandleFunc("/config", apiObj.SetConfig).Methods("POST")
-	apiRouter.HandleFunc("/clear-config-section", apiObj.ClearConfigSection).Methods("POST")
-	apiRouter.HandleFunc("/location", apiObj.SetLocation).Methods("POST") // Set location via a POST request.
-	apiRouter.HandleFunc("/location", apiObj.GetLocation).Methods("GET")  // Get location via a POST request.
-	apiRouter.HandleFunc("/clock", apiObj.GetClock).Methods("GET")
-	apiRouter.HandleFunc("/clock", apiObj.PostClock).Methods("POST")
-	apiRouter.HandleFunc("/version", apiObj.GetVersion).Methods("GET")
-	apiRouter.HandleFunc("/event-keys", apiObj.GetEventKeys).Methods("GET")
-	apiRouter.HandleFunc("/events", apiObj.GetEvents).Methods("GET")
-	apiRouter.HandleFunc("/events", apiObj.DeleteEvents).Methods("DELETE")
-	apiRouter.HandleFunc("/trigger-trap", apiObj.TriggerTrap).Methods("PUT")
-	apiRouter.HandleFunc("/check-salt-connection", apiObj.CheckSaltConnection).Methods("GET")
-	apiRouter.HandleFunc("/salt-update", apiObj.StartSaltUpdate).Methods("POST")
-	apiRouter.HandleFunc("/salt-update", apiObj.GetSaltUpdateState).Methods("GET")
-	apiRouter.HandleFunc("/auto-update", apiObj.GetSaltAutoUpdate).Methods("GET")
-	apiRouter.HandleFunc("/auto-update", apiObj.PostSaltAutoUpdate).Methods("POST")
-	apiRouter.HandleFunc("/audiobait", apiObj.GetAudiobait).Methods("GET")
-	apiRouter.HandleFunc("/play-test-sound", apiObj.PlayTestSound).Methods("POST")
-	apiRouter.HandleFunc("/play-audiobait-sound", apiObj.PlayAudiobaitSound).Methods("POST")
-	apiRouter.HandleFunc("/logs", apiObj.GetServiceLogs).Methods("GET")
-	apiRouter.HandleFunc("/service", apiObj.GetServiceStatus).Methods("GET")
-	apiRouter.HandleFunc("/service-restart", apiObj.RestartService).Methods("POST")
-	apiRouter.HandleFunc("/modem", apiObj.GetModem).Methods("GET")
-	apiRouter.HandleFunc("/salt-grains", apiObj.GetSaltGrains).Methods("GET")
-	apiRouter.HandleFunc("/salt-grains", apiObj.SetSaltGrains).Methods("POST")
-	apiRouter.HandleFunc("/modem/apn", apiObj.SetAPN).Methods("POST")
-	apiRouter.HandleFunc("/modem-stay-on-for", apiObj.ModemStayOnFor).Methods("POST")
-	apiRouter.HandleFunc("/battery", apiObj.GetBattery).Methods("GET")
-	apiRouter.HandleFunc("/battery/config", apiObj.GetBatteryConfig).Methods("GET")
-	apiRouter.HandleFunc("/battery/config", apiObj.SetBatteryConfig).Methods("POST")
-	apiRouter.HandleFunc("/battery/config", apiObj.ClearBatteryConfig).Methods("DELETE")
-	apiRouter.HandleFunc("/test-videos", apiObj.GetTestVideos).Methods("GET")
-	apiRouter.HandleFunc("/play-test-video", apiObj.PlayTestVideo).Methods("POST")
-	apiRouter.HandleFunc("/upload-test-recording", apiObj.UploadTestRecording).Methods("POST")
-	apiRouter.HandleFunc("/network/interfaces", apiObj.GetNetworkInterfaces).Methods("GET")
-	apiRouter.HandleFunc("/network/wifi", apiObj.ScanWifiNetwork).Methods("GET")
-	apiRouter.HandleFunc("/network/wifi", apiObj.ConnectToWifi).Methods("POST")
-	apiRouter.HandleFunc("/network/wifi/save", apiObj.SaveWifiNetwork).Methods("POST")
-	apiRouter.HandleFunc("/network/wifi/saved", apiObj.GetSavedWifiNetworks).Methods("GET")
-	apiRouter.HandleFunc("/network/wifi/saved", apiObj.GetSavedWifiNetworks).Methods("GET")
-	apiRouter.HandleFunc("/network/wifi/forget", apiObj.ForgetWifiNetwork).Methods("DELETE")
-	apiRouter.HandleFunc("/network/wifi/current", apiObj.GetCurrentWifiNetwork).Methods("GET")
-	apiRouter.HandleFunc("/network/wifi/current", apiObj.DisconnectFromWifi).Methods("DELETE")
-	apiRouter.HandleFunc("/network/hotspot", apiObj.GetHotspotInterface).Methods("GET")
-	apiRouter.HandleFunc("/network/hotspot", apiObj.SetHotspotInterface).Methods("POST")
-	apiRouter.HandleFunc("/wifi-check", apiObj.CheckWifiInternetConnection).Methods("GET")
-	apiRouter.HandleFunc("/modem-check", apiObj.CheckModemInternetConnection).Methods("GET")
-	apiRouter.HandleFunc("/wifi-networks", apiObj.GetWifiNetworks).Methods("GET")
-	apiRouter.HandleFunc("/wifi-networks", apiObj.PostWifiNetwork).Methods("POST")
-	apiRouter.HandleFunc("/wifi-networks", apiObj.DeleteWifiNetwork).Methods("Delete")
-	apiRouter.HandleFunc("/wifi-network-scan", apiObj.ScanWifiNetwork).Methods("GET")
-	apiRouter.HandleFunc("/enable-wifi", apiObj.EnableWifi).Methods("POST")
-	apiRouter.HandleFunc("/enable-hotspot", apiObj.EnableHotspot).Methods("POST")
-	apiRouter.HandleFunc("/wifi-status", apiObj.GetConnectionStatus).Methods("GET")
-	apiRouter.HandleFunc("/upload-logs", apiObj.UploadLogs).Methods("PUT")
-
-	apiRouter.HandleFunc("/audiorecording", apiObj.SetAudioRecording).Methods("POST")
-	apiRouter.HandleFunc("/audiorecording", apiObj.GetAudioRecording).Methods("GET")
-	apiRouter.HandleFunc("/audio/long-recording", apiObj.TakeLongAudioRecording).Methods("PUT")
-	apiRouter.HandleFunc("/audio/test-recording", apiObj.TakeTestAudioRecording).Methods("PUT")
-	apiRouter.HandleFunc("/audio/audio-status", apiObj.AudioRecordingStatus).Methods("GET")
-	apiRouter.HandleFunc("/audio/recordings", apiObj.GetAudioRecordings).Methods("GET")
-
-	apiRouter.HandleFunc("/offload-status", apiObj.RecordingOffloadStatus).Methods("GET")
-	apiRouter.HandleFunc("/cancel-offload", apiObj.CancelOffload).Methods("PUT")
-	apiRouter.HandleFunc("/thermal/long-test-recording", apiObj.TakeLongTestThermalRecording).Methods("PUT")
-	apiRouter.HandleFunc("/thermal/short-test-recording", apiObj.TakeShortTestThermalRecording).Methods("PUT")
-	apiRouter.HandleFunc("/thermal/thermal-status", apiObj.TestThermalRecordingStatus).Methods("GET")
-	apiRouter.HandleFunc("/offload-now", apiObj.ForceRp2040Offload).Methods("PUT")
-	apiRouter.HandleFunc("/serve-frames-now", apiObj.PrioritiseFrameServe).Methods("PUT")
-
-	apiRouter.Use(basicAuth)
-
-	apiRouter.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			netmanagerclient.KeepHotspotOnFor(60 * 5)
-			maybeTriggerStayOnFor()
-			next.ServeHTTP(w, r)
-		})
-	})
+	var tlsCert tls.Certificate
+	if config.TLSPort != 0 {
+		tlsCert, err = loadOrCreateCertificate(config.config, configDir)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+	}
+	newAPIHandlers(apiObj, authenticator, auditLog, tlsCert, config.TLSPort).addAPI(router)
+
+	background.Go(func() { listenForFrames(ctx, args.FrameSocket, profile) })
+
+	var handler http.Handler = router
+	servers := []*http.Server{}
+	serverErr := make(chan error, 2)
+	if config.TLSPort != 0 {
+		tlsServer := &http.Server{
+			Addr:      fmt.Sprintf(":%d", config.TLSPort),
+			Handler:   router,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{tlsCert}},
+		}
+		servers = append(servers, tlsServer)
+		go func() {
+			log.Printf("listening for HTTPS on %s", tlsServer.Addr)
+			serverErr <- tlsServer.ListenAndServeTLS("", "")
+		}()
+		if config.RedirectToHTTPS {
+			handler = redirectToHTTPS(config.TLSPort)
+		}
+	}
 
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Port),
+		Handler: handler,
+	}
+	servers = append(servers, server)
 	go func() {
-		for {
-			err := os.Remove(frameSocket)
-			if err != nil && !os.IsNotExist(err) {
-				log.Printf("Couldn't remove  %v %v\n", frameSocket, err)
-				time.Sleep(1000)
-				continue
-			}
+		log.Printf("listening on %s", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
 
-			listener, err := net.Listen("unix", frameSocket)
-			if err != nil {
-				log.Println("Couldn't make socket", err)
+	failed := false
+	select {
+	case err := <-serverErr:
+		log.Errorf("server failed: %v", err)
+		failed = true
+		stop()
+	case <-ctx.Done():
+		log.Print("stopping")
+	}
+	shutdown(servers)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// listenForFrames accepts one connection at a time on the frame socket from
+// tc2-agent and passes the frames on to the websockets, until ctx is done.
+// While there are websocket clients, an RP2040 is asked to serve frames.
+func listenForFrames(ctx context.Context, socketPath string, profile device.Profile) {
+	defer func() {
+		if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("couldn't remove %v: %v", socketPath, err)
+		}
+	}()
+	connections := 0
+	for ctx.Err() == nil {
+		err := os.Remove(socketPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Couldn't remove  %v %v\n", socketPath, err)
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			log.Println("Couldn't make socket", err)
+			return
+		}
+		stopListening := context.AfterFunc(ctx, func() { listener.Close() })
+		log.Print("waiting for frames from tc2-agent")
+
+		listener.(*net.UnixListener).SetDeadline(time.Now().Add(5 * time.Second))
+		conn, err := listener.Accept()
+		if err != nil {
+			stopListening()
+			listener.Close()
+			if ctx.Err() != nil {
 				return
 			}
-			log.Print("waiting for frames from tc2-agent")
-
-			listener.(*net.UnixListener).SetDeadline(time.Now().Add(5 * time.Second))
-			conn, err := listener.Accept()
-			if err != nil {
-				if err.(net.Error).Timeout() {
-					log.Printf("socket accept timed out, retrying...")
-
-					if hasActiveClients() {
-						listener.(*net.UnixListener).SetDeadline(time.Now().Add(30 * time.Second))
-						// If there are users connected via web sockets, force the frames to get served.
-						log.Println("Websocket has clients, forcing frame priority")
-						tc2AgentDbus, err := GetTC2AgentDbus()
-						if err != nil {
-							log.Println(err)
-							return
-						}
-						var result string
-						err = tc2AgentDbus.Call("org.cacophony.TC2Agent.prioritiseframeserve", 0).Store(&result)
-						if err != nil {
-							log.Println(err)
-							return
-						}
+			if err.(net.Error).Timeout() {
+				log.Printf("socket accept timed out, retrying...")
+
+				if profile.RP2040 && hub.HasClients() {
+					// If there are users connected via web sockets, force the frames to get served.
+					log.Println("Websocket has clients, forcing frame priority")
+					if _, err := devicePeers.TC2Agent.PrioritiseFrameServe(); err != nil {
+						log.Println(err)
 					}
-
-					continue
 				}
-				log.Printf("socket accept failed: %v", err)
+
 				continue
 			}
+			log.Printf("socket accept failed: %v", err)
+			continue
+		}
 
-			// Prevent concurrent connections.
-			listener.Close()
-
-			log.Printf("accepted connection from client")
-			err = handleConn(conn)
-			frameCh <- &FrameData{Disconnected: true}
-			log.Printf("camera connection ended with: %v", err)
-			connected.Store(false)
+		// Prevent concurrent connections.
+		stopListening()
+		listener.Close()
 
+		log.Printf("accepted connection from client")
+		if connections > 0 {
+			frameReconnects.Inc()
 		}
-	}()
+		connections++
+		frameConnectedAt.Store(time.Now().UnixNano())
+		stopConn := context.AfterFunc(ctx, func() { conn.Close() })
+		err = handleConn(ctx, conn)
+		stopConn()
+		conn.Close()
+		frameConnectedAt.Store(0)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("camera connection ended with: %v", err)
+		hub.CameraDisconnected(ctx, fmt.Sprint(err))
+	}
+}
 
-	listenAddr := fmt.Sprintf(":%d", config.Port)
-	log.Printf("listening on %s", listenAddr)
-	log.Fatal(http.ListenAndServe(listenAddr, router))
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
 }
 
-func handleConn(conn net.Conn) error {
+func handleConn(ctx context.Context, conn net.Conn) error {
 	reader := bufio.NewReader(conn)
-	var err error
-	headerInfo, err = headers.ReadHeaderInfo(reader)
+	headerInfo, err := headers.ReadHeaderInfo(reader)
 	if err != nil {
 		return err
 	}
@@ -359,23 +401,32 @@ func handleConn(conn net.Conn) error {
 	frame := cptvframe.NewFrame(headerInfo)
 	frames := 0
 	var lastFrame *FrameData
-	connected.Store(true)
+	if err := hub.CameraConnected(ctx, newCameraInfo(ctx, headerInfo)); err != nil {
+		return err
+	}
 	for {
 		_, err := io.ReadFull(reader, rawFrame)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			log.Println("Error reading frame ", err)
 			return err
 		}
-		if len(sockets) == 0 {
+		framesReceived.Inc()
+		if !hub.HasClients() {
 			continue
 		}
 		if err := lepton3.ParseRawFrame(rawFrame, frame, 0); err != nil {
 			log.Println("Could not parse lepton3 frame", err)
 		} else {
+			// The frame is parsed into again while the hub is sending it.
 			lastFrame = &FrameData{
-				Frame: frame,
+				Frame: frame.CreateCopy(),
+			}
+			if err := hub.Publish(ctx, lastFrame); err != nil {
+				return err
 			}
-			frameCh <- lastFrame
 			frames += 1
 			if frames == 1 || frames%100 == 0 {
 				log.Printf("Got %v frames\n", frames)
@@ -385,198 +436,62 @@ func handleConn(conn net.Conn) error {
 	}
 }
 
-func basicAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userPassEncoded := "YWRtaW46ZmVhdGhlcnM=" // admin:feathers base64 encoded.
-		if r.Header.Get("Authorization") == "Basic "+userPassEncoded {
-			next.ServeHTTP(w, r)
-		} else {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-		}
-	})
-}
-
-type WebsocketRegistration struct {
-	AtomicLock      uint32
-	Socket          *websocket.Conn
-	LastHeartbeatAt time.Time
-}
-
-func (socket *WebsocketRegistration) Inactive() bool {
-	return time.Since(socket.LastHeartbeatAt) >= socketTimeout
-}
-
-type message struct {
-	// the json tag means this will serialize as a lowercased field
-	Type string `json:"type"`
-	Data string `json:"data"`
-	Uuid int64  `json:"uuid"`
+// printPasswordHash reads a password from stdin and prints the hash to use
+// for a user's password-hash in the managementd config.
+func printPasswordHash() error {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
 }
 
-func WebsocketServer(ws *websocket.Conn) {
-	for {
-		// Receive any messages from the client
-		message := message{}
-		if err := websocket.JSON.Receive(ws, &message); err != nil {
-			// Probably EOF error, when there's no message.  Maybe could sleep, so we're not thrashing this?
-		} else {
-			// When we first get a connection, register the websocket and push it onto an array of websockets.
-			// Occasionally go through the list and cull any that are no-longer sending heart-beats.
-			if message.Type == "Register" {
-				socketsLock.Lock()
-				firstSocket := len(sockets) == 0
-				sockets[message.Uuid] = &WebsocketRegistration{
-					Socket:          ws,
-					LastHeartbeatAt: time.Now(),
-					AtomicLock:      0,
-				}
-				if !connected.Load() {
-					_ = websocket.Message.Send(ws, "disconnected")
-				}
-				socketsLock.Unlock()
-				if firstSocket {
-					log.Print("Get new client register")
-					{
-						tc2AgentDbus, err := GetTC2AgentDbus()
-						if err != nil {
-							log.Println(err)
-							return
-						}
-						var isOffloading int
-						var percentComplete int
-						var secondsRemaining int
-						var filesTotal int
-						var filesRemaining int
-						var eventsTotal int
-						var eventsRemaining int
-						err = tc2AgentDbus.Call("org.cacophony.TC2Agent.offloadstatus", 0).Store(&isOffloading, &percentComplete, &secondsRemaining, &filesTotal, &filesRemaining, &eventsTotal, &eventsRemaining)
-						if err != nil {
-							log.Println(err)
-							return
-						}
-						if isOffloading == 1 {
-							log.Printf("rp2040 is offloading files")
-							var result string
-							err = tc2AgentDbus.Call("org.cacophony.TC2Agent.canceloffload", 0).Store(&result)
-							if err != nil {
-								log.Println(err)
-								return
-							}
-							log.Printf("requested offload cancellation")
-						}
-					}
-					haveClients <- true
-				}
-			}
-			if message.Type == "Heartbeat" {
-				if socket, ok := sockets[message.Uuid]; ok {
-					socket.LastHeartbeatAt = time.Now()
-				}
-			}
-		}
-		time.Sleep(1 * time.Millisecond)
+// newCameraInfo is the frame info shared by each frame from a camera.
+func newCameraInfo(ctx context.Context, h *headers.HeaderInfo) *frameproto.FrameInfo {
+	return &frameproto.FrameInfo{
+		Camera: frameproto.Camera{
+			Brand:        h.Brand(),
+			Model:        h.Model(),
+			FPS:          h.FPS(),
+			ResX:         h.ResX(),
+			ResY:         h.ResY(),
+			Firmware:     h.Firmware(),
+			CameraSerial: h.CameraSerial(),
+		},
+		AppVersion:    version,
+		BinaryVersion: packageVersion(ctx, "tc2-agent"),
 	}
 }
 
-type FrameInfo struct {
-	Camera        map[string]interface{}
-	Telemetry     cptvframe.Telemetry
-	Calibration   map[string]interface{}
-	BinaryVersion string
-	AppVersion    string
-	Mode          string
-	Tracks        []map[string]interface{}
+// packageVersion returns the installed version of a package, or "" if it
+// isn't installed.
+func packageVersion(ctx context.Context, name string) string {
+	out, err := commands.Run(ctx, 5*time.Second, "dpkg-query", "--show", "--showformat=${Version}", name)
+	if err != nil {
+		log.Debugf("couldn't get the %s version: %v", name, err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
 }
 
-func sendFrameToSockets() {
-	frameNum := 0
-	var lastFrame *FrameData
-
-	for {
-		// NOTE: Only bother with this work if we have clients connected.
-		lastFrame = <-frameCh
-
-		if len(sockets) != 0 {
-			if lastFrame.Disconnected {
-				socketsLock.RLock()
-				for uuid, socket := range sockets {
-					go func(socket *WebsocketRegistration, uuid int64, frameNum int) {
-						// If the socket is busy sending the previous frame,
-						// don't block, just move on to the next socket.
-						if atomic.CompareAndSwapUint32(&socket.AtomicLock, 0, 1) {
-							_ = websocket.Message.Send(socket.Socket, "disconnected")
-							atomic.StoreUint32(&socket.AtomicLock, 0)
-						} else {
-							time.Sleep(100 * time.Millisecond)
-						}
-					}(socket, uuid, frameNum)
-				}
-				socketsLock.RUnlock()
-			} else {
-				// Make the frame info
-				buffer := bytes.NewBuffer(make([]byte, 0))
-				frameInfo := FrameInfo{
-					Camera:    map[string]interface{}{"ResX": headerInfo.ResX(), "ResY": headerInfo.ResY()},
-					Telemetry: lastFrame.Frame.Status,
-					Tracks:    lastFrame.Tracks,
-				}
-				frameInfoJson, _ := json.Marshal(frameInfo)
-				frameInfoLen := len(frameInfoJson)
-				// Write out the length of the frameInfo json as a u16
-				_ = binary.Write(buffer, binary.LittleEndian, uint16(frameInfoLen))
-				_ = binary.Write(buffer, binary.LittleEndian, frameInfoJson)
-				for _, row := range lastFrame.Frame.Pix {
-					_ = binary.Write(buffer, binary.LittleEndian, row)
-				}
-				// Send the buffer back to the client
-				frameBytes := buffer.Bytes()
-				socketsLock.RLock()
-				for uuid, socket := range sockets {
-					go func(socket *WebsocketRegistration, uuid int64, frameNum int) {
-						// If the socket is busy sending the previous frame,
-						// don't block, just move on to the next socket.
-						if atomic.CompareAndSwapUint32(&socket.AtomicLock, 0, 1) {
-							_ = websocket.Message.Send(socket.Socket, frameBytes)
-							atomic.StoreUint32(&socket.AtomicLock, 0)
-						} else {
-							// Locked, skip this frame to let client catch up.
-							log.Println("Skipping frame for", uuid, frameNum)
-						}
-					}(socket, uuid, frameNum)
-				}
-				socketsLock.RUnlock()
-				frameNum = lastFrame.Frame.Status.FrameCount
-			}
-			var socketsToRemove []int64
-			socketsLock.RLock()
-			for uuid, socket := range sockets {
-				if socket.Inactive() {
-					socketsToRemove = append(socketsToRemove, uuid)
-				}
-			}
-			socketsLock.RUnlock()
-			if len(socketsToRemove) != 0 {
-				socketsLock.Lock()
-				for _, socketUuid := range socketsToRemove {
-					socket := sockets[socketUuid]
-					delete(sockets, socketUuid)
-					go func(socket *WebsocketRegistration, uuid int64) {
-						log.Println("Dropping old socket", uuid)
-						_ = socket.Socket.Close()
-						log.Println("Dropped old socket", uuid)
-					}(socket, socketUuid)
-				}
-				socketsLock.Unlock()
-			}
-		} else {
-			log.Print("Wait for new client camera register")
-			<-haveClients
+// cancelOffload stops the RP2040 offloading files when the first client
+// wants to see the camera, as frames aren't sent while it is.
+func cancelOffload() error {
+	status, err := devicePeers.TC2Agent.OffloadStatus()
+	if err != nil {
+		return err
+	}
+	if status.InProgress {
+		log.Printf("rp2040 is offloading files")
+		if _, err := devicePeers.TC2Agent.CancelOffload(); err != nil {
+			return err
 		}
+		log.Printf("requested offload cancellation")
 	}
-}
-
-type FrameData struct {
-	Disconnected bool
-	Frame        *cptvframe.Frame
-	Tracks       []map[string]interface{}
+	return nil
 }
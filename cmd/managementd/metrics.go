@@ -0,0 +1,64 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	framesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "managementd_frames_received_total",
+		Help: "Camera frames received from tc2-agent on the frame socket.",
+	})
+	framesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "managementd_frames_skipped_total",
+		Help: "Frames not sent to websocket clients because they were too slow and a newer frame replaced them.",
+	})
+	frameReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "managementd_frame_socket_reconnects_total",
+		Help: "Times tc2-agent connected to the frame socket again after its last connection ended.",
+	})
+	// frameConnectedAt is when tc2-agent connected to the frame socket, in
+	// Unix nanoseconds, or 0 when it isn't connected.
+	frameConnectedAt atomic.Int64
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "managementd_websockets",
+		Help: "Websocket clients registered for camera frames.",
+	}, func() float64 {
+		return float64(hub.Clients())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "managementd_frame_connection_uptime_seconds",
+		Help: "How long tc2-agent has been connected to the frame socket, or 0 when it isn't.",
+	}, func() float64 {
+		at := frameConnectedAt.Load()
+		if at == 0 {
+			return 0
+		}
+		return time.Since(time.Unix(0, at)).Seconds()
+	})
+}
@@ -0,0 +1,201 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/TheCacophonyProject/management-interface/audit"
+	"github.com/TheCacophonyProject/management-interface/auth"
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/ratelimit"
+)
+
+// apiHandlers has everything the API routes are handled with, shared by
+// each version of the API so that rate limits apply across them.
+type apiHandlers struct {
+	api           *api.ManagementAPI
+	authenticator *auth.Authenticator
+	auditLog      *audit.Log
+	tlsCert       tls.Certificate
+	tlsPort       int
+
+	// Limits for routes that are slow or expensive for the device.
+	wifiScanLimit   *ratelimit.Limiter
+	uploadLogsLimit *ratelimit.Limiter
+	saltUpdateLimit *ratelimit.Limiter
+}
+
+// newAPIHandlers returns the handlers for the API. The /tls-fingerprint
+// route is only added when tlsPort is set.
+func newAPIHandlers(apiObj *api.ManagementAPI, authenticator *auth.Authenticator, auditLog *audit.Log, tlsCert tls.Certificate, tlsPort int) *apiHandlers {
+	return &apiHandlers{
+		api:             apiObj,
+		authenticator:   authenticator,
+		auditLog:        auditLog,
+		tlsCert:         tlsCert,
+		tlsPort:         tlsPort,
+		wifiScanLimit:   ratelimit.New("wifi scan", 10*time.Second, 2, log),
+		uploadLogsLimit: ratelimit.New("upload logs", time.Minute, 1, log),
+		saltUpdateLimit: ratelimit.New("salt update", time.Minute, 1, log),
+	}
+}
+
+// addAPI serves the API under /api/v<n> for each version, and under /api
+// for the latest version. The routes of each version share the same
+// handlers, with api.Version adapting the responses for older versions.
+func (h *apiHandlers) addAPI(router *mux.Router) {
+	// The versioned prefixes have to be added first, as /api matches them too.
+	for _, version := range api.Versions {
+		h.addVersion(router.PathPrefix(api.VersionPrefix(version)).Subrouter(), version, false)
+	}
+	h.addVersion(router.PathPrefix("/api").Subrouter(), api.LatestVersion, true)
+}
+
+func (h *apiHandlers) addVersion(apiRouter *mux.Router, version int, unversioned bool) {
+	h.registerRoutes(apiRouter)
+
+	apiRouter.Use(api.RequestID)
+	apiRouter.Use(api.Version(version, unversioned))
+	// The audit log comes first so that refused requests are recorded.
+	apiRouter.Use(h.auditLog.Middleware)
+	apiRouter.Use(h.authenticator.RequireUser)
+
+	apiRouter.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			devicePeers.NetManager.KeepHotspotOnFor(int(deviceSettings.KeepHotspotOnFor.Seconds()))
+			maybeTriggerStayOnFor()
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// registerRoutes adds the API routes to apiRouter. Every route has to be
+// described in api/openapi.json, which is checked by the tests.
+func (h *apiHandlers) registerRoutes(apiRouter *mux.Router) {
+	apiObj, authenticator, auditLog := h.api, h.authenticator, h.auditLog
+	wifiScanLimit, uploadLogsLimit, saltUpdateLimit := h.wifiScanLimit, h.uploadLogsLimit, h.saltUpdateLimit
+
+	// Each API route is tagged with the minimum role a user needs to call it.
+	handle := func(path string, role auth.Role, f http.HandlerFunc) *mux.Route {
+		return apiRouter.Handle(path, authenticator.RequireRole(role, f))
+	}
+	// Routes for hardware that not every device has respond with 501 Not
+	// Implemented on the devices without it.
+	needs := apiObj.Requires
+	handle("/device-info", auth.Viewer, apiObj.GetDeviceInfo).Methods("GET")
+	handle("/health", auth.Viewer, apiObj.GetHealth).Methods("GET")
+	handle("/recordings", auth.Viewer, apiObj.GetRecordings).Methods("GET")
+	handle("/recording/{id}", auth.Operator, apiObj.GetRecording).Methods("GET")
+	handle("/recording/{id}", auth.Admin, apiObj.DeleteRecording).Methods("DELETE")
+	handle("/camera/snapshot", auth.Viewer, needs(device.ThermalCamera, apiObj.TakeSnapshot)).Methods("PUT")
+	handle("/camera/snapshot-recording", auth.Operator, needs(device.ThermalCamera, apiObj.TakeSnapshotRecording)).Methods("PUT")
+	handle("/signal-strength", auth.Viewer, needs(device.Modem, apiObj.GetSignalStrength)).Methods("GET")
+	handle("/reregister", auth.Admin, apiObj.Reregister).Methods("POST")
+	handle("/reregister-authorized", auth.Admin, apiObj.ReregisterAuthorized).Methods("POST")
+	handle("/reboot", auth.Admin, apiObj.Reboot).Methods("POST")
+	handle("/config", auth.Admin, apiObj.GetConfig).Methods("GET")
+	handle("/config", auth.Admin, apiObj.SetConfig).Methods("POST")
+	handle("/clear-config-section", auth.Admin, apiObj.ClearConfigSection).Methods("POST")
+	// Field volunteers are viewers, and setting the location is part of
+	// putting a device out.
+	handle("/location", auth.Viewer, apiObj.SetLocation).Methods("POST")
+	handle("/location", auth.Viewer, apiObj.GetLocation).Methods("GET")
+	handle("/clock", auth.Viewer, apiObj.GetClock).Methods("GET")
+	handle("/clock", auth.Operator, apiObj.PostClock).Methods("POST")
+	handle("/version", auth.Viewer, apiObj.GetVersion).Methods("GET")
+	handle("/event-keys", auth.Operator, apiObj.GetEventKeys).Methods("GET")
+	handle("/events", auth.Operator, apiObj.GetEvents).Methods("GET")
+	handle("/events", auth.Admin, apiObj.DeleteEvents).Methods("DELETE")
+	handle("/trigger-trap", auth.Operator, apiObj.TriggerTrap).Methods("PUT")
+	handle("/check-salt-connection", auth.Admin, apiObj.CheckSaltConnection).Methods("GET")
+	handle("/salt-update", auth.Admin, saltUpdateLimit.Limit(apiObj.StartSaltUpdate)).Methods("POST")
+	handle("/salt-update", auth.Admin, apiObj.GetSaltUpdateState).Methods("GET")
+	handle("/auto-update", auth.Admin, apiObj.GetSaltAutoUpdate).Methods("GET")
+	handle("/auto-update", auth.Admin, apiObj.PostSaltAutoUpdate).Methods("POST")
+	handle("/audiobait", auth.Viewer, apiObj.GetAudiobait).Methods("GET")
+	handle("/play-test-sound", auth.Operator, apiObj.PlayTestSound).Methods("POST")
+	handle("/play-audiobait-sound", auth.Operator, apiObj.PlayAudiobaitSound).Methods("POST")
+	handle("/logs", auth.Admin, apiObj.GetServiceLogs).Methods("GET")
+	handle("/service", auth.Operator, apiObj.GetServiceStatus).Methods("GET")
+	handle("/service-restart", auth.Admin, apiObj.RestartService).Methods("POST")
+	handle("/modem", auth.Viewer, needs(device.Modem, apiObj.GetModem)).Methods("GET")
+	handle("/salt-grains", auth.Admin, apiObj.GetSaltGrains).Methods("GET")
+	handle("/salt-grains", auth.Admin, apiObj.SetSaltGrains).Methods("POST")
+	handle("/modem/apn", auth.Admin, needs(device.Modem, apiObj.SetAPN)).Methods("POST")
+	handle("/modem-stay-on-for", auth.Operator, needs(device.Modem, apiObj.ModemStayOnFor)).Methods("POST")
+	handle("/battery", auth.Viewer, apiObj.GetBattery).Methods("GET")
+	handle("/battery/config", auth.Viewer, apiObj.GetBatteryConfig).Methods("GET")
+	handle("/battery/config", auth.Admin, apiObj.SetBatteryConfig).Methods("POST")
+	handle("/battery/config", auth.Admin, apiObj.ClearBatteryConfig).Methods("DELETE")
+	handle("/test-videos", auth.Operator, needs(device.ThermalCamera, apiObj.GetTestVideos)).Methods("GET")
+	handle("/play-test-video", auth.Admin, needs(device.ThermalCamera, apiObj.PlayTestVideo)).Methods("POST")
+	handle("/upload-test-recording", auth.Admin, needs(device.ThermalCamera, apiObj.UploadTestRecording)).Methods("POST")
+	handle("/network/interfaces", auth.Operator, apiObj.GetNetworkInterfaces).Methods("GET")
+	handle("/network/wifi", auth.Operator, wifiScanLimit.Limit(apiObj.ScanWifiNetwork)).Methods("GET")
+	handle("/network/wifi", auth.Operator, apiObj.ConnectToWifi).Methods("POST")
+	handle("/network/wifi/save", auth.Operator, apiObj.SaveWifiNetwork).Methods("POST")
+	handle("/network/wifi/saved", auth.Operator, apiObj.GetSavedWifiNetworks).Methods("GET")
+	handle("/network/wifi/forget", auth.Operator, apiObj.ForgetWifiNetwork).Methods("DELETE")
+	handle("/network/wifi/current", auth.Viewer, apiObj.GetCurrentWifiNetwork).Methods("GET")
+	handle("/network/wifi/current", auth.Operator, apiObj.DisconnectFromWifi).Methods("DELETE")
+	handle("/network/hotspot", auth.Operator, apiObj.GetHotspotInterface).Methods("GET")
+	handle("/network/hotspot", auth.Admin, apiObj.SetHotspotInterface).Methods("POST")
+	handle("/wifi-check", auth.Operator, apiObj.CheckWifiInternetConnection).Methods("GET")
+	handle("/modem-check", auth.Operator, needs(device.Modem, apiObj.CheckModemInternetConnection)).Methods("GET")
+	handle("/wifi-networks", auth.Operator, apiObj.GetWifiNetworks).Methods("GET")
+	handle("/wifi-networks", auth.Operator, apiObj.PostWifiNetwork).Methods("POST")
+	handle("/wifi-networks", auth.Operator, apiObj.DeleteWifiNetwork).Methods("Delete")
+	handle("/wifi-network-scan", auth.Operator, wifiScanLimit.Limit(apiObj.ScanWifiNetwork)).Methods("GET")
+	handle("/enable-wifi", auth.Operator, apiObj.EnableWifi).Methods("POST")
+	handle("/enable-hotspot", auth.Operator, apiObj.EnableHotspot).Methods("POST")
+	handle("/wifi-status", auth.Viewer, apiObj.GetConnectionStatus).Methods("GET")
+	handle("/upload-logs", auth.Admin, uploadLogsLimit.Limit(apiObj.UploadLogs)).Methods("PUT")
+
+	handle("/audiorecording", auth.Operator, needs(device.Audio, apiObj.SetAudioRecording)).Methods("POST")
+	handle("/audiorecording", auth.Viewer, needs(device.Audio, apiObj.GetAudioRecording)).Methods("GET")
+	handle("/audio/long-recording", auth.Operator, needs(device.Audio, apiObj.TakeLongAudioRecording)).Methods("PUT")
+	handle("/audio/test-recording", auth.Operator, needs(device.Audio, apiObj.TakeTestAudioRecording)).Methods("PUT")
+	handle("/audio/audio-status", auth.Viewer, needs(device.Audio, apiObj.AudioRecordingStatus)).Methods("GET")
+	handle("/audio/recordings", auth.Viewer, needs(device.Audio, apiObj.GetAudioRecordings)).Methods("GET")
+
+	handle("/offload-status", auth.Viewer, needs(device.RP2040, apiObj.RecordingOffloadStatus)).Methods("GET")
+	handle("/cancel-offload", auth.Operator, needs(device.RP2040, apiObj.CancelOffload)).Methods("PUT")
+	handle("/thermal/long-test-recording", auth.Operator, needs(device.RP2040, apiObj.TakeLongTestThermalRecording)).Methods("PUT")
+	handle("/thermal/short-test-recording", auth.Operator, needs(device.RP2040, apiObj.TakeShortTestThermalRecording)).Methods("PUT")
+	handle("/thermal/thermal-status", auth.Viewer, needs(device.RP2040, apiObj.TestThermalRecordingStatus)).Methods("GET")
+	handle("/offload-now", auth.Operator, needs(device.RP2040, apiObj.ForceRp2040Offload)).Methods("PUT")
+	handle("/serve-frames-now", auth.Viewer, needs(device.RP2040, apiObj.PrioritiseFrameServe)).Methods("PUT")
+	handle("/password", auth.Viewer, authenticator.ChangePasswordHandler).Methods("POST").Name(auth.ChangePasswordRoute)
+	apiRouter.HandleFunc("/login", authenticator.LoginHandler).Methods("POST").Name(auth.LoginRoute)
+	handle("/logout", auth.Viewer, authenticator.LogoutHandler).Methods("POST")
+	handle("/sessions/{user}", auth.Admin, authenticator.RevokeSessionsHandler).Methods("DELETE")
+	handle("/audit", auth.Admin, auditLog.QueryHandler).Methods("GET")
+
+	handle("/openapi.json", auth.Viewer, apiObj.GetOpenAPISpec).Methods("GET")
+
+	if h.tlsPort != 0 {
+		handle("/tls-fingerprint", auth.Viewer, fingerprintHandler(h.tlsCert, h.tlsPort)).Methods("GET")
+	}
+}
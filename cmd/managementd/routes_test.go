@@ -0,0 +1,122 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TheCacophonyProject/management-interface/api"
+	"github.com/TheCacophonyProject/management-interface/audit"
+	"github.com/TheCacophonyProject/management-interface/auth"
+)
+
+// registeredRoutes returns the "METHOD /path" of every API route under each
+// API prefix, with paths relative to the prefix as they are in the spec.
+func registeredRoutes(t *testing.T) map[string]map[string]bool {
+	certPEM, keyPEM, err := generateCertificate("test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	newAPIHandlers(&api.ManagementAPI{}, &auth.Authenticator{}, &audit.Log{}, cert, 443).addAPI(router)
+
+	prefixes := []string{"/api"}
+	for _, version := range api.Versions {
+		prefixes = append(prefixes, api.VersionPrefix(version))
+	}
+	routes := map[string]map[string]bool{}
+	for _, prefix := range prefixes {
+		routes[prefix] = map[string]bool{}
+	}
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// The prefix routes have no methods.
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		prefix, err := ancestors[len(ancestors)-1].GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes[prefix][method+" "+strings.TrimPrefix(path, prefix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func specRoutes(t *testing.T) map[string]bool {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(api.OpenAPISpec, &spec); err != nil {
+		t.Fatalf("api/openapi.json is not valid JSON: %v", err)
+	}
+	routes := map[string]bool{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			routes[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return routes
+}
+
+func missing(from, in map[string]bool) []string {
+	var m []string
+	for route := range from {
+		if !in[route] {
+			m = append(m, route)
+		}
+	}
+	sort.Strings(m)
+	return m
+}
+
+func TestEveryRouteIsInOpenAPISpec(t *testing.T) {
+	spec := specRoutes(t)
+	for prefix, registered := range registeredRoutes(t) {
+		if len(registered) == 0 {
+			t.Errorf("no routes registered under %s", prefix)
+		}
+		for _, route := range missing(registered, spec) {
+			t.Errorf("%s is registered under %s but not in api/openapi.json", route, prefix)
+		}
+		for _, route := range missing(spec, registered) {
+			t.Errorf("%s is in api/openapi.json but not registered under %s", route, prefix)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/gorilla/websocket"
+)
+
+// maxQueued is how many messages can wait to be sent to a client. Only
+// the newest frame waits, so these are mostly status messages.
+const maxQueued = 8
+
+// outgoing is a message waiting to be sent to a client.
+type outgoing struct {
+	msg []byte
+	// text is set for the legacy disconnected message.
+	text bool
+	// frame is set instead of msg for clients using the protocol, and is
+	// encoded when it is sent, as a delta if the client has the frame
+	// before it.
+	frame *frameproto.EncodedFrame
+	// isFrame is set for frames, which can be dropped for newer ones.
+	isFrame bool
+}
+
+// sendQueue holds the messages waiting to be sent to a client. A new frame
+// replaces one that is still waiting, so a slow client skips frames rather
+// than falling further behind.
+type sendQueue struct {
+	pending []outgoing
+	// ready is signalled when a message is queued.
+	ready chan struct{}
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{ready: make(chan struct{}, 1)}
+}
+
+// push queues the message, returning how many frames were dropped for it.
+// It has to be called with the socket's queueLock held.
+func (q *sendQueue) push(o outgoing) int {
+	dropped := 0
+	if o.isFrame {
+		for i, p := range q.pending {
+			if p.isFrame {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				dropped++
+				break
+			}
+		}
+	}
+	if len(q.pending) >= maxQueued {
+		if q.pending[0].isFrame {
+			dropped++
+		}
+		q.pending = q.pending[1:]
+	}
+	q.pending = append(q.pending, o)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// take returns the messages waiting. It has to be called with the socket's
+// queueLock held.
+func (q *sendQueue) take() []outgoing {
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// newRegistration makes the registration for a client and starts the
+// goroutine that sends to it, which runs until the registration is stopped
+// or a send fails.
+func (h *frameHub) newRegistration(uuid int64, ws *websocket.Conn, session string, version int, profile frameproto.Profile) *WebsocketRegistration {
+	socket := &WebsocketRegistration{
+		hub:             h,
+		uuid:            uuid,
+		Socket:          ws,
+		LastHeartbeatAt: time.Now(),
+		session:         session,
+		Version:         version,
+		Profile:         profile,
+		queue:           newSendQueue(),
+		stopping:        make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	h.senders.Go(socket.run)
+	return socket
+}
+
+// enqueue queues a message for the client without waiting for it to be
+// sent, counting the frames that are dropped for it.
+func (socket *WebsocketRegistration) enqueue(o outgoing) {
+	socket.queueLock.Lock()
+	dropped := socket.queue.push(o)
+	socket.queueLock.Unlock()
+	if dropped > 0 {
+		log.Debugf("client %d is too slow, dropped %d frames", socket.uuid, dropped)
+		socket.framesSkipped.Add(int64(dropped))
+		framesSkipped.Add(float64(dropped))
+	}
+}
+
+// stop tells the sender goroutine to finish, without waiting for it.
+func (socket *WebsocketRegistration) stop() {
+	socket.stopOnce.Do(func() { close(socket.stopping) })
+}
+
+func (socket *WebsocketRegistration) run() {
+	defer close(socket.stopped)
+	for {
+		select {
+		case <-socket.queue.ready:
+		case <-socket.stopping:
+			return
+		}
+		socket.queueLock.Lock()
+		pending := socket.queue.take()
+		socket.queueLock.Unlock()
+		for _, o := range pending {
+			select {
+			case <-socket.stopping:
+				return
+			default:
+			}
+			if err := socket.sendQueued(o); err != nil {
+				socket.evict(err)
+				return
+			}
+		}
+	}
+}
+
+// sendQueued sends a queued message, and stats after frames.
+func (socket *WebsocketRegistration) sendQueued(o outgoing) error {
+	msg := o.msg
+	if o.frame != nil {
+		var err error
+		if msg, err = o.frame.Message(socket.lastSeq); err != nil {
+			log.Printf("couldn't encode a frame: %v", err)
+			return nil
+		}
+	}
+	if err := socket.send(msg, o.text); err != nil {
+		return err
+	}
+	if o.frame != nil {
+		socket.lastSeq = o.frame.Seq
+	}
+	if o.isFrame {
+		socket.framesSent.Add(1)
+		return socket.sendStats()
+	}
+	return nil
+}
+
+// send sends a message to the socket, as text for the legacy
+// disconnected message and otherwise as binary. Clients that don't take
+// the message within the write timeout are dropped.
+func (socket *WebsocketRegistration) send(msg []byte, text bool) error {
+	socket.Socket.SetWriteDeadline(time.Now().Add(deviceSettings.SocketWriteTimeout))
+	messageType := websocket.BinaryMessage
+	if text {
+		messageType = websocket.TextMessage
+	}
+	return socket.Socket.WriteMessage(messageType, msg)
+}
+
+// sendStats sends the frame counts to a client using the protocol, at most
+// once every statsInterval.
+func (socket *WebsocketRegistration) sendStats() error {
+	if socket.Version == 0 || time.Since(socket.lastStats) < statsInterval {
+		return nil
+	}
+	socket.lastStats = time.Now()
+	msg, err := frameproto.Encode(frameproto.TypeStats, frameproto.Stats{
+		FramesSent:    socket.framesSent.Load(),
+		FramesSkipped: socket.framesSkipped.Load(),
+	}, nil)
+	if err != nil {
+		return nil
+	}
+	return socket.send(msg, false)
+}
+
+// evict unregisters a client that couldn't be sent a message and closes
+// its websocket.
+func (socket *WebsocketRegistration) evict(err error) {
+	select {
+	case <-socket.stopping:
+		// The websocket is being closed already.
+		socket.hub.unregister(socket)
+		return
+	default:
+	}
+	log.Printf("dropping client %d: %v", socket.uuid, err)
+	socket.hub.unregister(socket)
+	socket.Socket.Close()
+}
@@ -0,0 +1,142 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/TheCacophonyProject/management-interface/settings"
+)
+
+func TestSendQueue(t *testing.T) {
+	q := newSendQueue()
+	frame := func(n byte) outgoing { return outgoing{msg: []byte{n}, isFrame: true} }
+	status := func(n byte) outgoing { return outgoing{msg: []byte{n}} }
+
+	// Only the newest frame waits.
+	dropped := q.push(frame(1)) + q.push(status(2)) + q.push(frame(3)) + q.push(frame(4))
+	if dropped != 2 {
+		t.Errorf("dropped %d frames, want 2", dropped)
+	}
+	if got, want := q.take(), []outgoing{status(2), frame(4)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(q.take()) != 0 {
+		t.Error("messages still queued after taking them")
+	}
+
+	// Status messages are never more than maxQueued.
+	for i := 0; i < maxQueued+3; i++ {
+		q.push(status(byte(i)))
+	}
+	got := q.take()
+	if len(got) != maxQueued || got[0].msg[0] != 3 {
+		t.Errorf("got %d messages starting with %v", len(got), got[0].msg)
+	}
+	select {
+	case <-q.ready:
+	default:
+		t.Error("queue wasn't ready after pushing")
+	}
+}
+
+func TestStalledClientIsEvicted(t *testing.T) {
+	deviceSettings.SocketWriteTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { deviceSettings.SocketWriteTimeout = settings.Default().SocketWriteTimeout })
+	h, server := startHub(t)
+	ctx := context.Background()
+	h.CameraConnected(ctx, &frameproto.FrameInfo{Camera: frameproto.Camera{ResX: 640, ResY: 480}})
+
+	healthy, _ := hello(t, server, 21, nil)
+	stalled, _ := hello(t, server, 22, nil)
+	stalledSocket := registration(h, 22)
+
+	var healthyFrames atomic.Int64
+	go func() {
+		for {
+			healthy.SetReadDeadline(time.Now().Add(5 * time.Second))
+			msg, err := readMessage(healthy)
+			if err != nil {
+				return
+			}
+			if m, err := frameproto.Decode(msg.data); err == nil && m.Type == frameproto.TypeFrame {
+				healthyFrames.Add(1)
+			}
+		}
+	}()
+
+	pix := make([][]uint16, 480)
+	for y := range pix {
+		pix[y] = make([]uint16, 640)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 0; stillRegistered(h, 22); i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("stalled client wasn't evicted")
+		}
+		h.Publish(ctx, &FrameData{Frame: &cptvframe.Frame{Pix: pix, Status: cptvframe.Telemetry{FrameCount: i}}})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stalledSocket.framesSkipped.Load() == 0 {
+		t.Error("no frames were skipped for the stalled client")
+	}
+	select {
+	case <-stalledSocket.stopped:
+	case <-time.After(2 * time.Second):
+		t.Error("sender for the stalled client didn't stop")
+	}
+	// The stalled client finds the websocket closed once it reads again.
+	stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := readMessage(stalled); err != nil {
+			break
+		}
+	}
+
+	if !stillRegistered(h, 21) {
+		t.Error("healthy client was evicted")
+	}
+	if healthyFrames.Load() == 0 {
+		t.Error("healthy client wasn't sent frames while the other was stalled")
+	}
+}
+
+// registration returns the websocket registered with the UUID in any
+// session, or nil if there isn't one.
+func registration(h *frameHub, uuid int64) *WebsocketRegistration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for key, socket := range h.clients {
+		if key.uuid == uuid {
+			return socket
+		}
+	}
+	return nil
+}
+
+func stillRegistered(h *frameHub, uuid int64) bool {
+	return registration(h, uuid) != nil
+}
@@ -0,0 +1,92 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// shutdownTimeout is how long requests and websockets get to finish
+	// when managementd is stopped, well inside systemd's stop timeout.
+	shutdownTimeout = 10 * time.Second
+	shutdownMessage = "managementd is stopping"
+)
+
+// shutdown stops the servers from taking new requests, closes the websockets
+// and waits for the requests and the frame goroutines to finish, giving up
+// after shutdownTimeout.
+func shutdown(servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Go(func() {
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("stopping server on %s: %v", server.Addr, err)
+			}
+		})
+	}
+	hub.Close(ctx, shutdownMessage)
+	wg.Wait()
+
+	if !waitFor(ctx, &background) || !waitFor(ctx, &hub.senders) {
+		log.Printf("frame goroutines didn't stop within %v", shutdownTimeout)
+	}
+	log.Print("stopped")
+}
+
+// Close sends a close frame with the code and reason, then closes the socket.
+// A message that is still being sent is given until ctx is done to finish.
+func (socket *WebsocketRegistration) Close(ctx context.Context, code int, reason string) error {
+	socket.stop()
+	select {
+	case <-socket.stopped:
+	case <-ctx.Done():
+		return socket.Socket.Close()
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(deviceSettings.SocketWriteTimeout)
+	}
+	err := writeClose(socket.Socket, code, reason, deadline)
+	if closeErr := socket.Socket.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// waitFor waits for wg, returning false if ctx is done first.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
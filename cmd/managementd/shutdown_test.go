@@ -0,0 +1,87 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/frameproto"
+	"github.com/gorilla/websocket"
+)
+
+func TestListenForFramesStops(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "frames")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		listenForFrames(ctx, socketPath, device.Profile{})
+		close(done)
+	}()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		} else if time.Since(start) > 2*time.Second {
+			t.Fatal("frame socket wasn't made")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("listenForFrames didn't stop")
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("frame socket wasn't removed: %v", err)
+	}
+}
+
+func TestCloseWebsockets(t *testing.T) {
+	h, server := startHub(t)
+	// With the camera connected a legacy client isn't sent anything when
+	// it registers, so the close frame comes first.
+	h.CameraConnected(context.Background(), &frameproto.FrameInfo{})
+	client := dialWebsocket(t, server)
+	client.WriteJSON(frameproto.ClientMessage{Type: frameproto.Register, Uuid: 1})
+	for start := time.Now(); !h.HasClients(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("client wasn't registered")
+		}
+	}
+
+	h.Close(context.Background(), shutdownMessage)
+	if h.HasClients() {
+		t.Error("websocket still registered")
+	}
+
+	_, err := readMessage(client)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("got %v, want a close frame", err)
+	}
+	if closeErr.Code != websocket.CloseGoingAway || closeErr.Text != shutdownMessage {
+		t.Errorf("got close %d %q, want %d %q", closeErr.Code, closeErr.Text, websocket.CloseGoingAway, shutdownMessage)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+)
+
+const (
+	tlsCertFile   = "managementd-tls.crt"
+	tlsKeyFile    = "managementd-tls.key"
+	minionIDFile  = "/etc/salt/minion_id"
+	hotspotIP     = "192.168.4.1"
+	certValidFor  = 30 * 365 * 24 * time.Hour
+	certOrg       = "The Cacophony Project"
+	certNotBefore = "2020-01-01T00:00:00Z"
+)
+
+// loadOrCreateCertificate loads the device's TLS certificate from configDir,
+// generating a self-signed one the first time it is needed.
+func loadOrCreateCertificate(conf *goconfig.Config, configDir string) (tls.Certificate, error) {
+	certPath := filepath.Join(configDir, tlsCertFile)
+	keyPath := filepath.Join(configDir, tlsKeyFile)
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		return cert, nil
+	} else if !os.IsNotExist(err) {
+		return tls.Certificate{}, err
+	}
+
+	deviceName := tlsDeviceName(conf)
+	minionID := strings.TrimSpace(readFileOrEmpty(minionIDFile))
+	log.Printf("generating TLS certificate for '%s' (minion ID '%s')", deviceName, minionID)
+	certPEM, keyPEM, err := generateCertificate(deviceName, minionID)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateCertificate makes a self-signed certificate for the device. The
+// device clock can't be trusted before it has synced, so the certificate is
+// valid from a fixed date in the past.
+func generateCertificate(deviceName, minionID string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	notBefore, err := time.Parse(time.RFC3339, certNotBefore)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   deviceName,
+			SerialNumber: minionID,
+			Organization: []string{certOrg},
+		},
+		NotBefore:             notBefore,
+		NotAfter:              time.Now().Add(certValidFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{deviceName, deviceName + ".local", "localhost"},
+		IPAddresses:           []net.IP{net.ParseIP(hotspotIP), net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func tlsDeviceName(conf *goconfig.Config) string {
+	var device goconfig.Device
+	if err := conf.Unmarshal(goconfig.DeviceKey, &device); err == nil && device.Name != "" {
+		return device.Name
+	}
+	if name, err := os.Hostname(); err == nil {
+		return strings.SplitN(name, ".", 2)[0]
+	}
+	return "cacophonator"
+}
+
+func readFileOrEmpty(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// certFingerprint returns the SHA-256 fingerprint of the certificate, as
+// colon separated hex like browsers show.
+func certFingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// fingerprintHandler returns the certificate fingerprint for apps to pin.
+func fingerprintHandler(cert tls.Certificate, port int) http.HandlerFunc {
+	fingerprint := certFingerprint(cert)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sha256": fingerprint,
+			"port":   port,
+		})
+	}
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same path on the TLS port.
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// There is no port, but an IPv6 address is still in brackets.
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(port))
+		} else if strings.Contains(host, ":") {
+			// An IPv6 address still needs its brackets.
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		// 308 so that API clients resend the same method and body.
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
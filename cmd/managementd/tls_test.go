@@ -0,0 +1,60 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   int
+		method string
+		target string
+		host   string
+		want   string
+	}{
+		{"default port", 443, "GET", "/camera", "192.168.4.1", "https://192.168.4.1/camera"},
+		{"drops the HTTP port", 443, "GET", "/camera", "192.168.4.1:80", "https://192.168.4.1/camera"},
+		{"other port", 8443, "GET", "/camera", "192.168.4.1:8080", "https://192.168.4.1:8443/camera"},
+		{"other port without one given", 8443, "GET", "/camera", "tc2-0001.local", "https://tc2-0001.local:8443/camera"},
+		{"keeps the query", 443, "POST", "/api/location?accuracy=5", "tc2-0001.local", "https://tc2-0001.local/api/location?accuracy=5"},
+		{"IPv6", 443, "GET", "/", "[fe80::1]:80", "https://[fe80::1]/"},
+		{"IPv6 other port", 8443, "GET", "/", "[fe80::1]", "https://[fe80::1]:8443/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.target, strings.NewReader("body"))
+			r.Host = test.host
+			w := httptest.NewRecorder()
+			redirectToHTTPS(test.port).ServeHTTP(w, r)
+			// 308 keeps the method and body of API requests.
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusPermanentRedirect)
+			}
+			if got := w.Header().Get("Location"); got != test.want {
+				t.Errorf("redirected to %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package command runs the system commands that managementd shells out to,
+// with a timeout and the context of the request that needs them, so that a
+// hung command can't hold up a request for ever.
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxStderr is how much of a command's stderr is kept for its error.
+const maxStderr = 4096
+
+// Runner runs commands. A timeout of zero means the command is only stopped
+// when ctx is done.
+type Runner interface {
+	// Run runs a command and returns what it wrote to stdout. The output is
+	// returned even when the command fails, as some commands report what
+	// they found through their exit status.
+	Run(ctx context.Context, timeout time.Duration, name string, args ...string) ([]byte, error)
+	// Stream runs a command, writing its stdout to w, for commands with too
+	// much output to keep in memory.
+	Stream(ctx context.Context, timeout time.Duration, w io.Writer, name string, args ...string) error
+}
+
+// Error is returned when a command couldn't be run, failed or timed out.
+type Error struct {
+	// Cmd is the command line that was run.
+	Cmd string
+	// ExitCode is the exit status of the command, or -1 if it didn't exit.
+	ExitCode int
+	// Stderr is what the command wrote to stderr.
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Cmd, e.Err)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status of the command that returned err, or -1
+// if err didn't come from a command that exited.
+func ExitCode(err error) int {
+	var cmdErr *Error
+	if errors.As(err, &cmdErr) {
+		return cmdErr.ExitCode
+	}
+	return -1
+}
+
+// Line returns the command line for a command, as used in errors and by Fake.
+func Line(name string, args ...string) string {
+	return strings.Join(append([]string{name}, args...), " ")
+}
+
+// Exec runs commands on the system.
+type Exec struct{}
+
+func (Exec) Run(ctx context.Context, timeout time.Duration, name string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := Exec{}.Stream(ctx, timeout, &stdout, name, args...)
+	return stdout.Bytes(), err
+}
+
+func (Exec) Stream(ctx context.Context, timeout time.Duration, w io.Writer, name string, args ...string) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	// Don't wait for children that kept the output pipes open after the
+	// command was killed.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+		if errors.Is(ctxErr, context.DeadlineExceeded) && timeout > 0 {
+			err = fmt.Errorf("timed out after %v: %w", timeout, ctxErr)
+		}
+	}
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	return &Error{
+		Cmd:      Line(name, args...),
+		ExitCode: exitCode,
+		Stderr:   stderr.String(),
+		Err:      err,
+	}
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	ctx := context.Background()
+	out, err := Exec{}.Run(ctx, time.Second, "sh", "-c", "echo out; echo err >&2")
+	if err != nil || string(out) != "out\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	out, err = Exec{}.Run(ctx, time.Second, "sh", "-c", "echo partial; echo broken >&2; exit 3")
+	var cmdErr *Error
+	if !errors.As(err, &cmdErr) || cmdErr.ExitCode != 3 || cmdErr.Stderr != "broken\n" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if string(out) != "partial\n" {
+		t.Errorf("got output %q from failed command", out)
+	}
+	if ExitCode(err) != 3 {
+		t.Errorf("got exit code %d", ExitCode(err))
+	}
+
+	_, err = Exec{}.Run(ctx, time.Second, "not-a-command-managementd-runs")
+	if !errors.Is(err, exec.ErrNotFound) || ExitCode(err) != -1 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := Exec{}.Run(context.Background(), 50*time.Millisecond, "sleep", "10")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("command wasn't killed at its timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out bytes.Buffer
+	if err := (Exec{}).Stream(ctx, time.Second, &out, "echo", "hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	f.Set("systemctl is-active tc2-agent", Result{Stdout: "inactive\n", ExitCode: 3})
+	f.Script("pidof", func(args []string) Result {
+		return Result{Stdout: "4" + args[0] + "\n"}
+	})
+	ctx := context.Background()
+
+	out, err := f.Run(ctx, time.Second, "systemctl", "is-active", "tc2-agent")
+	if string(out) != "inactive\n" || ExitCode(err) != 3 {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if out, err := f.Run(ctx, time.Second, "pidof", "2"); string(out) != "42\n" || err != nil {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := f.Run(ctx, time.Second, "reboot"); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("unexpected error %v", err)
+	}
+	want := []string{"systemctl is-active tc2-agent", "pidof 2", "reboot"}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is what a faked command outputs.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// TimedOut makes the command fail as if it ran past its timeout.
+	TimedOut bool
+}
+
+// Fake is a Runner that returns canned results, for tests. Commands that
+// haven't been given a result fail as if they weren't installed.
+type Fake struct {
+	mu      sync.Mutex
+	results map[string]Result
+	scripts map[string]func(args []string) Result
+	calls   []string
+}
+
+// NewFake returns a Fake with no commands.
+func NewFake() *Fake {
+	return &Fake{
+		results: map[string]Result{},
+		scripts: map[string]func(args []string) Result{},
+	}
+}
+
+// Set sets the result of a command line, such as "systemctl is-active tc2-agent".
+func (f *Fake) Set(line string, result Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[line] = result
+}
+
+// Script sets fn to give the result of each call to the named command that
+// doesn't have a result set for its whole command line, for commands whose
+// output depends on their arguments or on earlier calls.
+func (f *Fake) Script(name string, fn func(args []string) Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[name] = fn
+}
+
+// Calls returns the command lines that have been run.
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *Fake) Run(ctx context.Context, timeout time.Duration, name string, args ...string) ([]byte, error) {
+	var stdout strings.Builder
+	err := f.Stream(ctx, timeout, &stdout, name, args...)
+	return []byte(stdout.String()), err
+}
+
+func (f *Fake) Stream(ctx context.Context, timeout time.Duration, w io.Writer, name string, args ...string) error {
+	line := Line(name, args...)
+	f.mu.Lock()
+	f.calls = append(f.calls, line)
+	result, ok := f.results[line]
+	script, scripted := f.scripts[name]
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return &Error{Cmd: line, ExitCode: -1, Err: err}
+	}
+	if !ok && scripted {
+		result, ok = script(args), true
+	}
+	if !ok {
+		return &Error{Cmd: line, ExitCode: -1, Err: exec.ErrNotFound}
+	}
+	if _, err := io.WriteString(w, result.Stdout); err != nil {
+		return err
+	}
+	switch {
+	case result.TimedOut:
+		return &Error{
+			Cmd:      line,
+			ExitCode: -1,
+			Stderr:   result.Stderr,
+			Err:      fmt.Errorf("timed out after %v: %w", timeout, context.DeadlineExceeded),
+		}
+	case result.ExitCode != 0:
+		return &Error{
+			Cmd:      line,
+			ExitCode: result.ExitCode,
+			Stderr:   result.Stderr,
+			Err:      fmt.Errorf("exit status %d", result.ExitCode),
+		}
+	}
+	return nil
+}
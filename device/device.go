@@ -0,0 +1,145 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package device describes what the hardware managementd is running on can
+// do, so that features the device doesn't have can be turned off.
+package device
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MinionIDFile has the salt minion ID of the device, which starts with its
+// type, such as "tc2-1234".
+const MinionIDFile = "/etc/salt/minion_id"
+
+// Capability is a part of the hardware that some features need.
+type Capability string
+
+const (
+	// RP2040 is the RP2040 and ATtiny of the TC2, which make and offload
+	// recordings, look after the power and read the battery.
+	RP2040 Capability = "rp2040"
+	// DBusRTC is an RTC reached through a service on D-Bus, rather than
+	// directly on i2c.
+	DBusRTC Capability = "dbus-rtc"
+	// Modem is a cellular modem run by modemd. The HiLink modems of older
+	// devices are only used for the signal strength.
+	Modem Capability = "modem"
+	// Audio is a microphone for audio recordings.
+	Audio Capability = "audio"
+	// ThermalCamera is a thermal camera.
+	ThermalCamera Capability = "thermal-camera"
+)
+
+// Profile is the type of the device and the capabilities it has.
+type Profile struct {
+	Type          string
+	RP2040        bool
+	DBusRTC       bool
+	Modem         bool
+	Audio         bool
+	ThermalCamera bool
+}
+
+// profiles are the device types that are known.
+var profiles = map[string]Profile{
+	"tc2": {Type: "tc2", RP2040: true, DBusRTC: true, Modem: true, Audio: true, ThermalCamera: true},
+	"pi":  {Type: "pi", ThermalCamera: true},
+}
+
+// ForType returns the profile of a type of device.
+func ForType(deviceType string) (Profile, error) {
+	profile, ok := profiles[deviceType]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown device type '%s'", deviceType)
+	}
+	return profile, nil
+}
+
+// unknown is the profile of a device whose type isn't known. Everything
+// but the TC2's D-Bus RTC is turned on, which is how managementd worked
+// before it had profiles.
+func unknown(deviceType string) Profile {
+	return Profile{Type: deviceType, RP2040: true, Modem: true, Audio: true, ThermalCamera: true}
+}
+
+// Detect returns the profile of the device from the type in its minion ID,
+// or the profile of deviceType if it is given.
+func Detect(deviceType string) (Profile, error) {
+	if deviceType != "" {
+		return ForType(deviceType)
+	}
+	deviceType, err := readType(MinionIDFile)
+	if err != nil {
+		return unknown(""), err
+	}
+	if profile, ok := profiles[deviceType]; ok {
+		return profile, nil
+	}
+	return unknown(deviceType), fmt.Errorf("unknown device type '%s'", deviceType)
+}
+
+// readType returns the type from a minion ID file, which is the ID without
+// the number at the end.
+func readType(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(string(data))
+	i := strings.LastIndex(id, "-")
+	if i <= 0 {
+		return "", fmt.Errorf("failed to parse the device type from minion ID '%s'", id)
+	}
+	return id[:i], nil
+}
+
+// Has returns whether the device has a capability.
+func (p Profile) Has(c Capability) bool {
+	switch c {
+	case RP2040:
+		return p.RP2040
+	case DBusRTC:
+		return p.DBusRTC
+	case Modem:
+		return p.Modem
+	case Audio:
+		return p.Audio
+	case ThermalCamera:
+		return p.ThermalCamera
+	}
+	return false
+}
+
+// Capabilities returns the capabilities the device has.
+func (p Profile) Capabilities() []Capability {
+	capabilities := []Capability{}
+	for _, c := range []Capability{RP2040, DBusRTC, Modem, Audio, ThermalCamera} {
+		if p.Has(c) {
+			capabilities = append(capabilities, c)
+		}
+	}
+	return capabilities
+}
+
+func (p Profile) String() string {
+	return fmt.Sprintf("%s %v", p.Type, p.Capabilities())
+}
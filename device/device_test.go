@@ -0,0 +1,68 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadType(t *testing.T) {
+	dir := t.TempDir()
+	for id, want := range map[string]string{
+		"tc2-1234\n":   "tc2",
+		"pi-dev-42":    "pi-dev",
+		"cacophonator": "",
+		"":             "",
+	} {
+		path := filepath.Join(dir, "minion_id")
+		if err := os.WriteFile(path, []byte(id), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readType(path)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("got %q, %v for minion ID %q, want %q", got, err, id, want)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	tc2, err := Detect("tc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tc2.Capabilities(); !reflect.DeepEqual(got, []Capability{RP2040, DBusRTC, Modem, Audio, ThermalCamera}) {
+		t.Errorf("got TC2 capabilities %v", got)
+	}
+	pi, err := ForType("pi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Has(RP2040) || pi.Has(Audio) || !pi.Has(ThermalCamera) {
+		t.Errorf("got pi capabilities %v", pi.Capabilities())
+	}
+	if _, err := Detect("tc3"); err == nil {
+		t.Error("no error for an unknown device type")
+	}
+	if p := unknown("tc3"); p.Type != "tc3" || p.Has(DBusRTC) || !p.Has(RP2040) || !p.Has(Audio) || !p.Has(Modem) || !p.Has(ThermalCamera) {
+		t.Errorf("got %v for an unknown device", p)
+	}
+}
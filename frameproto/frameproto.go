@@ -0,0 +1,331 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package frameproto is the protocol that managementd streams camera frames
+// to websocket clients on /ws with.
+//
+// A client starts by sending a Hello text message with the protocol
+// versions it understands:
+//
+//	{"type": "Hello", "uuid": 1700000000000, "versions": [1], "data": "<user agent>"}
+//
+// The Hello can also ask for a Profile of how frames are delivered, for
+// clients on a slow connection, such as
+//
+//	"profile": {"encoding": "delta", "compression": "deflate", "depth": 8, "maxFPS": 3, "roi": {"x": 0, "y": 0, "width": 80, "height": 60}}
+//
+// managementd picks the newest version they both understand and answers
+// with a Welcome text message, with the profile it will use, or an error
+// text message and closes the websocket if there isn't a version or the
+// profile is invalid:
+//
+//	{"type": "Welcome", "version": 1, "messageTypes": ["frame", "status", ...], "appVersion": "1.2.3", "profile": {...}}
+//	{"type": "Error", "message": "no supported protocol version, managementd supports [1]"}
+//
+// Everything managementd sends after the Welcome is a binary message:
+//
+//	offset  size  field
+//	0       1     protocol version
+//	1       1     message type
+//	2       2     flags, little endian, see FlagDelta and the flags after it
+//	4       4     length n of the JSON metadata, little endian
+//	8       n     JSON metadata
+//	8+n           body
+//
+// The message types are:
+//
+//	1 frame         FrameInfo, with a body of ResX*ResY little endian
+//	                uint16 pixels, row by row, unless the flags say
+//	                otherwise
+//	2 status        Status, sent after the Welcome and when the camera connects
+//	3 disconnected  Disconnected, sent when the camera disconnects
+//	4 error         Error, sent for a client message managementd doesn't
+//	                know, and before the websocket is closed for an error
+//	5 stats         Stats, sent every few seconds while frames are sent
+//
+// Clients should ignore message types they don't know. Clients have to
+// answer websocket pings, which browsers do themselves. Clients that don't
+// can instead send Heartbeat text messages as before, such as
+// {"type": "Heartbeat", "uuid": 1700000000000}.
+//
+// Clients that send Register instead of Hello get the legacy layout: a
+// uint16 length of the FrameInfo JSON, the JSON and then the pixels, or
+// the text message "disconnected".
+package frameproto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// Version is the newest version of the protocol.
+const Version = 1
+
+// Versions are the protocol versions managementd understands.
+var Versions = []int{Version}
+
+// headerSize is the size of the fixed header of each binary message.
+const headerSize = 8
+
+// The types of the text messages sent by clients and managementd.
+const (
+	Hello     = "Hello"
+	Welcome   = "Welcome"
+	Register  = "Register"
+	Heartbeat = "Heartbeat"
+)
+
+// LegacyDisconnected is the text message legacy clients are sent when the
+// camera disconnects.
+const LegacyDisconnected = "disconnected"
+
+// MessageType is the type of a binary message.
+type MessageType uint8
+
+const (
+	TypeFrame        MessageType = 1
+	TypeStatus       MessageType = 2
+	TypeDisconnected MessageType = 3
+	TypeError        MessageType = 4
+	TypeStats        MessageType = 5
+)
+
+var typeNames = map[MessageType]string{
+	TypeFrame:        "frame",
+	TypeStatus:       "status",
+	TypeDisconnected: "disconnected",
+	TypeError:        "error",
+	TypeStats:        "stats",
+}
+
+func (t MessageType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %d", uint8(t))
+}
+
+// MessageTypes are the names of the binary message types, as listed in the
+// Welcome.
+func MessageTypes() []string {
+	names := []string{}
+	for t := TypeFrame; t <= TypeStats; t++ {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+// ClientMessage is a text message from a client.
+type ClientMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Uuid int64  `json:"uuid"`
+	// Versions are the protocol versions a client understands, sent in its Hello.
+	Versions []int `json:"versions,omitempty"`
+	// Profile is how the client wants frames, sent in its Hello.
+	Profile *Profile `json:"profile,omitempty"`
+}
+
+// WelcomeMessage is the answer to a Hello.
+type WelcomeMessage struct {
+	Type         string   `json:"type"`
+	Version      int      `json:"version"`
+	MessageTypes []string `json:"messageTypes"`
+	AppVersion   string   `json:"appVersion"`
+	// Profile is the profile frames are sent with.
+	Profile Profile `json:"profile"`
+}
+
+// ErrorMessage is the answer to a Hello with no version managementd
+// understands or an invalid profile.
+type ErrorMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Negotiate returns the newest version in both versions and Versions.
+func Negotiate(versions []int) (int, error) {
+	for v := Version; v > 0; v-- {
+		if slices.Contains(versions, v) && slices.Contains(Versions, v) {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("no supported protocol version, managementd supports %v", Versions)
+}
+
+// Camera describes the camera that is sending frames.
+type Camera struct {
+	Brand        string
+	Model        string
+	FPS          int
+	ResX         int
+	ResY         int
+	Firmware     string
+	CameraSerial int
+}
+
+// FrameInfo is the metadata of a frame.
+type FrameInfo struct {
+	Camera    Camera
+	Telemetry cptvframe.Telemetry
+	// AppVersion is the version of managementd and BinaryVersion the
+	// version of tc2-agent, which the frames are from.
+	AppVersion    string
+	BinaryVersion string
+	Tracks        []map[string]interface{}
+	// Region is the part of the frame in the body, when it isn't the
+	// whole frame because of the client's region of interest.
+	Region *Region `json:",omitempty"`
+	// Min and Max are the pixel values that 0 and 255 are in 8 bit frames.
+	Min uint16 `json:",omitempty"`
+	Max uint16 `json:",omitempty"`
+}
+
+// Status is sent after the Welcome and when the camera connects.
+type Status struct {
+	Connected bool `json:"connected"`
+	// Camera, AppVersion and BinaryVersion are as in the FrameInfo, and are
+	// only set while the camera is connected.
+	Camera        *Camera `json:"camera,omitempty"`
+	AppVersion    string  `json:"appVersion"`
+	BinaryVersion string  `json:"binaryVersion,omitempty"`
+}
+
+// Disconnected is sent when the camera disconnects.
+type Disconnected struct {
+	Reason string `json:"reason"`
+}
+
+// Error is sent when something the client asked for failed.
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Stats are counts of the frames sent to the client since it connected.
+type Stats struct {
+	FramesSent int64 `json:"framesSent"`
+	// FramesSkipped are the frames dropped because the client was too slow
+	// to take them before the next one.
+	FramesSkipped int64 `json:"framesSkipped"`
+}
+
+// Message is a decoded binary message.
+type Message struct {
+	Version int
+	Type    MessageType
+	Flags   uint16
+	// Metadata is the JSON metadata.
+	Metadata []byte
+	Body     []byte
+}
+
+// Encode makes a binary message from the metadata, which is marshalled as
+// JSON, and the body.
+func Encode(t MessageType, metadata interface{}, body []byte) ([]byte, error) {
+	return encode(t, 0, metadata, body)
+}
+
+func encode(t MessageType, flags uint16, metadata interface{}, body []byte) ([]byte, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, headerSize, headerSize+len(data)+len(body))
+	msg[0] = Version
+	msg[1] = byte(t)
+	binary.LittleEndian.PutUint16(msg[2:], flags)
+	binary.LittleEndian.PutUint32(msg[4:], uint32(len(data)))
+	msg = append(msg, data...)
+	return append(msg, body...), nil
+}
+
+// EncodeFrame makes a frame message.
+func EncodeFrame(info FrameInfo, pix [][]uint16) ([]byte, error) {
+	return Encode(TypeFrame, info, pixelBytes(pix))
+}
+
+// legacyFrameInfo is the FrameInfo of the legacy layout, which also has
+// Calibration and Mode. managementd has nothing to fill them from, so they
+// are null and "" as they always were, but clients may expect the keys.
+type legacyFrameInfo struct {
+	FrameInfo
+	Calibration map[string]interface{}
+	Mode        string
+}
+
+// EncodeLegacyFrame makes a frame in the layout for clients that don't
+// use the protocol.
+func EncodeLegacyFrame(info FrameInfo, pix [][]uint16) ([]byte, error) {
+	data, err := json.Marshal(legacyFrameInfo{FrameInfo: info})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0xffff {
+		return nil, fmt.Errorf("frame info is too long at %d bytes", len(data))
+	}
+	msg := binary.LittleEndian.AppendUint16(nil, uint16(len(data)))
+	msg = append(msg, data...)
+	return append(msg, pixelBytes(pix)...), nil
+}
+
+func pixelBytes(pix [][]uint16) []byte {
+	var b []byte
+	for _, row := range pix {
+		for _, p := range row {
+			b = binary.LittleEndian.AppendUint16(b, p)
+		}
+	}
+	return b
+}
+
+// Decode reads a binary message.
+func Decode(data []byte) (Message, error) {
+	if len(data) < headerSize {
+		return Message{}, fmt.Errorf("message is too short at %d bytes", len(data))
+	}
+	m := Message{
+		Version: int(data[0]),
+		Type:    MessageType(data[1]),
+		Flags:   binary.LittleEndian.Uint16(data[2:]),
+	}
+	if m.Version != Version {
+		return Message{}, fmt.Errorf("unsupported protocol version %d", m.Version)
+	}
+	n := binary.LittleEndian.Uint32(data[4:])
+	if uint64(n) > uint64(len(data)-headerSize) {
+		return Message{}, fmt.Errorf("metadata length %d is longer than the message", n)
+	}
+	m.Metadata = data[headerSize : headerSize+int(n)]
+	m.Body = data[headerSize+int(n):]
+	return m, nil
+}
+
+// Unmarshal decodes the JSON metadata of the message into v.
+func (m Message) Unmarshal(v interface{}) error {
+	return json.Unmarshal(m.Metadata, v)
+}
+
+// Frame decodes a frame message that isn't a delta.
+func (m Message) Frame() (FrameInfo, [][]uint16, error) {
+	var d Decoder
+	return d.Frame(m)
+}
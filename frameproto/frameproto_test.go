@@ -0,0 +1,165 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package frameproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+func testFrame() (FrameInfo, [][]uint16) {
+	info := FrameInfo{
+		Camera:        Camera{Brand: "flir", Model: "lepton3.5", FPS: 9, ResX: 3, ResY: 2, Firmware: "3.3.26", CameraSerial: 1234},
+		Telemetry:     cptvframe.Telemetry{TimeOn: time.Minute, FFCState: "complete", FrameCount: 42, FrameMean: 3000, TempC: 21.5},
+		AppVersion:    "1.2.3",
+		BinaryVersion: "0.9.0",
+		Tracks:        []map[string]interface{}{{"id": 1.0}},
+	}
+	return info, [][]uint16{{1, 2, 3}, {0xfffe, 0x1234, 0}}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	info, pix := testFrame()
+	data, err := EncodeFrame(info, pix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != Version || MessageType(data[1]) != TypeFrame {
+		t.Errorf("got header % x", data[:headerSize])
+	}
+	m, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != TypeFrame || m.Flags != 0 || len(m.Body) != 12 {
+		t.Errorf("got %v flags %d and a %d byte body", m.Type, m.Flags, len(m.Body))
+	}
+	gotInfo, gotPix, err := m.Frame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotInfo, info) || !reflect.DeepEqual(gotPix, pix) {
+		t.Errorf("got %+v %v, want %+v %v", gotInfo, gotPix, info, pix)
+	}
+}
+
+func TestMessagesRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		t        MessageType
+		metadata interface{}
+		decoded  interface{}
+	}{
+		{TypeStatus, Status{Connected: true, Camera: &Camera{ResX: 160, ResY: 120}, AppVersion: "1.2.3"}, &Status{}},
+		{TypeStatus, Status{AppVersion: "1.2.3"}, &Status{}},
+		{TypeDisconnected, Disconnected{Reason: "EOF"}, &Disconnected{}},
+		{TypeError, Error{Message: "unknown message type"}, &Error{}},
+		{TypeStats, Stats{FramesSent: 100, FramesSkipped: 3}, &Stats{}},
+	} {
+		data, err := Encode(test.t, test.metadata, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != test.t || len(m.Body) != 0 {
+			t.Errorf("got %v with %d byte body, want %v", m.Type, len(m.Body), test.t)
+		}
+		if err := m.Unmarshal(test.decoded); err != nil {
+			t.Fatal(err)
+		}
+		if got := reflect.ValueOf(test.decoded).Elem().Interface(); !reflect.DeepEqual(got, test.metadata) {
+			t.Errorf("got %+v, want %+v", got, test.metadata)
+		}
+		if _, _, err := m.Frame(); err == nil {
+			t.Errorf("decoded a %v message as a frame", m.Type)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	info, pix := testFrame()
+	valid, _ := EncodeFrame(info, pix)
+	for name, data := range map[string][]byte{
+		"short":       valid[:5],
+		"version":     append([]byte{2}, valid[1:]...),
+		"json length": append(append([]byte{}, valid[:4]...), 0xff, 0xff, 0, 0),
+	} {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("decoded a message with a bad %s", name)
+		}
+	}
+
+	m, err := Decode(valid[:len(valid)-2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Frame(); err == nil {
+		t.Error("decoded a frame with missing pixels")
+	}
+}
+
+func TestLegacyFrame(t *testing.T) {
+	info, pix := testFrame()
+	data, err := EncodeLegacyFrame(info, pix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int(binary.LittleEndian.Uint16(data))
+	var got FrameInfo
+	if err := json.Unmarshal(data[2:2+n], &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("got %+v, want %+v", got, info)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data[2:2+n], &fields); err != nil {
+		t.Fatal(err)
+	}
+	if calibration, ok := fields["Calibration"]; !ok || calibration != nil {
+		t.Errorf("got Calibration %v, %v, want null", calibration, ok)
+	}
+	if mode, ok := fields["Mode"]; !ok || mode != "" {
+		t.Errorf("got Mode %v, %v, want an empty string", mode, ok)
+	}
+	want := []byte{1, 0, 2, 0, 3, 0, 0xfe, 0xff, 0x34, 0x12, 0, 0}
+	if !bytes.Equal(data[2+n:], want) {
+		t.Errorf("got pixels % x, want % x", data[2+n:], want)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	if v, err := Negotiate([]int{3, 2, 1}); err != nil || v != 1 {
+		t.Errorf("got %d, %v", v, err)
+	}
+	if _, err := Negotiate([]int{2}); err == nil {
+		t.Error("negotiated a version managementd doesn't have")
+	}
+	if got := MessageTypes(); !reflect.DeepEqual(got, []string{"frame", "status", "disconnected", "error", "stats"}) {
+		t.Errorf("got message types %v", got)
+	}
+}
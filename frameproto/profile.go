@@ -0,0 +1,420 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package frameproto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings of the pixels in a frame.
+const (
+	// EncodingRaw sends the pixels of each frame.
+	EncodingRaw = "raw"
+	// EncodingDelta sends the difference from the previous frame sent to
+	// the client, or a key frame of the pixels when the client didn't get
+	// the previous frame.
+	EncodingDelta = "delta"
+)
+
+// Compressions of the body of a frame.
+const (
+	CompressionNone    = "none"
+	CompressionDeflate = "deflate"
+	CompressionZstd    = "zstd"
+)
+
+// The flags of a frame message, saying how its body is encoded.
+const (
+	// FlagDelta is set when each pixel is the difference from the previous
+	// frame, wrapping around.
+	FlagDelta uint16 = 1 << iota
+	// FlagDeflate is set when the body is compressed with zlib, which
+	// browsers can decompress with a "deflate" DecompressionStream.
+	FlagDeflate
+	// FlagZstd is set when the body is compressed with zstd.
+	FlagZstd
+	// Flag8Bit is set when the pixels are 8 bits, scaled from Min to Max
+	// in the FrameInfo.
+	Flag8Bit
+
+	knownFlags = FlagDelta | FlagDeflate | FlagZstd | Flag8Bit
+)
+
+// Profile is how a client wants to be sent frames, asked for in its Hello.
+// The frames for a profile are encoded once and shared by all its clients.
+type Profile struct {
+	// Encoding is EncodingRaw or EncodingDelta.
+	Encoding string `json:"encoding,omitempty"`
+	// Compression is CompressionNone, CompressionDeflate or CompressionZstd.
+	Compression string `json:"compression,omitempty"`
+	// Depth is 16 for the camera's pixels or 8 for pixels scaled to a byte.
+	Depth int `json:"depth,omitempty"`
+	// MaxFPS limits how many frames are sent each second, or 0 to send
+	// every frame.
+	MaxFPS int `json:"maxFPS,omitempty"`
+	// ROI is the region of the frame to send, or the whole frame if empty.
+	// It is clipped to the frame, and the region sent is in the FrameInfo.
+	ROI Region `json:"roi,omitzero"`
+}
+
+// Region is a rectangle of a frame.
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r Region) empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// clip returns the part of the region in a frame of the size given, or the
+// whole frame if they don't overlap.
+func (r Region) clip(resX, resY int) Region {
+	whole := Region{Width: resX, Height: resY}
+	if r.empty() {
+		return whole
+	}
+	x0, y0 := max(r.X, 0), max(r.Y, 0)
+	x1, y1 := min(r.X+r.Width, resX), min(r.Y+r.Height, resY)
+	if x1 <= x0 || y1 <= y0 {
+		return whole
+	}
+	return Region{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// Normalize checks the profile, filling in the defaults for what the client
+// didn't ask for.
+func (p Profile) Normalize() (Profile, error) {
+	switch p.Encoding {
+	case "":
+		p.Encoding = EncodingRaw
+	case EncodingRaw, EncodingDelta:
+	default:
+		return p, fmt.Errorf("unknown encoding %q", p.Encoding)
+	}
+	switch p.Compression {
+	case "":
+		p.Compression = CompressionNone
+	case CompressionNone, CompressionDeflate, CompressionZstd:
+	default:
+		return p, fmt.Errorf("unknown compression %q", p.Compression)
+	}
+	switch p.Depth {
+	case 0:
+		p.Depth = 16
+	case 8, 16:
+	default:
+		return p, fmt.Errorf("depth must be 8 or 16, not %d", p.Depth)
+	}
+	if p.MaxFPS < 0 {
+		return p, fmt.Errorf("maxFPS can't be negative")
+	}
+	if p.ROI != (Region{}) && (p.ROI.empty() || p.ROI.X < 0 || p.ROI.Y < 0) {
+		return p, fmt.Errorf("invalid region of interest %+v", p.ROI)
+	}
+	return p, nil
+}
+
+// flags are the flags of a frame for the profile, other than FlagDelta.
+func (p Profile) flags() uint16 {
+	var flags uint16
+	switch p.Compression {
+	case CompressionDeflate:
+		flags |= FlagDeflate
+	case CompressionZstd:
+		flags |= FlagZstd
+	}
+	if p.Depth == 8 {
+		flags |= Flag8Bit
+	}
+	return flags
+}
+
+// frameSeq numbers the frames of every encoder, so that a frame from one
+// can't be mistaken for a frame from another.
+var frameSeq atomic.Uint64
+
+// Encoder encodes the frames for a profile. It isn't safe for concurrent use.
+type Encoder struct {
+	profile  Profile
+	prevSeq  uint64
+	prev     []uint16
+	lastSent time.Time
+}
+
+// NewEncoder returns an encoder for a normalized profile.
+func NewEncoder(p Profile) *Encoder {
+	return &Encoder{profile: p}
+}
+
+// Due reports whether a frame at now is sent to clients on the profile,
+// which is at most MaxFPS frames a second.
+func (e *Encoder) Due(now time.Time) bool {
+	if e.profile.MaxFPS > 0 && now.Sub(e.lastSent) < time.Second/time.Duration(e.profile.MaxFPS) {
+		return false
+	}
+	e.lastSent = now
+	return true
+}
+
+// Reset forgets the previous frame, such as when the camera reconnects.
+func (e *Encoder) Reset() {
+	e.prev = nil
+	e.lastSent = time.Time{}
+}
+
+// Encode takes the next frame for the profile. The messages for it are
+// made when first asked for.
+func (e *Encoder) Encode(info FrameInfo, pix [][]uint16) *EncodedFrame {
+	region := e.profile.ROI.clip(len(firstRow(pix)), len(pix))
+	if region != (Region{Width: len(firstRow(pix)), Height: len(pix)}) {
+		info.Region = &region
+	}
+	values := make([]uint16, 0, region.Width*region.Height)
+	for _, row := range pix[region.Y : region.Y+region.Height] {
+		values = append(values, row[region.X:region.X+region.Width]...)
+	}
+	if e.profile.Depth == 8 {
+		info.Min, info.Max = scale(values)
+	}
+	f := &EncodedFrame{
+		profile: e.profile,
+		info:    info,
+		pixels:  values,
+		Seq:     frameSeq.Add(1),
+	}
+	if e.profile.Encoding == EncodingDelta && len(e.prev) == len(values) {
+		f.prev, f.prevSeq = e.prev, e.prevSeq
+	}
+	e.prevSeq, e.prev = f.Seq, values
+	return f
+}
+
+func firstRow(pix [][]uint16) []uint16 {
+	if len(pix) == 0 {
+		return nil
+	}
+	return pix[0]
+}
+
+// scale scales the values to 0-255 in place, returning the values that
+// 0 and 255 are.
+func scale(values []uint16) (uint16, uint16) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	for i, v := range values {
+		if hi > lo {
+			values[i] = uint16((uint32(v-lo)*255 + uint32(hi-lo)/2) / uint32(hi-lo))
+		} else {
+			values[i] = 0
+		}
+	}
+	return lo, hi
+}
+
+// EncodedFrame is a frame encoded for a profile. It is safe for concurrent
+// use, so that the clients on the profile can share it.
+type EncodedFrame struct {
+	// Seq numbers the frame. A client that was sent the frame before it
+	// from the same encoder can be sent a delta.
+	Seq uint64
+
+	profile Profile
+	info    FrameInfo
+	pixels  []uint16
+	prev    []uint16
+	prevSeq uint64
+
+	mu    sync.Mutex
+	key   []byte
+	delta []byte
+}
+
+// Message returns the message for a client that was last sent the frame
+// numbered lastSeq, which is a delta if the profile uses them and the
+// client has the frame before this one, and otherwise the whole frame.
+func (f *EncodedFrame) Message(lastSeq uint64) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var err error
+	if f.prev != nil && lastSeq == f.prevSeq {
+		if f.delta == nil {
+			f.delta, err = f.encode(true)
+		}
+		return f.delta, err
+	}
+	if f.key == nil {
+		f.key, err = f.encode(false)
+	}
+	return f.key, err
+}
+
+func (f *EncodedFrame) encode(delta bool) ([]byte, error) {
+	flags := f.profile.flags()
+	var body []byte
+	for i, v := range f.pixels {
+		if delta {
+			v -= f.prev[i]
+		}
+		if flags&Flag8Bit != 0 {
+			body = append(body, byte(v))
+		} else {
+			body = binary.LittleEndian.AppendUint16(body, v)
+		}
+	}
+	if delta {
+		flags |= FlagDelta
+	}
+	body, err := compress(flags, body)
+	if err != nil {
+		return nil, err
+	}
+	return encode(TypeFrame, flags, f.info, body)
+}
+
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil)
+	})
+)
+
+func compress(flags uint16, body []byte) ([]byte, error) {
+	switch {
+	case flags&FlagDeflate != 0:
+		var b bytes.Buffer
+		w, err := zlib.NewWriterLevel(&b, zlib.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case flags&FlagZstd != 0:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(body, nil), nil
+	}
+	return body, nil
+}
+
+func decompress(flags uint16, body []byte) ([]byte, error) {
+	switch {
+	case flags&FlagDeflate != 0:
+		r, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case flags&FlagZstd != 0:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(body, nil)
+	}
+	return body, nil
+}
+
+// Decoder decodes the frames sent to a client, keeping the previous frame
+// for deltas. It isn't safe for concurrent use.
+type Decoder struct {
+	prev []uint16
+}
+
+// Frame decodes a frame message. The pixels are of the region in the
+// FrameInfo, and are 0-255 for 8 bit frames.
+func (d *Decoder) Frame(m Message) (FrameInfo, [][]uint16, error) {
+	var info FrameInfo
+	if m.Type != TypeFrame {
+		return info, nil, fmt.Errorf("%v message is not a frame", m.Type)
+	}
+	if m.Flags&^knownFlags != 0 {
+		return info, nil, fmt.Errorf("unknown frame flags %#x", m.Flags)
+	}
+	if err := m.Unmarshal(&info); err != nil {
+		return info, nil, err
+	}
+	region := Region{Width: info.Camera.ResX, Height: info.Camera.ResY}
+	if info.Region != nil {
+		region = *info.Region
+	}
+	body, err := decompress(m.Flags, m.Body)
+	if err != nil {
+		return info, nil, err
+	}
+	size := 2
+	if m.Flags&Flag8Bit != 0 {
+		size = 1
+	}
+	n := region.Width * region.Height
+	if region.empty() || len(body) != n*size {
+		return info, nil, errors.New("frame size doesn't match the camera resolution")
+	}
+	delta := m.Flags&FlagDelta != 0
+	if delta && len(d.prev) != n {
+		return info, nil, errors.New("delta frame without the frame before it")
+	}
+	values := make([]uint16, n)
+	for i := range values {
+		if size == 1 {
+			values[i] = uint16(body[i])
+		} else {
+			values[i] = binary.LittleEndian.Uint16(body[i*2:])
+		}
+		if delta {
+			values[i] += d.prev[i]
+			if size == 1 {
+				values[i] &= 0xff
+			}
+		}
+	}
+	d.prev = values
+	pix := make([][]uint16, region.Height)
+	for y := range pix {
+		pix[y] = values[y*region.Width : (y+1)*region.Width]
+	}
+	return info, pix, nil
+}
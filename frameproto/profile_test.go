@@ -0,0 +1,214 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package frameproto
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	p, err := Profile{}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Profile{Encoding: EncodingRaw, Compression: CompressionNone, Depth: 16}); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	for _, p := range []Profile{
+		{Encoding: "rle"},
+		{Compression: "gzip"},
+		{Depth: 12},
+		{MaxFPS: -1},
+		{ROI: Region{Width: 10}},
+		{ROI: Region{X: -1, Width: 10, Height: 10}},
+	} {
+		if _, err := p.Normalize(); err == nil {
+			t.Errorf("no error for %+v", p)
+		}
+	}
+}
+
+// frames are 3x2 frames where some pixels change each frame.
+func frames(n int) [][][]uint16 {
+	var fs [][][]uint16
+	for i := 0; i < n; i++ {
+		fs = append(fs, [][]uint16{
+			{1000, uint16(2000 + i*7), 3000},
+			{uint16(i), 0xffff - uint16(i), 500},
+		})
+	}
+	return fs
+}
+
+func TestProfilesRoundTrip(t *testing.T) {
+	for _, encoding := range []string{EncodingRaw, EncodingDelta} {
+		for _, compression := range []string{CompressionNone, CompressionDeflate, CompressionZstd} {
+			p, err := Profile{Encoding: encoding, Compression: compression}.Normalize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := NewEncoder(p)
+			var d Decoder
+			var lastSeq uint64
+			info, _ := testFrame()
+			for i, pix := range frames(4) {
+				f := e.Encode(info, pix)
+				msg, err := f.Message(lastSeq)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lastSeq = f.Seq
+				m, err := Decode(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if delta := m.Flags&FlagDelta != 0; delta != (encoding == EncodingDelta && i > 0) {
+					t.Errorf("%+v frame %d: got delta %v", p, i, delta)
+				}
+				if m.Flags&^FlagDelta != p.flags() {
+					t.Errorf("%+v: got flags %#x", p, m.Flags)
+				}
+				gotInfo, got, err := d.Frame(m)
+				if err != nil {
+					t.Fatalf("%+v frame %d: %v", p, i, err)
+				}
+				if !reflect.DeepEqual(got, pix) || !reflect.DeepEqual(gotInfo, info) {
+					t.Errorf("%+v frame %d: got %+v %v, want %v", p, i, gotInfo, got, pix)
+				}
+			}
+		}
+	}
+}
+
+func TestDeltaNeedsPreviousFrame(t *testing.T) {
+	e := NewEncoder(Profile{Encoding: EncodingDelta, Compression: CompressionNone, Depth: 16})
+	info, _ := testFrame()
+	fs := frames(3)
+	first := e.Encode(info, fs[0])
+	second := e.Encode(info, fs[1])
+	third := e.Encode(info, fs[2])
+
+	// A client that missed the second frame gets the whole third frame.
+	msg, _ := third.Message(first.Seq)
+	m, _ := Decode(msg)
+	if m.Flags&FlagDelta != 0 {
+		t.Error("got a delta for a client that missed a frame")
+	}
+	var d Decoder
+	if _, pix, err := d.Frame(m); err != nil || !reflect.DeepEqual(pix, fs[2]) {
+		t.Errorf("got %v %v", pix, err)
+	}
+
+	// Without the frame before it a delta can't be decoded.
+	msg, _ = third.Message(second.Seq)
+	m, _ = Decode(msg)
+	if _, _, err := m.Frame(); err == nil {
+		t.Error("decoded a delta without the frame before it")
+	}
+
+	// Frames of a new size start again.
+	small := e.Encode(info, [][]uint16{{1, 2}})
+	msg, _ = e.Encode(info, [][]uint16{{1, 2, 3}}).Message(small.Seq)
+	if m, _ := Decode(msg); m.Flags&FlagDelta != 0 {
+		t.Error("got a delta from a frame of a different size")
+	}
+
+	// As do frames after a reset, even for a client of another encoder
+	// that was sent a frame with the same number.
+	e.Reset()
+	other := NewEncoder(e.profile).Encode(info, fs[0])
+	msg, _ = e.Encode(info, fs[1]).Message(other.Seq)
+	if m, _ := Decode(msg); m.Flags&FlagDelta != 0 {
+		t.Error("got a delta after a reset")
+	}
+}
+
+func TestEightBitRegion(t *testing.T) {
+	p := Profile{Encoding: EncodingDelta, Compression: CompressionDeflate, Depth: 8, ROI: Region{X: 1, Y: 0, Width: 5, Height: 1}}
+	p, err := p.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEncoder(p)
+	var d Decoder
+	info, _ := testFrame()
+	var lastSeq uint64
+	for _, test := range []struct {
+		pix  [][]uint16
+		want [][]uint16
+	}{
+		{[][]uint16{{9, 1000, 2000, 3000}, {9, 9, 9, 9}}, [][]uint16{{0, 128, 255}}},
+		{[][]uint16{{9, 3000, 1000, 1000}, {9, 9, 9, 9}}, [][]uint16{{255, 0, 0}}},
+		{[][]uint16{{9, 5, 5, 5}, {9, 9, 9, 9}}, [][]uint16{{0, 0, 0}}},
+	} {
+		f := e.Encode(info, test.pix)
+		msg, err := f.Message(lastSeq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastSeq = f.Seq
+		m, _ := Decode(msg)
+		gotInfo, got, err := d.Frame(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got %v, want %v", got, test.want)
+		}
+		if want := (Region{X: 1, Width: 3, Height: 1}); gotInfo.Region == nil || *gotInfo.Region != want {
+			t.Errorf("got region %+v, want %+v", gotInfo.Region, want)
+		}
+		if gotInfo.Min != min(test.pix[0][1], test.pix[0][2], test.pix[0][3]) || gotInfo.Max != max(test.pix[0][1], test.pix[0][2], test.pix[0][3]) {
+			t.Errorf("got min %d max %d for %v", gotInfo.Min, gotInfo.Max, test.pix)
+		}
+	}
+}
+
+func TestRegionOutsideFrame(t *testing.T) {
+	e := NewEncoder(Profile{Encoding: EncodingRaw, Compression: CompressionNone, Depth: 16, ROI: Region{X: 10, Y: 10, Width: 5, Height: 5}})
+	info, pix := testFrame()
+	msg, _ := e.Encode(info, pix).Message(0)
+	m, _ := Decode(msg)
+	gotInfo, got, err := m.Frame()
+	if err != nil || gotInfo.Region != nil || !reflect.DeepEqual(got, pix) {
+		t.Errorf("got %+v %v %v, want the whole frame", gotInfo.Region, got, err)
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Now()
+	e := NewEncoder(Profile{MaxFPS: 2})
+	var sent int
+	for i := 0; i < 9; i++ {
+		if e.Due(now.Add(time.Duration(i) * time.Second / 9)) {
+			sent++
+		}
+	}
+	if sent != 2 {
+		t.Errorf("sent %d frames in a second at 2 fps", sent)
+	}
+	e = NewEncoder(Profile{})
+	for i := 0; i < 9; i++ {
+		if !e.Due(now) {
+			t.Fatal("frame not due without a maxFPS")
+		}
+	}
+}
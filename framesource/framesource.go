@@ -0,0 +1,214 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package framesource sends thermal frames to managementd over its frame
+// socket in the same way that tc2-agent does, so that the camera page can be
+// developed and tested without a camera.
+package framesource
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+)
+
+const (
+	// Clear is sent after the header, as leptond does when it restarts the
+	// camera.
+	Clear = "clear"
+	// telemetryBytes is the size of the telemetry at the start of each frame.
+	telemetryBytes = 4 * 160
+)
+
+var ffcStates = map[string]uint32{
+	lepton3.FFCNever:    0,
+	lepton3.FFCImminent: 1,
+	lepton3.FFCRunning:  2,
+	lepton3.FFCComplete: 3,
+}
+
+// Header describes the camera that frames are from.
+type Header struct {
+	ResX     int
+	ResY     int
+	FPS      int
+	Brand    string
+	Model    string
+	Firmware string
+	Serial   int
+}
+
+// Lepton35 is the header of the camera in a TC2.
+var Lepton35 = Header{
+	ResX:     lepton3.FrameCols,
+	ResY:     lepton3.FrameRows,
+	FPS:      lepton3.FramesHz,
+	Brand:    lepton3.Brand,
+	Model:    lepton3.Model35,
+	Firmware: "3.3.26",
+	Serial:   1,
+}
+
+// FrameSize is the number of bytes in each raw frame, including the telemetry.
+func (h Header) FrameSize() int {
+	return telemetryBytes + h.ResX*h.ResY*2
+}
+
+// NewFrame returns an empty frame of the size given in the header.
+func (h Header) NewFrame() *cptvframe.Frame {
+	return cptvframe.NewFrame(camera{h})
+}
+
+// camera lets a Header be used as a cptvframe.CameraSpec.
+type camera struct {
+	h Header
+}
+
+func (c camera) ResX() int { return c.h.ResX }
+func (c camera) ResY() int { return c.h.ResY }
+func (c camera) FPS() int  { return c.h.FPS }
+
+// WriteHeader writes the header in the YAML form read by headers.ReadHeaderInfo.
+func WriteHeader(w io.Writer, h Header) error {
+	_, err := fmt.Fprintf(w, "%s: %d\n%s: %d\n%s: %d\n%s: %d\n%s: %q\n%s: %q\n%s: %q\n%s: %d\n\n",
+		headers.XResolution, h.ResX,
+		headers.YResolution, h.ResY,
+		headers.FPS, h.FPS,
+		headers.FrameSize, h.FrameSize(),
+		headers.Brand, h.Brand,
+		headers.Model, h.Model,
+		headers.Firmware, h.Firmware,
+		headers.Serial, h.Serial)
+	return err
+}
+
+// telemetryWords is the layout of the telemetry read by lepton3.ParseTelemetry.
+type telemetryWords struct {
+	TelemetryRevision  uint16
+	TimeOn             uint32
+	StatusBits         uint32
+	Reserved5          [8]uint16
+	SoftwareRevision   [8]uint8
+	Reserved17         [3]uint16
+	FrameCounter       uint32
+	FrameMean          uint16
+	FPATempCounts      uint16
+	FPATemp            uint16
+	HousingTempRaw     uint16
+	HousingTemp        uint16
+	Reserved25         [2]uint16
+	FPATempLastFFC     uint16
+	TimeCounterLastFFC uint32
+	HousingTempLastFFC uint16
+}
+
+func centiK(tempC float64) uint16 {
+	return uint16(tempC*100 + 27315)
+}
+
+// EncodeFrame writes a frame into raw in the form read by
+// lepton3.ParseRawFrame. raw must be FrameSize bytes long.
+func EncodeFrame(raw []byte, frame *cptvframe.Frame) error {
+	pixels := len(frame.Pix) * len(frame.Pix[0])
+	if len(raw) != telemetryBytes+pixels*2 {
+		return fmt.Errorf("raw frame is %d bytes, not %d", len(raw), telemetryBytes+pixels*2)
+	}
+	status := frame.Status
+	ffcState, ok := ffcStates[status.FFCState]
+	if !ok {
+		ffcState = ffcStates[lepton3.FFCNever]
+	}
+	telemetry := telemetryWords{
+		TimeOn:             uint32(status.TimeOn / time.Millisecond),
+		StatusBits:         ffcState << 4,
+		FrameCounter:       uint32(status.FrameCount),
+		FrameMean:          status.FrameMean,
+		FPATemp:            centiK(status.TempC),
+		FPATempLastFFC:     centiK(status.LastFFCTempC),
+		TimeCounterLastFFC: uint32(status.LastFFCTime / time.Millisecond),
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, lepton3.Big16, &telemetry); err != nil {
+		return err
+	}
+	clear(raw[:telemetryBytes])
+	copy(raw, buf.Bytes())
+	i := telemetryBytes
+	for _, row := range frame.Pix {
+		for _, p := range row {
+			binary.BigEndian.PutUint16(raw[i:], p)
+			i += 2
+		}
+	}
+	return nil
+}
+
+// Source makes the frames to send.
+type Source interface {
+	// Header describes the camera the frames are from.
+	Header() Header
+	// Next fills in the next frame. It returns io.EOF when there are no
+	// more frames.
+	Next(frame *cptvframe.Frame) error
+}
+
+// Stream sends the header and the clear message, then sends the frames from
+// src at the frame rate of the camera until there are no more frames or ctx
+// is done.
+func Stream(ctx context.Context, w io.Writer, src Source) error {
+	h := src.Header()
+	if h.FPS <= 0 {
+		return fmt.Errorf("invalid frame rate %d", h.FPS)
+	}
+	if err := WriteHeader(w, h); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, Clear); err != nil {
+		return err
+	}
+	frame := h.NewFrame()
+	raw := make([]byte, h.FrameSize())
+	ticker := time.NewTicker(time.Second / time.Duration(h.FPS))
+	defer ticker.Stop()
+	for {
+		if err := src.Next(frame); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := EncodeFrame(raw, frame); err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
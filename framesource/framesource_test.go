@@ -0,0 +1,180 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package framesource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+)
+
+// limit stops a source after n frames.
+type limit struct {
+	Source
+	n int
+}
+
+func (l *limit) Next(frame *cptvframe.Frame) error {
+	if l.n == 0 {
+		return io.EOF
+	}
+	l.n--
+	return l.Source.Next(frame)
+}
+
+func sceneFrames(t *testing.T, src Source, n int) []*cptvframe.Frame {
+	t.Helper()
+	var frames []*cptvframe.Frame
+	for i := 0; i < n; i++ {
+		frame := src.Header().NewFrame()
+		if err := src.Next(frame); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// TestStream reads a stream the same way managementd does.
+func TestStream(t *testing.T) {
+	h := Lepton35
+	h.FPS = 500
+	var buf bytes.Buffer
+	if err := Stream(context.Background(), &buf, &limit{NewScene(h, 3, time.Second, 1), 20}); err != nil {
+		t.Fatal(err)
+	}
+	want := sceneFrames(t, NewScene(h, 3, time.Second, 1), 20)
+
+	reader := bufio.NewReader(&buf)
+	info, err := headers.ReadHeaderInfo(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ResX() != h.ResX || info.ResY() != h.ResY || info.FPS() != h.FPS || info.FrameSize() != lepton3.BytesPerFrame ||
+		info.Brand() != h.Brand || info.Model() != h.Model || info.Firmware() != h.Firmware || info.CameraSerial() != h.Serial {
+		t.Fatalf("unexpected header %+v", info)
+	}
+	clearB := make([]byte, 5)
+	if _, err := io.ReadFull(reader, clearB); err != nil || string(clearB) != Clear {
+		t.Fatalf("got %q, %v", clearB, err)
+	}
+	raw := make([]byte, info.FrameSize())
+	frame := cptvframe.NewFrame(info)
+	for i, w := range want {
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if err := lepton3.ParseRawFrame(raw, frame, 0); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(frame.Pix, w.Pix) {
+			t.Errorf("frame %d pixels differ", i)
+		}
+		// Temperatures are sent to a hundredth of a degree.
+		frame.Status.TempC, frame.Status.LastFFCTempC = w.Status.TempC, w.Status.LastFFCTempC
+		if frame.Status != w.Status {
+			t.Errorf("frame %d has status %+v, want %+v", i, frame.Status, w.Status)
+		}
+	}
+	if n, _ := reader.Read(raw); n != 0 {
+		t.Errorf("%d bytes after the last frame", n)
+	}
+}
+
+func TestSceneFFC(t *testing.T) {
+	frames := sceneFrames(t, NewScene(Lepton35, 1, 10*time.Second, 1), 120)
+	states := map[string][]int{}
+	for _, f := range frames {
+		states[f.Status.FFCState] = append(states[f.Status.FFCState], f.Status.FrameCount)
+	}
+	// At 9 fps the FFC is imminent from 8 seconds and runs from 10 seconds.
+	if running := states[lepton3.FFCRunning]; len(running) != 9 || running[0] != 90 {
+		t.Errorf("FFC ran for frames %v", running)
+	}
+	if imminent := states[lepton3.FFCImminent]; len(imminent) != 18 || imminent[0] != 72 {
+		t.Errorf("FFC was imminent for frames %v", imminent)
+	}
+	if !reflect.DeepEqual(frames[89].Pix, frames[97].Pix) || reflect.DeepEqual(frames[97].Pix, frames[98].Pix) {
+		t.Error("the image didn't freeze while the FFC ran")
+	}
+	if last := frames[len(frames)-1].Status; last.LastFFCTime != 10*time.Second || last.FFCState != lepton3.FFCComplete {
+		t.Errorf("unexpected status after FFC %+v", last)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cptv")
+	frames := sceneFrames(t, NewScene(Lepton35, 2, 0, 1), 5)
+	writer, err := cptv.NewWriter(path, camera{Lepton35})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteHeader(cptv.Header{FPS: Lepton35.FPS, Brand: Lepton35.Brand, Model: Lepton35.Model, CameraSerial: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		f.Status.TimeOn += time.Minute
+		f.Status.LastFFCTime = time.Minute - 10*time.Second
+		if err := writer.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, err := OpenRecording(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recording.Close()
+	if h := recording.Header(); h.ResX != 160 || h.ResY != 120 || h.FPS != 9 || h.Model != Lepton35.Model || h.Serial != 42 {
+		t.Errorf("unexpected header %+v", h)
+	}
+	replayed := sceneFrames(t, recording, 12)
+	for i, f := range replayed {
+		if !reflect.DeepEqual(f.Pix, frames[i%len(frames)].Pix) {
+			t.Errorf("frame %d pixels differ", i)
+		}
+		if f.Status.FrameCount != i+1 || f.Status.TimeOn != time.Duration(i+1)*time.Second/9 || f.Status.FFCState != lepton3.FFCComplete {
+			t.Errorf("frame %d has status %+v", i, f.Status)
+		}
+	}
+
+	recording, err = OpenRecording(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recording.Close()
+	sceneFrames(t, recording, len(frames))
+	if err := recording.Next(recording.Header().NewFrame()); err != io.EOF {
+		t.Errorf("got %v at the end of the recording", err)
+	}
+}
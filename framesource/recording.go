@@ -0,0 +1,120 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package framesource
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+)
+
+// Recording replays the frames of a CPTV recording.
+type Recording struct {
+	path   string
+	loop   bool
+	file   *os.File
+	reader *cptv.Reader
+	header Header
+	frames int
+}
+
+// OpenRecording opens a CPTV file to replay, starting from the beginning
+// again at the end when loop is true.
+func OpenRecording(path string, loop bool) (*Recording, error) {
+	r := &Recording{path: path, loop: loop}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	fps := r.reader.FPS()
+	if fps <= 0 {
+		fps = lepton3.FramesHz
+	}
+	r.header = Header{
+		ResX:     r.reader.ResX(),
+		ResY:     r.reader.ResY(),
+		FPS:      fps,
+		Brand:    r.reader.BrandName(),
+		Model:    r.reader.ModelName(),
+		Firmware: r.reader.FirmwareVersion(),
+		Serial:   r.reader.SerialNumber(),
+	}
+	return r, nil
+}
+
+func (r *Recording) open() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	reader, err := cptv.NewReader(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.reader = file, reader
+	return nil
+}
+
+func (r *Recording) Header() Header {
+	return r.header
+}
+
+// Next reads the next frame of the recording. Frames are counted and timed
+// from the start of the replay, so that they keep going up when the
+// recording loops. The FFC state isn't recorded, so frames within a second
+// of an FFC are reported as it running.
+func (r *Recording) Next(frame *cptvframe.Frame) error {
+	frame.Status = cptvframe.Telemetry{}
+	err := r.reader.ReadFrame(frame)
+	if errors.Is(err, io.EOF) && r.loop && r.frames > 0 {
+		r.file.Close()
+		if err := r.open(); err != nil {
+			return err
+		}
+		err = r.reader.ReadFrame(frame)
+	}
+	if err != nil {
+		return err
+	}
+	r.frames++
+	recorded := frame.Status
+	status := &frame.Status
+	status.FrameCount = r.frames
+	status.TimeOn = time.Duration(r.frames) * time.Second / time.Duration(r.header.FPS)
+	status.FFCState = lepton3.FFCComplete
+	// Older recordings don't have the time the camera has been on.
+	if recorded.TimeOn > 0 {
+		sinceFFC := recorded.TimeOn - recorded.LastFFCTime
+		status.LastFFCTime = max(status.TimeOn-sinceFFC, 0)
+		if sinceFFC < ffcDuration {
+			status.FFCState = lepton3.FFCRunning
+		}
+	}
+	return nil
+}
+
+// Close closes the CPTV file.
+func (r *Recording) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,165 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package framesource
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+)
+
+const (
+	// backgroundLevel is the raw value of the cool background.
+	backgroundLevel = 3000
+	// noiseLevel is how much pixels vary from frame to frame.
+	noiseLevel = 8
+	// ffcDuration is how long the image freezes for during an FFC.
+	ffcDuration = time.Second
+	// ffcWarning is how long before an FFC it is reported as imminent.
+	ffcWarning  = 2 * time.Second
+	cameraTempC = 30
+)
+
+// Scene is a synthetic scene of warm blobs moving over a cool background.
+// The camera runs an FFC every ffcInterval, freezing the image while it
+// runs as a Lepton does.
+type Scene struct {
+	header      Header
+	ffcInterval time.Duration
+	rand        *rand.Rand
+	blobs       []blob
+	pix         [][]uint16
+	frames      int
+	lastFFC     time.Duration
+	lastFFCTemp float64
+}
+
+type blob struct {
+	x, y, dx, dy float64
+	radius       float64
+	heat         float64
+}
+
+// NewScene returns a scene with the given number of blobs. The blobs are
+// placed using seed, so a seed always gives the same frames. No FFCs are run
+// when ffcInterval is zero.
+func NewScene(h Header, blobs int, ffcInterval time.Duration, seed int64) *Scene {
+	s := &Scene{
+		header:      h,
+		ffcInterval: ffcInterval,
+		rand:        rand.New(rand.NewSource(seed)),
+		pix:         h.NewFrame().Pix,
+		lastFFCTemp: cameraTempC,
+	}
+	for i := 0; i < blobs; i++ {
+		s.blobs = append(s.blobs, blob{
+			x:      s.rand.Float64() * float64(h.ResX),
+			y:      s.rand.Float64() * float64(h.ResY),
+			dx:     s.rand.Float64()*4 - 2,
+			dy:     s.rand.Float64()*2 - 1,
+			radius: 3 + s.rand.Float64()*5,
+			heat:   300 + s.rand.Float64()*600,
+		})
+	}
+	s.draw()
+	return s
+}
+
+func (s *Scene) Header() Header {
+	return s.header
+}
+
+// Next moves the blobs and draws the next frame.
+func (s *Scene) Next(frame *cptvframe.Frame) error {
+	s.frames++
+	timeOn := time.Duration(s.frames) * time.Second / time.Duration(s.header.FPS)
+	tempC := cameraTempC + timeOn.Minutes()/60
+
+	ffcState := lepton3.FFCNever
+	if s.ffcInterval > 0 {
+		sinceFFC := timeOn - s.lastFFC
+		switch {
+		case sinceFFC >= s.ffcInterval:
+			s.lastFFC = timeOn
+			s.lastFFCTemp = tempC
+			ffcState = lepton3.FFCRunning
+		case s.lastFFC > 0 && sinceFFC < ffcDuration:
+			ffcState = lepton3.FFCRunning
+		case sinceFFC >= s.ffcInterval-ffcWarning:
+			ffcState = lepton3.FFCImminent
+		default:
+			ffcState = lepton3.FFCComplete
+		}
+	}
+	if ffcState != lepton3.FFCRunning {
+		s.move()
+		s.draw()
+	}
+
+	var sum int
+	for y, row := range s.pix {
+		copy(frame.Pix[y], row)
+		for _, p := range row {
+			sum += int(p)
+		}
+	}
+	frame.Status = cptvframe.Telemetry{
+		TimeOn:       timeOn,
+		FFCState:     ffcState,
+		FrameCount:   s.frames,
+		FrameMean:    uint16(sum / (s.header.ResX * s.header.ResY)),
+		TempC:        tempC,
+		LastFFCTempC: s.lastFFCTemp,
+		LastFFCTime:  s.lastFFC,
+	}
+	return nil
+}
+
+// move moves the blobs, bouncing them off the edges of the frame.
+func (s *Scene) move() {
+	for i := range s.blobs {
+		b := &s.blobs[i]
+		b.x += b.dx
+		b.y += b.dy
+		if b.x < 0 || b.x >= float64(s.header.ResX) {
+			b.dx = -b.dx
+			b.x += 2 * b.dx
+		}
+		if b.y < 0 || b.y >= float64(s.header.ResY) {
+			b.dy = -b.dy
+			b.y += 2 * b.dy
+		}
+	}
+}
+
+func (s *Scene) draw() {
+	for y, row := range s.pix {
+		for x := range row {
+			level := backgroundLevel + float64(y) + s.rand.Float64()*2*noiseLevel - noiseLevel
+			for _, b := range s.blobs {
+				dx, dy := float64(x)-b.x, float64(y)-b.y
+				level += b.heat * math.Exp(-(dx*dx+dy*dy)/(2*b.radius*b.radius))
+			}
+			row[x] = uint16(math.Min(level, math.MaxUint16))
+		}
+	}
+}
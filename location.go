@@ -46,5 +46,5 @@ func LocationHandler(config *goconfig.Config, w http.ResponseWriter, r *http.Req
 		Location:     &location,
 		ErrorMessage: errorMessage(err),
 	}
-	tmpl.ExecuteTemplate(w, "location.html", resp)
+	executeTemplate(w, "location.html", resp)
 }
@@ -19,13 +19,12 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package managementinterface
 
 import (
+	"context"
 	"encoding/json"
-	"html/template"
 	"io"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"runtime"
 	"slices"
 	"strconv"
@@ -42,34 +41,28 @@ import (
 	"golang.org/x/text/language"
 
 	"github.com/TheCacophonyProject/go-utils/logging"
-	"github.com/gobuffalo/packr"
+	"github.com/TheCacophonyProject/management-interface/command"
+	"github.com/TheCacophonyProject/management-interface/device"
+	"github.com/TheCacophonyProject/management-interface/settings"
 	"github.com/gorilla/mux"
 )
 
 var log = logging.NewLogger("info")
 
-// Using a packr box means the html files are bundled up in the binary application.
-var templateBox = packr.NewBox("./html")
-
-// tmpl is our pointer to our parsed templates.
-var tmpl *template.Template
-
-// This does some initialisation.  It parses our html templates up front and
-// finds the location where this executable was started.
-func init() {
-	// The name of the device we are running this executable on.
-	deviceName := getDeviceName()
-	tmpl = template.New("")
-	tmpl.Funcs(template.FuncMap{"DeviceName": func() string { return deviceName }})
-	for _, name := range templateBox.List() {
-		t := tmpl.New(name)
-		s, err := templateBox.FindString(name)
-		if err != nil {
-			log.Fatal(err)
-		}
-		template.Must(t.Parse(s))
-	}
-}
+// Commands runs the system commands used by the pages.
+var Commands command.Runner = command.Exec{}
+
+// Settings has the paths of the files shown by the pages.
+var Settings = settings.Default()
+
+// Profile is what the device can do, which decides the menu entries shown.
+var Profile device.Profile
+
+// How long the commands used by the pages are given before they are killed.
+const (
+	statsTimeout = 10 * time.Second
+	pingTimeout  = 20 * time.Second
+)
 
 // NetworkConfig is a struct to store our network configuration values in.
 type NetworkConfig struct {
@@ -155,15 +148,15 @@ func readFile(file string) string {
 }
 
 // Return info on the disk space available, disk space used etc.
-func getDiskSpace() (string, error) {
+func getDiskSpace(ctx context.Context) (string, error) {
 	var out []byte
 	err := error(nil)
 	if runtime.GOOS == "windows" {
 		// On Windows, commands need to be handled like this:
-		out, err = exec.Command("cmd", "/C", "dir").Output()
+		out, err = Commands.Run(ctx, statsTimeout, "cmd", "/C", "dir")
 	} else {
 		// 'Nix.  Run df command to show disk space available on SD card.
-		out, err = exec.Command("sh", "-c", "df -h").Output()
+		out, err = Commands.Run(ctx, statsTimeout, "sh", "-c", "df -h")
 	}
 
 	if err != nil {
@@ -174,15 +167,15 @@ func getDiskSpace() (string, error) {
 }
 
 // Return info on memory e.g. memory used, memory available etc.
-func getMemoryStats() (string, error) {
+func getMemoryStats(ctx context.Context) (string, error) {
 	var out []byte
 	err := error(nil)
 	if runtime.GOOS == "windows" {
 		// Will show more than just memory stuff.
-		out, err = exec.Command("cmd", "/C", "systeminfo").Output()
+		out, err = Commands.Run(ctx, statsTimeout, "cmd", "/C", "systeminfo")
 	} else {
 		// 'Nix.  Run vmstat command to show memory stats.
-		out, err = exec.Command("sh", "-c", "vmstat -s").Output()
+		out, err = Commands.Run(ctx, statsTimeout, "sh", "-c", "vmstat -s")
 	}
 
 	if err != nil {
@@ -194,9 +187,10 @@ func getMemoryStats() (string, error) {
 
 // DiskMemoryHandler shows disk space usage and memory usage
 func DiskMemoryHandler(w http.ResponseWriter, r *http.Request) {
-	diskData, err := getDiskSpace()
+	diskData, err := getDiskSpace(r.Context())
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	// Want to separate this into separate fields so that can display in a table in HTML
@@ -210,9 +204,10 @@ func DiskMemoryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	memoryData, err := getMemoryStats()
+	memoryData, err := getMemoryStats(r.Context())
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	// Want to separate this into separate fields so that can display in a table in HTML
 	outputStrings2 := [][]string{}
@@ -247,17 +242,17 @@ func DiskMemoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Execute the actual template.
-	tmpl.ExecuteTemplate(w, "disk-memory.html", outputStruct)
+	executeTemplate(w, "disk-memory.html", outputStruct)
 }
 
 // IndexHandler is the root handler.
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "index.html", nil)
+	executeTemplate(w, "index.html", Profile)
 }
 
 // AdvancedMenuHandler is a screen to more advanced settings.
 func AdvancedMenuHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "advanced.html", nil)
+	executeTemplate(w, "advanced.html", Profile)
 }
 
 // Get the IP address for a given interface.  There can be 0, 1 or 2 (e.g. IPv4 and IPv6)
@@ -319,7 +314,7 @@ func NetworkHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Need to respond to individual requests to test if a network status is up or down.
-	tmpl.ExecuteTemplate(w, "network.html", state)
+	executeTemplate(w, "network.html", state)
 }
 
 type wifiNetwork struct {
@@ -363,7 +358,7 @@ func WifiNetworkHandler(w http.ResponseWriter, r *http.Request) {
 		wifiProps.Error = "Wifi Error: " + err.Error()
 	}
 
-	tmpl.ExecuteTemplate(w, "wifi-networks.html", wifiProps)
+	executeTemplate(w, "wifi-networks.html", wifiProps)
 }
 
 // AboutHandlerGen is a wrapper for the AboutHandler function.
@@ -410,7 +405,7 @@ func AboutHandler(w http.ResponseWriter, r *http.Request, conf *goconfig.Config)
 	packages, err := versionreporter.GetInstalledPackages()
 	if err != nil {
 		resp.ErrorMessage = errorMessage(err)
-		tmpl.ExecuteTemplate(w, "about.html", resp)
+		executeTemplate(w, "about.html", resp)
 	}
 	log.Printf("Packages are %v", packages)
 	keys := make([]string, len(packages))
@@ -428,7 +423,7 @@ func AboutHandler(w http.ResponseWriter, r *http.Request, conf *goconfig.Config)
 	}
 	resp.PackageDataRows = data
 
-	tmpl.ExecuteTemplate(w, "about.html", resp)
+	executeTemplate(w, "about.html", resp)
 }
 
 // CheckInterfaceHandler checks an interface to see if it is up or down.
@@ -448,7 +443,7 @@ func CheckInterfaceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	args := []string{"-I", iface.Name, "-c", "3", "-n", "-W", "15", "1.1.1.1"}
-	output, err := exec.Command("ping", args...).Output()
+	output, err := Commands.Run(r.Context(), pingTimeout, "ping", args...)
 	w.WriteHeader(http.StatusOK)
 	response["result"] = string(output)
 	if err != nil {
@@ -462,42 +457,47 @@ func CheckInterfaceHandler(w http.ResponseWriter, r *http.Request) {
 
 // CameraHandler will show a frame from the camera to help with positioning
 func CameraHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "camera.html", nil)
+	executeTemplate(w, "camera.html", nil)
 }
 
 func LowPowerThermalRecordingHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "low-power-thermal-recording.html", nil)
+	executeTemplate(w, "low-power-thermal-recording.html", nil)
 }
 
 // CameraSnapshot - Still image from Lepton camera
 func CameraSnapshot(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "/var/spool/cptv/still.png")
+	http.ServeFile(w, r, Settings.StillImageFile)
 }
 
 func TimeHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "clock.html", nil)
+	executeTemplate(w, "clock.html", nil)
 }
 
 // Rename page to change device name and group
 func Rename(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "rename.html", nil)
+	executeTemplate(w, "rename.html", nil)
 }
 
 // Config page to change devices config
 func Config(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "config.html", nil)
+	executeTemplate(w, "config.html", nil)
+}
+
+// ChangePassword page to set the management API password
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	executeTemplate(w, "change-password.html", nil)
 }
 
 func Modem(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "modem.html", nil)
+	executeTemplate(w, "modem.html", nil)
 }
 
 func Battery(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "battery.html", nil)
+	executeTemplate(w, "battery.html", nil)
 }
 
 func DownloadTemperatureCSV(w http.ResponseWriter, r *http.Request) {
-	filePath := "/var/log/temperature.csv"
+	filePath := Settings.TemperatureFile
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -517,7 +517,7 @@ func DownloadTemperatureCSV(w http.ResponseWriter, r *http.Request) {
 }
 
 func DownloadBatteryCSV(w http.ResponseWriter, r *http.Request) {
-	filePath := "/var/log/battery-readings.csv"
+	filePath := Settings.BatteryReadingsFile
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -572,7 +572,7 @@ func Audiobait(w http.ResponseWriter, r *http.Request) {
 	playSchedule, err := playlist.LoadScheduleFromDisk(goconfig.DefaultAudioBait().Dir)
 	if err != nil {
 		log.Println(err)
-		tmpl.ExecuteTemplate(w, "audiobait.html", audiobaitResponse{
+		executeTemplate(w, "audiobait.html", audiobaitResponse{
 			ErrorMessage: err.Error(),
 		})
 		return
@@ -580,7 +580,7 @@ func Audiobait(w http.ResponseWriter, r *http.Request) {
 	library, err := audiofilelibrary.OpenLibrary(goconfig.DefaultAudioBait().Dir)
 	if err != nil {
 		log.Println(err)
-		tmpl.ExecuteTemplate(w, "audiobait.html", audiobaitResponse{
+		executeTemplate(w, "audiobait.html", audiobaitResponse{
 			ErrorMessage: err.Error(),
 		})
 		return
@@ -627,7 +627,7 @@ func Audiobait(w http.ResponseWriter, r *http.Request) {
 		},
 		Running: true,
 	}
-	tmpl.ExecuteTemplate(w, "audiobait.html", ar)
+	executeTemplate(w, "audiobait.html", ar)
 }
 
 func errorMessage(err error) string {
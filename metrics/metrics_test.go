@@ -0,0 +1,67 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func requestCount(code string) float64 {
+	return testutil.ToFloat64(requests.WithLabelValues("/recording/{id}", "GET", code))
+}
+
+func timedCount(t *testing.T) uint64 {
+	var m dto.Metric
+	if err := requestDuration.WithLabelValues("/recording/{id}", "GET").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRequests(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Requests)
+	router.HandleFunc("/recording/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			http.NotFound(w, r)
+		}
+	}).Methods("GET")
+
+	// The counters are shared with any other test of the middleware.
+	ok, notFound, timed := requestCount("200"), requestCount("404"), timedCount(t)
+	for _, path := range []string{"/recording/1", "/recording/2", "/recording/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if n := requestCount("200") - ok; n != 2 {
+		t.Errorf("got %v OK requests, want 2", n)
+	}
+	if n := requestCount("404") - notFound; n != 1 {
+		t.Errorf("got %v not found requests, want 1", n)
+	}
+	if n := timedCount(t) - timed; n != 3 {
+		t.Errorf("got %d timed requests, want 3", n)
+	}
+}
@@ -0,0 +1,388 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package peers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/audiobait/v3/audiobaitclient"
+	"github.com/TheCacophonyProject/event-reporter/v3/eventclient"
+	"github.com/TheCacophonyProject/rpi-net-manager/netmanagerclient"
+	saltrequester "github.com/TheCacophonyProject/salt-updater"
+	"github.com/TheCacophonyProject/trap-controller/trapdbusclient"
+	"github.com/godbus/dbus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const rtcTimeFormat = "2006-01-02T15:04:05Z07:00"
+
+// The names that errors calling each service are counted under.
+const (
+	tc2AgentService        = "tc2-agent"
+	thermalRecorderService = "thermal-recorder"
+	modemdService          = "modemd"
+	rtcService             = "rtc"
+	netManagerService      = "rpi-net-manager"
+	audiobaitService       = "audiobait"
+	saltService            = "salt-updater"
+	trapService            = "trap-controller"
+	eventsService          = "event-reporter"
+)
+
+var callErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "managementd_dbus_errors_total",
+	Help: "Failed D-Bus calls to the other services on the device, by service.",
+}, []string{"service"})
+
+// ErrAbsent can be given to a fake's Fail to act as a service that the
+// device doesn't have.
+var ErrAbsent = errors.New("service isn't on the device")
+
+// IsAbsent reports whether err is from calling a service that isn't on the
+// bus, such as modemd on a device without a modem.
+func IsAbsent(err error) bool {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown"
+	}
+	return errors.Is(err, ErrAbsent)
+}
+
+// countError counts err, if there is one, against the service.
+func countError(service string, err error) error {
+	if err != nil {
+		callErrors.WithLabelValues(service).Inc()
+	}
+	return err
+}
+
+// Connect returns the connection to the bus that tc2-agent, thermal-recorder,
+// modemd and the RTC service are on, such as dbus.SystemBus.
+type Connect func() (*dbus.Conn, error)
+
+// BusConnect returns a Connect for a bus, which is "system", "session" or the
+// address of another bus, such as a private one that fake-peers is on.
+func BusConnect(bus string) Connect {
+	switch bus {
+	case "", "system":
+		return dbus.SystemBus
+	case "session":
+		return dbus.SessionBus
+	}
+	var mu sync.Mutex
+	var conn *dbus.Conn
+	return func() (*dbus.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+		c, err := dbus.Dial(bus)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Auth(nil); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := c.Hello(); err != nil {
+			c.Close()
+			return nil, err
+		}
+		conn = c
+		return conn, nil
+	}
+}
+
+// NewDBus returns the peers on the device. The other services are always
+// reached on the system bus by their client libraries.
+func NewDBus(connect Connect) Peers {
+	return Peers{
+		TC2Agent:        dbusTC2Agent{dbusObject{connect, tc2AgentService, "org.cacophony.TC2Agent", "/org/cacophony/TC2Agent"}},
+		ThermalRecorder: dbusThermalRecorder{dbusObject{connect, thermalRecorderService, "org.cacophony.thermalrecorder", "/org/cacophony/thermalrecorder"}},
+		Modemd:          dbusModemd{dbusObject{connect, modemdService, "org.cacophony.modemd", "/org/cacophony/modemd"}},
+		RTC:             dbusRTC{dbusObject{connect, rtcService, "org.cacophony.RTC", "/org/cacophony/RTC"}},
+		NetManager:      netManager{},
+		Audiobait:       audiobait{},
+		Salt:            salt{},
+		Trap:            trap{},
+		Events:          events{},
+	}
+}
+
+// dbusObject connects for each call, as the service may not be running when
+// managementd starts.
+type dbusObject struct {
+	connect Connect
+	service string
+	name    string
+	path    dbus.ObjectPath
+}
+
+// call calls a method of the object's interface, which has the same name
+// as the service, and stores the results in retvalues. Any results are
+// ignored when no retvalues are given.
+func (o dbusObject) call(method string, args []interface{}, retvalues ...interface{}) error {
+	conn, err := o.connect()
+	if err != nil {
+		return countError(o.service, err)
+	}
+	call := conn.Object(o.name, o.path).Call(o.name+"."+method, 0, args...)
+	if len(retvalues) == 0 {
+		return countError(o.service, call.Err)
+	}
+	return countError(o.service, call.Store(retvalues...))
+}
+
+type dbusTC2Agent struct {
+	dbusObject
+}
+
+func (a dbusTC2Agent) rp2040Status(method string) (RP2040Status, error) {
+	var s RP2040Status
+	err := a.call(method, nil, &s.Mode, &s.Status)
+	return s, err
+}
+
+func (a dbusTC2Agent) message(method string, args ...interface{}) (string, error) {
+	var result string
+	err := a.call(method, args, &result)
+	return result, err
+}
+
+func (a dbusTC2Agent) AudioStatus() (RP2040Status, error) {
+	return a.rp2040Status("audiostatus")
+}
+
+func (a dbusTC2Agent) LongAudioRecording(seconds uint64) (string, error) {
+	return a.message("longaudiorecording", seconds)
+}
+
+func (a dbusTC2Agent) TestAudioRecording() (string, error) {
+	return a.message("testaudio")
+}
+
+func (a dbusTC2Agent) ThermalStatus() (RP2040Status, error) {
+	return a.rp2040Status("testthermalstatus")
+}
+
+func (a dbusTC2Agent) LongThermalRecording(seconds uint64) (string, error) {
+	return a.message("longtestthermalrecording", seconds)
+}
+
+func (a dbusTC2Agent) ShortThermalRecording() (string, error) {
+	return a.message("shorttestthermalrecording")
+}
+
+func (a dbusTC2Agent) OffloadStatus() (OffloadStatus, error) {
+	var s OffloadStatus
+	var inProgress int
+	err := a.call("offloadstatus", nil, &inProgress, &s.PercentComplete, &s.SecondsRemaining,
+		&s.FilesTotal, &s.FilesRemaining, &s.EventsTotal, &s.EventsRemaining)
+	s.InProgress = inProgress == 1
+	return s, err
+}
+
+func (a dbusTC2Agent) CancelOffload() (string, error) {
+	return a.message("canceloffload")
+}
+
+func (a dbusTC2Agent) ForceOffload() (string, error) {
+	return a.message("forcerp2040offload")
+}
+
+func (a dbusTC2Agent) PrioritiseFrameServe() (string, error) {
+	return a.message("prioritiseframeserve")
+}
+
+type dbusThermalRecorder struct {
+	dbusObject
+}
+
+func (t dbusThermalRecorder) TakeSnapshot() error {
+	return t.call("TakeSnapshot", nil)
+}
+
+func (t dbusThermalRecorder) TakeTestRecording() error {
+	return t.call("TakeTestRecording", nil)
+}
+
+type dbusModemd struct {
+	dbusObject
+}
+
+func (m dbusModemd) Status() (map[string]interface{}, error) {
+	var status map[string]interface{}
+	err := m.call("GetStatus", nil, &status)
+	return status, err
+}
+
+func (m dbusModemd) StayOnFor(minutes int) error {
+	return m.call("StayOnFor", []interface{}{minutes})
+}
+
+func (m dbusModemd) SetAPN(apn string) error {
+	return m.call("SetAPN", []interface{}{apn})
+}
+
+type dbusRTC struct {
+	dbusObject
+}
+
+func (r dbusRTC) Time() (time.Time, bool, error) {
+	var t string
+	var integrity bool
+	if err := r.call("GetTime", nil, &t, &integrity); err != nil {
+		return time.Time{}, false, err
+	}
+	rtcTime, err := time.Parse(rtcTimeFormat, t)
+	return rtcTime, integrity, err
+}
+
+func (r dbusRTC) SetTime(t time.Time) error {
+	return r.call("SetTime", []interface{}{t.Format(rtcTimeFormat)})
+}
+
+type netManager struct{}
+
+func (netManager) State() (netmanagerclient.NetworkState, error) {
+	state, err := netmanagerclient.ReadState()
+	return state, countError(netManagerService, err)
+}
+
+func (netManager) EnableWifi(force bool) error {
+	return countError(netManagerService, netmanagerclient.EnableWifi(force))
+}
+
+func (netManager) EnableHotspot(force bool) error {
+	return countError(netManagerService, netmanagerclient.EnableHotspot(force))
+}
+
+func (netManager) KeepHotspotOnFor(seconds int) error {
+	return countError(netManagerService, netmanagerclient.KeepHotspotOnFor(seconds))
+}
+
+func (netManager) ScanWifiNetworks() ([]netmanagerclient.WiFiNetwork, error) {
+	networks, err := netmanagerclient.ScanWiFiNetworks()
+	return networks, countError(netManagerService, err)
+}
+
+func (netManager) SavedWifiNetworks() ([]netmanagerclient.WiFiNetwork, error) {
+	networks, err := netmanagerclient.ListUserSavedWifiNetworks()
+	return networks, countError(netManagerService, err)
+}
+
+func (netManager) FindNetworkBySSID(ssid string) (netmanagerclient.WiFiNetwork, bool) {
+	return netmanagerclient.FindNetworkBySSID(ssid)
+}
+
+func (netManager) AddWifiNetwork(ssid, psk string) error {
+	return countError(netManagerService, netmanagerclient.AddWifiNetwork(ssid, psk))
+}
+
+func (netManager) ConnectWifiNetwork(ssid string) error {
+	return countError(netManagerService, netmanagerclient.ConnectWifiNetwork(ssid))
+}
+
+func (netManager) DisconnectWifiNetwork(ssid string, startHotspot bool) error {
+	return countError(netManagerService, netmanagerclient.DisconnectWifiNetwork(ssid, startHotspot))
+}
+
+func (netManager) RemoveWifiNetwork(ssid string, disconnect, startHotspot bool) error {
+	return countError(netManagerService, netmanagerclient.RemoveWifiNetwork(ssid, disconnect, startHotspot))
+}
+
+func (netManager) HotspotInterfaces() ([]string, error) {
+	ifaces, err := netmanagerclient.GetHotspotInterfaces()
+	return ifaces, countError(netManagerService, err)
+}
+
+func (netManager) HotspotInterface() (string, error) {
+	iface, err := netmanagerclient.GetHotspotInterface()
+	return iface, countError(netManagerService, err)
+}
+
+func (netManager) SetHotspotInterface(iface string) error {
+	return countError(netManagerService, netmanagerclient.SetHotspotInterface(iface))
+}
+
+type audiobait struct{}
+
+func (audiobait) PlayFromID(fileID, volume, priority int) (bool, error) {
+	played, err := audiobaitclient.PlayFromId(fileID, volume, priority, nil)
+	return played, countError(audiobaitService, err)
+}
+
+func (audiobait) PlayTestSound(volume int) error {
+	return countError(audiobaitService, audiobaitclient.PlayTestSound(volume))
+}
+
+type salt struct{}
+
+func (salt) Ping() (*saltrequester.SaltState, error) {
+	state, err := saltrequester.RunPingSync()
+	return state, countError(saltService, err)
+}
+
+func (salt) State() (*saltrequester.SaltState, error) {
+	state, err := saltrequester.State()
+	return state, countError(saltService, err)
+}
+
+func (salt) RunUpdate() error {
+	return countError(saltService, saltrequester.RunUpdate())
+}
+
+func (salt) ForceUpdate() error {
+	return countError(saltService, saltrequester.ForceUpdate())
+}
+
+func (salt) IsAutoUpdateOn() (bool, error) {
+	on, err := saltrequester.IsAutoUpdateOn()
+	return on, countError(saltService, err)
+}
+
+func (salt) SetAutoUpdate(autoUpdate bool) error {
+	return countError(saltService, saltrequester.SetAutoUpdate(autoUpdate))
+}
+
+type trap struct{}
+
+func (trap) TriggerTrap(details map[string]interface{}) error {
+	return countError(trapService, trapdbusclient.TriggerTrap(details))
+}
+
+type events struct{}
+
+func (events) Keys() ([]uint64, error) {
+	keys, err := eventclient.GetEventKeys()
+	return keys, countError(eventsService, err)
+}
+
+func (events) Get(key uint64) (*eventclient.Event, error) {
+	event, err := eventclient.GetEvent(key)
+	return event, countError(eventsService, err)
+}
+
+func (events) Delete(key uint64) error {
+	return countError(eventsService, eventclient.DeleteEvent(key))
+}
@@ -0,0 +1,589 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package peers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/event-reporter/v3/eventclient"
+	"github.com/TheCacophonyProject/rpi-net-manager/netmanagerclient"
+	saltrequester "github.com/TheCacophonyProject/salt-updater"
+)
+
+// Fakes are in-memory peers, for tests and for running managementd without
+// a device. The state of each fake can be read and set through its fields,
+// using Update when the API might be using it at the same time.
+type Fakes struct {
+	TC2Agent        *FakeTC2Agent
+	ThermalRecorder *FakeThermalRecorder
+	Modemd          *FakeModemd
+	RTC             *FakeRTC
+	NetManager      *FakeNetManager
+	Audiobait       *FakeAudiobait
+	Salt            *FakeSalt
+	Trap            *FakeTrap
+	Events          *FakeEvents
+}
+
+// NewFakes returns fakes of an idle TC2 connected to a WiFi network.
+func NewFakes() *Fakes {
+	return &Fakes{
+		TC2Agent:        &FakeTC2Agent{Result: "ok"},
+		ThermalRecorder: &FakeThermalRecorder{},
+		Modemd:          &FakeModemd{Values: map[string]interface{}{"powered": false}},
+		RTC:             &FakeRTC{Now: time.Now, Integrity: true},
+		NetManager: &FakeNetManager{
+			NetworkState: netmanagerclient.NS_WIFI_CONNECTED,
+			Saved:        []netmanagerclient.WiFiNetwork{{SSID: "bushnet", ID: "bushnet"}},
+			Scanned:      []netmanagerclient.WiFiNetwork{{SSID: "bushnet", Quality: "70"}},
+			Connected:    "bushnet",
+			Interfaces:   []string{"wlan0"},
+			Hotspot:      "wlan0",
+		},
+		Audiobait: &FakeAudiobait{},
+		Salt:      &FakeSalt{},
+		Trap:      &FakeTrap{},
+		Events:    &FakeEvents{Events: map[uint64]*eventclient.Event{}},
+	}
+}
+
+// Peers returns the fakes as the peers for the API.
+func (f *Fakes) Peers() Peers {
+	return Peers{
+		TC2Agent:        f.TC2Agent,
+		ThermalRecorder: f.ThermalRecorder,
+		Modemd:          f.Modemd,
+		RTC:             f.RTC,
+		NetManager:      f.NetManager,
+		Audiobait:       f.Audiobait,
+		Salt:            f.Salt,
+		Trap:            f.Trap,
+		Events:          f.Events,
+	}
+}
+
+// fake records the calls made to a fake service and can make them fail.
+type fake struct {
+	mu    sync.Mutex
+	err   error
+	calls []string
+}
+
+// Fail makes every call to the service return err, until called with nil.
+func (f *fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls returns the calls made to the service, such as "SetAPN(internet)".
+func (f *fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Update runs fn with the service locked, to change its state safely.
+func (f *fake) Update(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn()
+}
+
+// call records a call. Must be called with f.mu held.
+func (f *fake) call(format string, args ...interface{}) error {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+	return f.err
+}
+
+// FakeTC2Agent is a TC2Agent with the given RP2040 state.
+type FakeTC2Agent struct {
+	fake
+	Audio   RP2040Status
+	Thermal RP2040Status
+	Offload OffloadStatus
+	// Result is returned by requests that start something.
+	Result string
+}
+
+func (a *FakeTC2Agent) AudioStatus() (RP2040Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Audio, a.call("AudioStatus()")
+}
+
+func (a *FakeTC2Agent) LongAudioRecording(seconds uint64) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Result, a.call("LongAudioRecording(%d)", seconds)
+}
+
+func (a *FakeTC2Agent) TestAudioRecording() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Result, a.call("TestAudioRecording()")
+}
+
+func (a *FakeTC2Agent) ThermalStatus() (RP2040Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Thermal, a.call("ThermalStatus()")
+}
+
+func (a *FakeTC2Agent) LongThermalRecording(seconds uint64) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Result, a.call("LongThermalRecording(%d)", seconds)
+}
+
+func (a *FakeTC2Agent) ShortThermalRecording() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Result, a.call("ShortThermalRecording()")
+}
+
+func (a *FakeTC2Agent) OffloadStatus() (OffloadStatus, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Offload, a.call("OffloadStatus()")
+}
+
+func (a *FakeTC2Agent) CancelOffload() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.call("CancelOffload()"); err != nil {
+		return "", err
+	}
+	a.Offload.InProgress = false
+	return a.Result, nil
+}
+
+func (a *FakeTC2Agent) ForceOffload() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.call("ForceOffload()"); err != nil {
+		return "", err
+	}
+	a.Offload.InProgress = true
+	return a.Result, nil
+}
+
+func (a *FakeTC2Agent) PrioritiseFrameServe() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Result, a.call("PrioritiseFrameServe()")
+}
+
+// FakeThermalRecorder counts the snapshots and test recordings taken.
+type FakeThermalRecorder struct {
+	fake
+	Snapshots      int
+	TestRecordings int
+}
+
+func (t *FakeThermalRecorder) TakeSnapshot() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.call("TakeSnapshot()"); err != nil {
+		return err
+	}
+	t.Snapshots++
+	return nil
+}
+
+func (t *FakeThermalRecorder) TakeTestRecording() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.call("TakeTestRecording()"); err != nil {
+		return err
+	}
+	t.TestRecordings++
+	return nil
+}
+
+// FakeModemd is a Modemd returning Values as its status.
+type FakeModemd struct {
+	fake
+	Values       map[string]interface{}
+	StayOnForMin int
+	APN          string
+}
+
+func (m *FakeModemd) Status() (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := map[string]interface{}{}
+	for k, v := range m.Values {
+		status[k] = v
+	}
+	return status, m.call("Status()")
+}
+
+func (m *FakeModemd) StayOnFor(minutes int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("StayOnFor(%d)", minutes); err != nil {
+		return err
+	}
+	m.StayOnForMin = minutes
+	return nil
+}
+
+func (m *FakeModemd) SetAPN(apn string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("SetAPN(%s)", apn); err != nil {
+		return err
+	}
+	m.APN = apn
+	return nil
+}
+
+// FakeRTC is an RTC that keeps the time it is set to.
+type FakeRTC struct {
+	fake
+	// Now returns the time of the RTC.
+	Now       func() time.Time
+	Integrity bool
+}
+
+func (r *FakeRTC) Time() (time.Time, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Now(), r.Integrity, r.call("Time()")
+}
+
+func (r *FakeRTC) SetTime(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.call("SetTime(%s)", t.Format(rtcTimeFormat)); err != nil {
+		return err
+	}
+	offset := time.Until(t)
+	r.Now = func() time.Time { return time.Now().Add(offset) }
+	r.Integrity = true
+	return nil
+}
+
+// FakeNetManager is a NetManager that keeps the networks added to it.
+type FakeNetManager struct {
+	fake
+	NetworkState netmanagerclient.NetworkState
+	Saved        []netmanagerclient.WiFiNetwork
+	Scanned      []netmanagerclient.WiFiNetwork
+	// Connected is the SSID of the network the device is connected to.
+	Connected string
+	// Interfaces the hotspot can use. The hotspot interface can't be
+	// selected when there are none.
+	Interfaces   []string
+	Hotspot      string
+	HotspotOnFor int
+}
+
+func (n *FakeNetManager) State() (netmanagerclient.NetworkState, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.NetworkState, n.call("State()")
+}
+
+func (n *FakeNetManager) EnableWifi(force bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("EnableWifi(%v)", force); err != nil {
+		return err
+	}
+	n.NetworkState = netmanagerclient.NS_WIFI_SCANNING
+	if n.Connected != "" {
+		n.NetworkState = netmanagerclient.NS_WIFI_CONNECTED
+	}
+	return nil
+}
+
+func (n *FakeNetManager) EnableHotspot(force bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("EnableHotspot(%v)", force); err != nil {
+		return err
+	}
+	n.NetworkState = netmanagerclient.NS_HOTSPOT_RUNNING
+	n.Connected = ""
+	return nil
+}
+
+func (n *FakeNetManager) KeepHotspotOnFor(seconds int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// Not recorded, as it is called on every API request.
+	n.HotspotOnFor = seconds
+	return n.err
+}
+
+func (n *FakeNetManager) ScanWifiNetworks() ([]netmanagerclient.WiFiNetwork, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]netmanagerclient.WiFiNetwork(nil), n.Scanned...), n.call("ScanWifiNetworks()")
+}
+
+func (n *FakeNetManager) SavedWifiNetworks() ([]netmanagerclient.WiFiNetwork, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]netmanagerclient.WiFiNetwork(nil), n.Saved...), n.call("SavedWifiNetworks()")
+}
+
+func (n *FakeNetManager) FindNetworkBySSID(ssid string) (netmanagerclient.WiFiNetwork, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.call("FindNetworkBySSID(%s)", ssid)
+	for _, network := range n.Saved {
+		if network.SSID == ssid {
+			return network, true
+		}
+	}
+	return netmanagerclient.WiFiNetwork{}, false
+}
+
+func (n *FakeNetManager) AddWifiNetwork(ssid, psk string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("AddWifiNetwork(%s)", ssid); err != nil {
+		return err
+	}
+	if len(psk) < 8 {
+		return netmanagerclient.InputError{Message: "password must be at least 8 characters"}
+	}
+	n.Saved = append(n.Saved, netmanagerclient.WiFiNetwork{SSID: ssid, ID: ssid})
+	return nil
+}
+
+func (n *FakeNetManager) ConnectWifiNetwork(ssid string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("ConnectWifiNetwork(%s)", ssid); err != nil {
+		return err
+	}
+	n.Connected = ssid
+	n.NetworkState = netmanagerclient.NS_WIFI_CONNECTED
+	return nil
+}
+
+func (n *FakeNetManager) DisconnectWifiNetwork(ssid string, startHotspot bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("DisconnectWifiNetwork(%s, %v)", ssid, startHotspot); err != nil {
+		return err
+	}
+	n.Connected = ""
+	if startHotspot {
+		n.NetworkState = netmanagerclient.NS_HOTSPOT_RUNNING
+	}
+	return nil
+}
+
+func (n *FakeNetManager) RemoveWifiNetwork(ssid string, disconnect, startHotspot bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("RemoveWifiNetwork(%s, %v, %v)", ssid, disconnect, startHotspot); err != nil {
+		return err
+	}
+	for i, network := range n.Saved {
+		if network.SSID == ssid {
+			n.Saved = append(n.Saved[:i], n.Saved[i+1:]...)
+			if disconnect && n.Connected == ssid {
+				n.Connected = ""
+			}
+			return nil
+		}
+	}
+	return netmanagerclient.InputError{Message: fmt.Sprintf("network '%s' not found", ssid)}
+}
+
+func (n *FakeNetManager) HotspotInterfaces() ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("HotspotInterfaces()"); err != nil {
+		return nil, err
+	}
+	if len(n.Interfaces) == 0 {
+		return nil, netmanagerclient.ErrHotspotInterfaceUnsupported
+	}
+	return append([]string(nil), n.Interfaces...), nil
+}
+
+func (n *FakeNetManager) HotspotInterface() (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("HotspotInterface()"); err != nil {
+		return "", err
+	}
+	if len(n.Interfaces) == 0 {
+		return "", netmanagerclient.ErrHotspotInterfaceUnsupported
+	}
+	return n.Hotspot, nil
+}
+
+func (n *FakeNetManager) SetHotspotInterface(iface string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.call("SetHotspotInterface(%s)", iface); err != nil {
+		return err
+	}
+	if len(n.Interfaces) == 0 {
+		return netmanagerclient.ErrHotspotInterfaceUnsupported
+	}
+	n.Hotspot = iface
+	return nil
+}
+
+// FakeAudiobait records the sounds it is asked to play.
+type FakeAudiobait struct {
+	fake
+}
+
+func (a *FakeAudiobait) PlayFromID(fileID, volume, priority int) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.call("PlayFromID(%d, %d, %d)", fileID, volume, priority)
+	return err == nil, err
+}
+
+func (a *FakeAudiobait) PlayTestSound(volume int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.call("PlayTestSound(%d)", volume)
+}
+
+// FakeSalt is a Salt where updates start but never finish.
+type FakeSalt struct {
+	fake
+	SaltState  saltrequester.SaltState
+	AutoUpdate bool
+}
+
+func (s *FakeSalt) Ping() (*saltrequester.SaltState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.call("Ping()"); err != nil {
+		return nil, err
+	}
+	s.SaltState.LastCallSuccess = true
+	state := s.SaltState
+	return &state, nil
+}
+
+func (s *FakeSalt) State() (*saltrequester.SaltState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.SaltState
+	return &state, s.call("State()")
+}
+
+func (s *FakeSalt) RunUpdate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.call("RunUpdate()"); err != nil {
+		return err
+	}
+	s.SaltState.RunningUpdate = true
+	return nil
+}
+
+func (s *FakeSalt) ForceUpdate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.call("ForceUpdate()"); err != nil {
+		return err
+	}
+	s.SaltState.RunningUpdate = true
+	return nil
+}
+
+func (s *FakeSalt) IsAutoUpdateOn() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.AutoUpdate, s.call("IsAutoUpdateOn()")
+}
+
+func (s *FakeSalt) SetAutoUpdate(autoUpdate bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.call("SetAutoUpdate(%v)", autoUpdate); err != nil {
+		return err
+	}
+	s.AutoUpdate = autoUpdate
+	return nil
+}
+
+// FakeTrap counts how many times the trap is triggered.
+type FakeTrap struct {
+	fake
+	Triggered int
+}
+
+func (t *FakeTrap) TriggerTrap(details map[string]interface{}) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.call("TriggerTrap(%v)", details); err != nil {
+		return err
+	}
+	t.Triggered++
+	return nil
+}
+
+// FakeEvents is an Events store of Events.
+type FakeEvents struct {
+	fake
+	Events map[uint64]*eventclient.Event
+}
+
+func (e *FakeEvents) Keys() ([]uint64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keys := []uint64{}
+	for key := range e.Events {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys, e.call("Keys()")
+}
+
+func (e *FakeEvents) Get(key uint64) (*eventclient.Event, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("Get(%d)", key); err != nil {
+		return nil, err
+	}
+	event, ok := e.Events[key]
+	if !ok {
+		return nil, fmt.Errorf("no event with key %d", key)
+	}
+	return event, nil
+}
+
+func (e *FakeEvents) Delete(key uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.call("Delete(%d)", key); err != nil {
+		return err
+	}
+	delete(e.Events, key)
+	return nil
+}
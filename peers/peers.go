@@ -0,0 +1,141 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package peers has interfaces for the services on the device that
+// managementd talks to over D-Bus, so that the API can be run and tested
+// without them.
+package peers
+
+import (
+	"time"
+
+	"github.com/TheCacophonyProject/event-reporter/v3/eventclient"
+	"github.com/TheCacophonyProject/rpi-net-manager/netmanagerclient"
+	saltrequester "github.com/TheCacophonyProject/salt-updater"
+)
+
+// Peers are the services used by the API.
+type Peers struct {
+	TC2Agent        TC2Agent
+	ThermalRecorder ThermalRecorder
+	Modemd          Modemd
+	RTC             RTC
+	NetManager      NetManager
+	Audiobait       Audiobait
+	Salt            Salt
+	Trap            Trap
+	Events          Events
+}
+
+// RP2040Status is the mode and status of a test recording on the RP2040.
+type RP2040Status struct {
+	Mode   int
+	Status int
+}
+
+// OffloadStatus is the progress of offloading recordings from the RP2040.
+type OffloadStatus struct {
+	InProgress       bool
+	PercentComplete  int
+	SecondsRemaining int
+	FilesTotal       int
+	FilesRemaining   int
+	EventsTotal      int
+	EventsRemaining  int
+}
+
+// TC2Agent controls the RP2040 on a TC2 through tc2-agent. Requests that
+// start something return the message from tc2-agent.
+type TC2Agent interface {
+	AudioStatus() (RP2040Status, error)
+	LongAudioRecording(seconds uint64) (string, error)
+	TestAudioRecording() (string, error)
+	ThermalStatus() (RP2040Status, error)
+	LongThermalRecording(seconds uint64) (string, error)
+	ShortThermalRecording() (string, error)
+	OffloadStatus() (OffloadStatus, error)
+	CancelOffload() (string, error)
+	ForceOffload() (string, error)
+	PrioritiseFrameServe() (string, error)
+}
+
+// ThermalRecorder is the thermal-recorder service on a Pi camera.
+type ThermalRecorder interface {
+	TakeSnapshot() error
+	TakeTestRecording() error
+}
+
+// Modemd manages the modem.
+type Modemd interface {
+	Status() (map[string]interface{}, error)
+	StayOnFor(minutes int) error
+	SetAPN(apn string) error
+}
+
+// RTC is the real time clock service on a TC2.
+type RTC interface {
+	// Time returns the time of the RTC and whether its clock integrity is ok.
+	Time() (time.Time, bool, error)
+	SetTime(t time.Time) error
+}
+
+// NetManager is rpi-net-manager, which manages the WiFi and hotspot.
+type NetManager interface {
+	State() (netmanagerclient.NetworkState, error)
+	EnableWifi(force bool) error
+	EnableHotspot(force bool) error
+	KeepHotspotOnFor(seconds int) error
+	ScanWifiNetworks() ([]netmanagerclient.WiFiNetwork, error)
+	SavedWifiNetworks() ([]netmanagerclient.WiFiNetwork, error)
+	FindNetworkBySSID(ssid string) (netmanagerclient.WiFiNetwork, bool)
+	AddWifiNetwork(ssid, psk string) error
+	ConnectWifiNetwork(ssid string) error
+	DisconnectWifiNetwork(ssid string, startHotspot bool) error
+	RemoveWifiNetwork(ssid string, disconnect, startHotspot bool) error
+	HotspotInterfaces() ([]string, error)
+	HotspotInterface() (string, error)
+	SetHotspotInterface(iface string) error
+}
+
+// Audiobait plays sounds through the audiobait service.
+type Audiobait interface {
+	PlayFromID(fileID, volume, priority int) (bool, error)
+	PlayTestSound(volume int) error
+}
+
+// Salt is the salt-updater service.
+type Salt interface {
+	Ping() (*saltrequester.SaltState, error)
+	State() (*saltrequester.SaltState, error)
+	RunUpdate() error
+	ForceUpdate() error
+	IsAutoUpdateOn() (bool, error)
+	SetAutoUpdate(autoUpdate bool) error
+}
+
+// Trap is the trap-controller service.
+type Trap interface {
+	TriggerTrap(details map[string]interface{}) error
+}
+
+// Events is the event-reporter service.
+type Events interface {
+	Keys() ([]uint64, error)
+	Get(key uint64) (*eventclient.Event, error)
+	Delete(key uint64) error
+}
@@ -0,0 +1,120 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package ratelimit limits how often expensive API routes can be called.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/api"
+)
+
+var log = logging.NewLogger("info")
+
+// Limiter gives each client IP its own token bucket, so that one client
+// calling the routes it wraps too often doesn't lock the others out.
+type Limiter struct {
+	name     string
+	interval time.Duration
+	burst    float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter that allows each client burst calls at once, then one
+// call every interval.
+func New(name string, interval time.Duration, burst int, l *logging.Logger) *Limiter {
+	if l != nil {
+		log = l
+	}
+	return &Limiter{
+		name:     name,
+		interval: interval,
+		burst:    float64(burst),
+		buckets:  map[string]*bucket{},
+	}
+}
+
+// reserve takes a token from the client's bucket if there is one, otherwise
+// it returns how long until the next token is available.
+func (l *Limiter) reserve(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst}
+		l.buckets[client] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+float64(now.Sub(b.last))/float64(l.interval))
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(l.interval))
+}
+
+// prune forgets the buckets that have refilled, which are the same as a new
+// one. Must be called with l.mu held.
+func (l *Limiter) prune(now time.Time) {
+	full := time.Duration(l.burst * float64(l.interval))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Limit wraps a handler so that it responds with 429 Too Many Requests when
+// a client calls it more often than the limiter allows.
+func (l *Limiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if wait := l.reserve(ip, time.Now()); wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			log.Printf("rate limiting %s request from %s", l.name, ip)
+			w.Header().Set("Retry-After", fmt.Sprint(seconds))
+			api.WriteError(w, http.StatusTooManyRequests, fmt.Sprintf("too many %s requests, try again in %d seconds", l.name, seconds), nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,106 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-utils/logging"
+	"github.com/TheCacophonyProject/management-interface/api"
+)
+
+func TestReserveRefills(t *testing.T) {
+	l := New("test", 10*time.Second, 2, logging.NewLogger("error"))
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		after time.Duration
+		wait  time.Duration
+	}{
+		// The burst can be used at once.
+		{0, 0},
+		{0, 0},
+		{0, 10 * time.Second},
+		{4 * time.Second, 6 * time.Second},
+		// A token comes back every interval.
+		{10 * time.Second, 0},
+		{10 * time.Second, 10 * time.Second},
+		// Waiting longer doesn't refill more than the burst.
+		{time.Hour, 0},
+		{time.Hour, 0},
+		{time.Hour, 10 * time.Second},
+	}
+	for i, test := range tests {
+		if got := l.reserve("192.0.2.1", start.Add(test.after)); got != test.wait {
+			t.Errorf("call %d after %v: got wait %v, want %v", i, test.after, got, test.wait)
+		}
+	}
+	// Other clients have their own buckets.
+	if got := l.reserve("192.0.2.2", start.Add(time.Hour)); got != 0 {
+		t.Errorf("another client has to wait %v", got)
+	}
+	if len(l.buckets) != 2 {
+		t.Errorf("got %d buckets, want 2", len(l.buckets))
+	}
+	// Buckets that have refilled are forgotten.
+	l.reserve("192.0.2.2", start.Add(2*time.Hour))
+	if _, ok := l.buckets["192.0.2.1"]; ok || len(l.buckets) != 1 {
+		t.Errorf("got buckets %v", l.buckets)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	l := New("scan", time.Minute, 1, logging.NewLogger("error"))
+	calls := 0
+	h := l.Limit(func(w http.ResponseWriter, r *http.Request) { calls++ })
+	call := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/network/wifi", nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	if w := call("192.0.2.1"); w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	w := call("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("got Retry-After %q, want 60", got)
+	}
+	var resp api.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != "too_many_requests" || resp.Message != "too many scan requests, try again in 60 seconds" {
+		t.Errorf("got %+v", resp)
+	}
+	if w := call("192.0.2.2"); w.Code != http.StatusOK {
+		t.Errorf("another client got status %d", w.Code)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
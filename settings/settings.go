@@ -0,0 +1,121 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package settings has the paths and timings managementd uses, which can be
+// changed in the managementd section of the cacophony config for test rigs
+// and devices other than the TC2.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Settings are read from the managementd section, for example:
+//
+//	[managementd]
+//	test-recordings-dir = "/home/pi/test-recordings"
+//	stay-on-for = "0s"
+type Settings struct {
+	// DeviceType is the type of device, such as "tc2" or "pi", which
+	// decides the features that are turned on. It is read from the salt
+	// minion ID when not set.
+	DeviceType string `mapstructure:"device-type"`
+	// TestRecordingsDir has the CPTV files that can be uploaded and played
+	// through the classifier.
+	TestRecordingsDir string `mapstructure:"test-recordings-dir"`
+	// BatteryReadingsFile and TemperatureFile are the CSV logs that are
+	// shown and can be downloaded.
+	BatteryReadingsFile string `mapstructure:"battery-readings-file"`
+	TemperatureFile     string `mapstructure:"temperature-file"`
+	// StillImageFile is the latest still from the thermal camera.
+	StillImageFile string `mapstructure:"still-image-file"`
+	// SaltGrainsFile is read for the salt grains of the device.
+	SaltGrainsFile string `mapstructure:"salt-grains-file"`
+	// Classifier is run to play test recordings.
+	Classifier string `mapstructure:"classifier"`
+	// AuditLog records the API calls that change something.
+	AuditLog string `mapstructure:"audit-log"`
+	// StayOnFor is how long the stay-on-for command keeps the device on
+	// after an API request, run at most once every StayOnForInterval. It is
+	// in whole minutes, and 0 doesn't run the command at all.
+	StayOnFor         time.Duration `mapstructure:"stay-on-for"`
+	StayOnForInterval time.Duration `mapstructure:"stay-on-for-interval"`
+	// KeepHotspotOnFor is how long the hotspot is kept on after an API
+	// request or after it is started.
+	KeepHotspotOnFor time.Duration `mapstructure:"keep-hotspot-on-for"`
+	// SocketTimeout is how long a camera websocket is kept without a pong
+	// or message from the client. Clients are pinged three times in it.
+	SocketTimeout time.Duration `mapstructure:"socket-timeout"`
+	// SocketWriteTimeout is how long sending a message to a camera websocket
+	// can take before the client is dropped.
+	SocketWriteTimeout time.Duration `mapstructure:"socket-write-timeout"`
+}
+
+// Default returns the settings for a TC2.
+func Default() Settings {
+	return Settings{
+		TestRecordingsDir:   "/var/spool/cptv/test-recordings",
+		BatteryReadingsFile: "/var/log/battery-readings.csv",
+		TemperatureFile:     "/var/log/temperature.csv",
+		StillImageFile:      "/var/spool/cptv/still.png",
+		SaltGrainsFile:      "/etc/salt/grains",
+		Classifier:          "/home/pi/.venv/classifier/bin/pi_classify",
+		AuditLog:            "/var/log/managementd-audit.log",
+		StayOnFor:           5 * time.Minute,
+		StayOnForInterval:   time.Minute,
+		KeepHotspotOnFor:    5 * time.Minute,
+		SocketTimeout:       7 * time.Second,
+		SocketWriteTimeout:  5 * time.Second,
+	}
+}
+
+// Validate checks that the settings can be used, naming the first one that
+// can't.
+func (s Settings) Validate() error {
+	for _, path := range []struct{ key, value string }{
+		{"test-recordings-dir", s.TestRecordingsDir},
+		{"battery-readings-file", s.BatteryReadingsFile},
+		{"temperature-file", s.TemperatureFile},
+		{"still-image-file", s.StillImageFile},
+		{"salt-grains-file", s.SaltGrainsFile},
+		{"classifier", s.Classifier},
+		{"audit-log", s.AuditLog},
+	} {
+		if path.value == "" {
+			return fmt.Errorf("%s can't be empty", path.key)
+		}
+	}
+	if s.StayOnFor < 0 || s.StayOnFor%time.Minute != 0 {
+		return fmt.Errorf("stay-on-for %v isn't a whole number of minutes", s.StayOnFor)
+	}
+	if s.StayOnForInterval <= 0 {
+		return errors.New("stay-on-for-interval has to be positive")
+	}
+	if s.KeepHotspotOnFor < time.Second {
+		return fmt.Errorf("keep-hotspot-on-for %v is less than a second", s.KeepHotspotOnFor)
+	}
+	if s.SocketTimeout <= 0 {
+		return errors.New("socket-timeout has to be positive")
+	}
+	if s.SocketWriteTimeout <= 0 {
+		return errors.New("socket-write-timeout has to be positive")
+	}
+	return nil
+}
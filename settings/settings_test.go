@@ -0,0 +1,56 @@
+/*
+management-interface - Web based management of Raspberry Pis over WiFi
+Copyright (C) 2026, The Cacophony Project
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package settings
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+	for _, test := range []struct {
+		change func(*Settings)
+		want   string
+	}{
+		{func(s *Settings) { s.StayOnFor = 0 }, ""},
+		{func(s *Settings) { s.Classifier = "" }, "classifier"},
+		{func(s *Settings) { s.TestRecordingsDir = "" }, "test-recordings-dir"},
+		{func(s *Settings) { s.AuditLog = "" }, "audit-log"},
+		{func(s *Settings) { s.StayOnFor = 90 * time.Second }, "stay-on-for"},
+		{func(s *Settings) { s.StayOnFor = -time.Minute }, "stay-on-for"},
+		{func(s *Settings) { s.StayOnForInterval = 0 }, "stay-on-for-interval"},
+		{func(s *Settings) { s.KeepHotspotOnFor = time.Millisecond }, "keep-hotspot-on-for"},
+		{func(s *Settings) { s.SocketTimeout = 0 }, "socket-timeout"},
+		{func(s *Settings) { s.SocketWriteTimeout = -time.Second }, "socket-write-timeout"},
+	} {
+		s := Default()
+		test.change(&s)
+		err := s.Validate()
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%+v: %v", s, err)
+		case test.want != "" && (err == nil || !strings.HasPrefix(err.Error(), test.want+" ")):
+			t.Errorf("%+v: got error %v, want one about %s", s, err, test.want)
+		}
+	}
+}
@@ -1,8 +1,79 @@
+// Session token for the management API, from signing in on the
+// /change-password page. The API also sets it as a cookie, which is what
+// authenticates the camera websocket.
+const sessionKey = "managementd-session";
+
+function authHeader() {
+  return "Bearer " + (localStorage.getItem(sessionKey) || "");
+}
+
+// Start a session, returning the login response or throwing the response if
+// the credentials weren't accepted.
+async function login(username, password) {
+  const response = await fetch("/api/login", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ username, password }),
+  });
+  if (!response.ok) {
+    throw response;
+  }
+  const session = await response.json();
+  localStorage.setItem(sessionKey, session.token);
+  return session;
+}
+
+async function logout() {
+  try {
+    await fetch("/api/logout", {
+      method: "POST",
+      headers: { Authorization: authHeader() },
+    });
+  } catch (e) {
+    console.log(e);
+  }
+  localStorage.removeItem(sessionKey);
+  window.location.href = "/change-password";
+}
+
+// Send the user to the change password page to sign in if there is no valid
+// session, or the default password still needs changing.
+async function checkCredentials() {
+  if (window.location.pathname == "/change-password") {
+    return;
+  }
+  try {
+    const response = await fetch("/api/version", {
+      headers: { Authorization: authHeader() },
+    });
+    if (response.status == 401 || response.status == 403) {
+      window.location.href = "/change-password";
+    }
+  } catch (e) {
+    console.log(e);
+  }
+}
+checkCredentials();
+
+// Get the message from an API error response body, which is JSON like
+// {"code": "...", "message": "...", "details": ..., "requestId": "..."}.
+function apiErrorMessage(body) {
+  try {
+    const error = JSON.parse(body);
+    if (error.message) {
+      return error.details
+        ? `${error.message} (${error.details})`
+        : error.message;
+    }
+  } catch (e) {}
+  return body;
+}
+
 function apiGetJSON(url) {
   return new Promise((resolve, reject) => {
     const xhr = new XMLHttpRequest();
     xhr.open("GET", url, true);
-    xhr.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+    xhr.setRequestHeader("Authorization", authHeader());
     xhr.onload = () => {
       if (200 <= xhr.status && xhr.status < 300) {
         resolve(JSON.parse(xhr.responseText));
@@ -19,7 +90,7 @@ function apiFormURLEncodedPost(url, data) {
   return new Promise((resolve, reject) => {
     const xhr = new XMLHttpRequest();
     xhr.open("POST", url, true);
-    xhr.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+    xhr.setRequestHeader("Authorization", authHeader());
     xhr.setRequestHeader(
       "Content-type",
       "application/x-www-form-urlencoded; charset=UTF-8"
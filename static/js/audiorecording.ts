@@ -1,4 +1,9 @@
 "use strict";
+
+// Defined in api-utils.js, which the navbar loads on every page.
+declare function authHeader(): string;
+declare function apiErrorMessage(body: string): string;
+
 enum AudioMode {
   Audio = 1,
   Thermal = 0,
@@ -35,7 +40,7 @@ async function getAudioStatus() {
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.responseType = "json";
   xmlHttp.open("GET", "/api/audio/audio-status", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   var success = false;
   xmlHttp.onload = async function () {
     if (xmlHttp.status == 200) {
@@ -147,7 +152,7 @@ async function takeTestRecording() {
 async function recordingAPICall(checkResponse: boolean) {
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("PUT", "/api/audio/long-recording?seconds=300", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
 
   var success = false;
   if (checkResponse) {
@@ -179,7 +184,7 @@ async function recordingAPICall(checkResponse: boolean) {
 async function testAPICall(checkResponse: boolean) {
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("PUT", "/api/audio/test-recording", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   var success = false;
   if (checkResponse) {
     xmlHttp.onload = async function () {
@@ -221,7 +226,7 @@ function updateAudio() {
   ).value;
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("POST", "/api/audiorecording", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   xmlHttp.setRequestHeader(
     "Content-type",
     "application/x-www-form-urlencoded; charset=UTF-8"
@@ -253,7 +258,7 @@ function updateAudio() {
 }
 
 function updateAudioError(xmlHttp: XMLHttpRequest) {
-  alert("error updating audio recording: " + xmlHttp.responseText);
+  alert("error updating audio recording: " + apiErrorMessage(xmlHttp.responseText));
 }
 
 window.onload = async function () {
@@ -245,13 +245,13 @@ async function saveBatteryConfig() {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
-        "Authorization": "Basic " + btoa("admin:feathers")
+        "Authorization": authHeader()
       },
       body: JSON.stringify(body)
     });
 
     if (!response.ok) {
-      const errorText = await response.text();
+      const errorText = apiErrorMessage(await response.text());
       throw new Error(`Failed to save battery configuration: ${errorText}`);
     }
 
@@ -290,12 +290,12 @@ async function clearBatteryConfig() {
     const response = await fetch("/api/battery/config", {
       method: "DELETE",
       headers: {
-        "Authorization": "Basic " + btoa("admin:feathers")
+        "Authorization": authHeader()
       }
     });
 
     if (!response.ok) {
-      const errorText = await response.text();
+      const errorText = apiErrorMessage(await response.text());
       throw new Error(`Failed to clear battery configuration: ${errorText}`);
     }
 
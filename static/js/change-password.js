@@ -0,0 +1,74 @@
+"use strict";
+
+async function changePassword() {
+  const user = document.getElementById("user").value;
+  const currentPassword = document.getElementById("current-password").value;
+  const newPassword = document.getElementById("new-password").value;
+  if (newPassword != document.getElementById("confirm-password").value) {
+    alert("New passwords do not match");
+    return;
+  }
+
+  const button = document.getElementById("change-password-button");
+  button.disabled = true;
+  try {
+    if (newPassword == "") {
+      await signIn(user, currentPassword);
+      return;
+    }
+    // Sign in first rather than sending Basic credentials, so a wrong
+    // password doesn't make the browser prompt for them.
+    try {
+      await login(user, currentPassword);
+    } catch (response) {
+      if (response.status == 403) {
+        alert("Incorrect user or password");
+      } else {
+        alert("Error signing in: " + response.statusText);
+      }
+      return;
+    }
+    const response = await fetch("/api/password", {
+      method: "POST",
+      headers: {
+        Authorization: authHeader(),
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ currentPassword, newPassword }),
+    });
+    if (response.ok) {
+      await login(user, newPassword);
+      alert("Password changed");
+      window.location.href = "/";
+    } else {
+      alert(
+        "Error changing password: " + apiErrorMessage(await response.text())
+      );
+    }
+  } catch (e) {
+    alert("Error changing password: " + e);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+// Without a new password just sign in, for when the password has already
+// been changed from another phone.
+async function signIn(user, password) {
+  let session;
+  try {
+    session = await login(user, password);
+  } catch (response) {
+    if (response.status == 403) {
+      alert("Incorrect user or password");
+    } else {
+      alert("Error signing in: " + response.statusText);
+    }
+    return;
+  }
+  if (session.mustChangePassword) {
+    alert("The default password must be changed before the device can be configured");
+    return;
+  }
+  window.location.href = "/";
+}
@@ -8,7 +8,7 @@ async function loadConfig() {
   try {
     const response = await fetch("/api/config", {
       headers: {
-        Authorization: "Basic " + btoa("admin:feathers"),
+        Authorization: authHeader(),
       },
     });
 
@@ -144,7 +144,7 @@ async function saveConfig(section, data) {
     const response = await fetch("/api/config", {
       method: "POST",
       headers: {
-        Authorization: "Basic " + btoa("admin:feathers"),
+        Authorization: authHeader(),
       },
       body: formData,
     });
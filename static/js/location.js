@@ -5,7 +5,7 @@ function clearLocation() {
   var data = [{ name: "section", value: "location" }];
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("POST", "/api/clear-config-section", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   xmlHttp.setRequestHeader(
     "Content-type",
     "application/x-www-form-urlencoded; charset=UTF-8"
@@ -38,7 +38,7 @@ function updateLocation() {
 
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("POST", "/api/location", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   xmlHttp.setRequestHeader(
     "Content-type",
     "application/x-www-form-urlencoded; charset=UTF-8"
@@ -60,5 +60,5 @@ function updateLocation() {
 }
 
 function updateLocationError(xmlHttp) {
-  alert("error updating location: " + xmlHttp.responseText);
+  alert("error updating location: " + apiErrorMessage(xmlHttp.responseText));
 }
@@ -1,5 +1,5 @@
 (function () {
-  const AUTH_HEADER = "Basic " + btoa("admin:feathers");
+  const AUTH_HEADER = authHeader();
   const select = document.getElementById("hotspotInterfaceSelect");
   const applyBtn = document.getElementById("hotspotInterfaceApply");
   const feedback = document.getElementById("hotspotInterfaceFeedback");
@@ -41,7 +41,7 @@
       });
       if (!response.ok) {
         if (response.status === 501) {
-          const text = await response.text();
+          const text = apiErrorMessage(await response.text());
           setFeedback(
             text.trim() || "Hotspot interface selection not supported.",
             "info"
@@ -53,7 +53,7 @@
           select.appendChild(opt);
           return false;
         }
-        const text = await response.text();
+        const text = apiErrorMessage(await response.text());
         throw new Error(text || "Failed to load hotspot configuration");
       }
       const data = await response.json();
@@ -119,7 +119,7 @@
       });
       if (!response.ok) {
         if (response.status === 501) {
-          const text = await response.text();
+          const text = apiErrorMessage(await response.text());
           setFeedback(
             text.trim() || "Hotspot interface selection not supported.",
             "info"
@@ -128,7 +128,7 @@
           applyBtn.disabled = true;
           return;
         }
-        const text = await response.text();
+        const text = apiErrorMessage(await response.text());
         throw new Error(text || "Failed to update hotspot interface");
       }
 
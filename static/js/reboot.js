@@ -1,7 +1,7 @@
 function reboot() {
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("POST", "/api/reboot", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   xmlHttp.onload = async function () {
     if (xmlHttp.status == 200) {
       alert(
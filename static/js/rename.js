@@ -17,7 +17,7 @@ window.onload = function () {
 function loadDeviceDetails() {
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("GET", "/api/device-info", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
 
   xmlHttp.onload = async function () {
     if (xmlHttp.status == 200) {
@@ -45,7 +45,7 @@ function rename() {
 
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("POST", "/api/reregister", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
   xmlHttp.setRequestHeader(
     "Content-type",
     "application/x-www-form-urlencoded; charset=UTF-8"
@@ -71,7 +71,10 @@ function rename() {
 
 function renameError(xmlHttp) {
   resetRenameButton();
-  alert("error renaming device: " + getResponseMessage(xmlHttp.responseText));
+  alert(
+    "error renaming device: " +
+      getResponseMessage(apiErrorMessage(xmlHttp.responseText))
+  );
 }
 
 function resetRenameButton() {
@@ -73,7 +73,7 @@ async function updateSignal() {
   return;
   var xmlHttp = new XMLHttpRequest();
   xmlHttp.open("GET", "/api/signal-strength", true);
-  xmlHttp.setRequestHeader("Authorization", "Basic " + btoa("admin:feathers"));
+  xmlHttp.setRequestHeader("Authorization", authHeader());
 
   xmlHttp.onload = async function () {
     if (xmlHttp.status == 200) {
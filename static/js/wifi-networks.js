@@ -45,7 +45,7 @@ function addNetwork() {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
-        Authorization: "Basic " + btoa("admin:feathers"),
+        Authorization: authHeader(),
       },
     }
   )
@@ -74,7 +74,7 @@ function removeNetwork(ssid) {
     method: "DELETE",
     headers: {
       "Content-Type": "application/json",
-      Authorization: "Basic " + btoa("admin:feathers"),
+      Authorization: authHeader(),
     },
   })
     .then((response) => {
@@ -98,7 +98,7 @@ function removeNetwork(ssid) {
 function switchToWifi() {
   fetch("/api/enable-wifi", {
     method: "POST",
-    headers: { Authorization: "Basic " + btoa("admin:feathers") },
+    headers: { Authorization: authHeader() },
   })
     .then((response) => {
       if (!response.ok) {